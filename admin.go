@@ -0,0 +1,282 @@
+package hashgossip
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/DemonVex/hashgossip/logger"
+	m "github.com/DemonVex/hashgossip/models"
+)
+
+var ErrAdminNotLoopback = errors.New("admin API on non-loopback address requires AdminAllowRemote and AdminToken")
+
+// ответы админского API повторяют модели, но с полями, которые по сети между узлами не ходят
+type peerView struct {
+	IP       net.IP
+	Port     uint16
+	Zone     string `json:",omitempty"`
+	ID       string `json:",omitempty"`
+	State    string
+	LastSeen time.Time
+}
+
+type messageView struct {
+	Payload  []byte
+	Checksum string
+}
+
+type configView struct {
+	NodeID           string
+	Network          string
+	Addr             string
+	AdvertiseAddress string
+	MulticastAddress string
+	Seeds            []string
+	Codec            string
+	Compression      string
+	DataDir          string
+	ProbeInterval    string
+	SuspectTimeout   string
+	DeadTimeout      string
+	RateLimit        m.RateLimit
+	Reputation       m.Reputation
+	LogLevel         string
+}
+
+// startAdmin поднимает HTTP API на AdminAddress. Без AdminAllowRemote
+// принимаются только loopback адреса, а с ним обязателен AdminToken.
+func (n *Node) startAdmin() error {
+	host, _, err := net.SplitHostPort(n.opts.AdminAddress)
+	if err != nil {
+		return err
+	}
+	ip := net.ParseIP(host)
+	loopback := host == "localhost" || (ip != nil && ip.IsLoopback())
+	if !loopback && (!n.opts.AdminAllowRemote || n.opts.AdminToken == "") {
+		return ErrAdminNotLoopback
+	}
+
+	ln, err := net.Listen("tcp", n.opts.AdminAddress)
+	if err != nil {
+		return err
+	}
+	n.admin = &http.Server{Handler: n.adminHandler(), ReadHeaderTimeout: 5 * time.Second}
+	n.log.Info("admin API started", logger.F("address", "http://"+ln.Addr().String()))
+
+	n.goRun(func() {
+		if err := n.admin.Serve(ln); err != nil && err != http.ErrServerClosed {
+			n.log.Error("admin API failed", logger.Err(err))
+		}
+	})
+	return nil
+}
+
+func (n *Node) adminHandler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/health", n.getOnly(n.healthHandler))
+	mux.HandleFunc("/peers", n.getOnly(n.peersHandler))
+	mux.HandleFunc("/messages", n.getOnly(n.messagesHandler))
+	mux.HandleFunc("/hashes/count", n.getOnly(n.hashCountHandler))
+	mux.HandleFunc("/config", n.getOnly(n.configHandler))
+	mux.HandleFunc("/metrics", n.getOnly(n.metricsHandler))
+	mux.HandleFunc("/log/level", n.logLevelHandler)
+	mux.HandleFunc("/publish", n.postOnly(n.publishHandler))
+	mux.HandleFunc("/leave", n.postOnly(n.leaveHandler))
+	mux.HandleFunc("/reload", n.postOnly(n.reloadHandler))
+	return n.authorize(mux)
+}
+
+// токен читается на каждый запрос, его меняет Reload
+func (n *Node) authorize(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token := n.options().AdminToken
+		if token == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if subtle.ConstantTimeCompare([]byte(r.Header.Get("Authorization")), []byte("Bearer "+token)) != 1 {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			n.writeError(w, http.StatusUnauthorized, errors.New("invalid or missing bearer token"))
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func (n *Node) getOnly(h http.HandlerFunc) http.HandlerFunc {
+	return n.methodOnly(http.MethodGet, h)
+}
+
+func (n *Node) postOnly(h http.HandlerFunc) http.HandlerFunc {
+	return n.methodOnly(http.MethodPost, h)
+}
+
+func (n *Node) methodOnly(method string, h http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != method {
+			w.Header().Set("Allow", method)
+			n.writeError(w, http.StatusMethodNotAllowed, errors.New(fmt.Sprintf("use %v", method)))
+			return
+		}
+		h(w, r)
+	}
+}
+
+func (n *Node) healthHandler(w http.ResponseWriter, r *http.Request) {
+	select {
+	case <-n.done:
+		n.writeJSON(w, http.StatusServiceUnavailable, map[string]string{"Status": "stopped"})
+	default:
+		n.writeJSON(w, http.StatusOK, map[string]interface{}{"Status": "ok", "NodeID": n.id, "Peers": len(n.peers.List())})
+	}
+}
+
+func (n *Node) peersHandler(w http.ResponseWriter, r *http.Request) {
+	peers := []peerView{}
+	for _, p := range n.peers.List() {
+		peers = append(peers, peerView{IP: p.IP, Port: p.Port, Zone: p.Zone, ID: p.ID, State: p.State.String(), LastSeen: p.LastSeen})
+	}
+	n.writeJSON(w, http.StatusOK, peers)
+}
+
+// хранилище держит одно сообщение, но список оставляет место для других хранилищ
+func (n *Node) messagesHandler(w http.ResponseWriter, r *http.Request) {
+	messages := []messageView{}
+	if msg := n.messages.Get(); !msg.IsEmpty() {
+		messages = append(messages, messageView{Payload: msg.GetPayload(), Checksum: hex.EncodeToString(msg.GetHash())})
+	}
+	n.writeJSON(w, http.StatusOK, messages)
+}
+
+func (n *Node) hashCountHandler(w http.ResponseWriter, r *http.Request) {
+	n.writeJSON(w, http.StatusOK, map[string]int{"Count": n.hashes.Count()})
+}
+
+// токен в ответ не попадает
+func (n *Node) configHandler(w http.ResponseWriter, r *http.Request) {
+	o := n.options()
+	conf := configView{
+		NodeID:           n.id,
+		Network:          o.Network,
+		AdvertiseAddress: n.self.ToString(),
+		MulticastAddress: o.MulticastAddress,
+		Seeds:            o.Seeds,
+		Codec:            o.Codec.Name(),
+		Compression:      o.Compression.Algorithm.String(),
+		DataDir:          o.DataDir,
+		ProbeInterval:    o.ProbeInterval.String(),
+		SuspectTimeout:   o.SuspectTimeout.String(),
+		DeadTimeout:      o.DeadTimeout.String(),
+		RateLimit:        o.RateLimit,
+		Reputation:       o.Reputation,
+		LogLevel:         n.log.Level().String(),
+	}
+	if addr := n.Addr(); addr != nil {
+		conf.Addr = addr.String()
+	}
+	n.writeJSON(w, http.StatusOK, conf)
+}
+
+func (n *Node) metricsHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	if err := n.WriteMetrics(w); err != nil {
+		n.log.Warn("metrics write failed", logger.Err(err))
+	}
+}
+
+// GET возвращает уровень логирования, POST с уровнем в теле меняет его
+func (n *Node) logLevelHandler(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPost:
+		body, err := ioutil.ReadAll(io.LimitReader(r.Body, 64))
+		if err != nil {
+			n.writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		level, err := logger.ParseLevel(strings.TrimSpace(string(body)))
+		if err != nil {
+			n.writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		n.SetLogLevel(level)
+	default:
+		w.Header().Set("Allow", "GET, POST")
+		n.writeError(w, http.StatusMethodNotAllowed, errors.New("use GET or POST"))
+		return
+	}
+	n.writeJSON(w, http.StatusOK, map[string]string{"Level": n.log.Level().String()})
+}
+
+// reload перечитывает конфиг так же, как SIGHUP
+func (n *Node) reloadHandler(w http.ResponseWriter, r *http.Request) {
+	res, err := n.ReloadConfig()
+	switch {
+	case err == ErrReloadUnsupported:
+		n.writeError(w, http.StatusNotImplemented, err)
+	case err != nil:
+		n.writeError(w, http.StatusBadRequest, err)
+	default:
+		n.writeJSON(w, http.StatusOK, res)
+	}
+}
+
+// тело запроса целиком становится payload сообщения
+func (n *Node) publishHandler(w http.ResponseWriter, r *http.Request) {
+	payload, err := ioutil.ReadAll(io.LimitReader(r.Body, MaxPayloadSize+1))
+	if err != nil {
+		n.writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	if len(payload) == 0 {
+		n.writeError(w, http.StatusBadRequest, errors.New("empty payload"))
+		return
+	}
+	if len(payload) > MaxPayloadSize {
+		n.writeError(w, http.StatusRequestEntityTooLarge, ErrPayloadTooLarge)
+		return
+	}
+
+	hash, err := n.Publish(r.Context(), payload)
+	if err != nil {
+		n.writeError(w, http.StatusServiceUnavailable, err)
+		return
+	}
+	n.writeJSON(w, http.StatusOK, map[string]string{"Checksum": hex.EncodeToString(hash)})
+}
+
+// leave прощается с пирами и останавливает узел после ответа: остановка закрывает и сам HTTP сервер
+func (n *Node) leaveHandler(w http.ResponseWriter, r *http.Request) {
+	n.writeJSON(w, http.StatusAccepted, map[string]string{"Status": "leaving"})
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := n.Leave(ctx); err != nil {
+			n.log.Warn("leave failed", logger.Err(err))
+		}
+	}()
+}
+
+func (n *Node) writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(v); err != nil {
+		n.log.Warn("admin response failed", logger.Err(err))
+	}
+}
+
+func (n *Node) writeError(w http.ResponseWriter, status int, err error) {
+	n.writeJSON(w, status, map[string]string{"Error": strings.TrimSpace(err.Error())})
+}
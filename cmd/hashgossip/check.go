@@ -0,0 +1,93 @@
+package main
+
+import (
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	c "github.com/DemonVex/hashgossip/consts"
+	"github.com/DemonVex/hashgossip/handlers"
+)
+
+// runCheck рассылает MONIT через multicast и seeds, собирает отчёты и сравнивает хэши
+// сообщений в хранилищах узлов
+func runCheck(cli *cli, args []string) int {
+	timeout := cli.fs.Duration("timeout", 5*time.Second, "How long to wait for reports")
+	expect := cli.fs.Int("nodes", 0, "Stop waiting as soon as this many nodes answered")
+	if code, ok := cli.parse(args); !ok {
+		return code
+	}
+	conf, err := cli.loadConfig()
+	if err != nil {
+		return fail(err)
+	}
+
+	rc := newReportCollector()
+	onReport, enough := rc.untilCount(*expect)
+	h := &handlers.UdpHandler{OnReport: onReport}
+
+	err = request(conf, c.PrefMonitoring, h, func() {
+		select {
+		case <-time.After(*timeout):
+		case <-enough:
+		}
+	})
+	if err != nil {
+		return fail(err)
+	}
+	return printCheck(os.Stdout, rc, *expect)
+}
+
+func printCheck(w io.Writer, rc *reportCollector, expect int) int {
+	reports := rc.list()
+	if len(reports) == 0 {
+		fmt.Fprintln(w, "no nodes answered")
+		return exitNoAnswers
+	}
+
+	// эталон - хэш, который хранит большинство узлов
+	counts := make(map[string]int)
+	majority := ""
+	for _, r := range reports {
+		h := hex.EncodeToString(r.Msg.GetHash())
+		counts[h]++
+		if counts[h] > counts[majority] || (counts[h] == counts[majority] && h > majority) {
+			majority = h
+		}
+	}
+
+	first, last := rc.latencyOf(reports[0]), rc.latencyOf(reports[len(reports)-1])
+	fmt.Fprintf(w, "%v nodes answered, first in %v, last in %v\n", len(reports), first, last)
+	diverged := 0
+	for _, r := range reports {
+		h := hex.EncodeToString(r.Msg.GetHash())
+		mark := "ok"
+		if h != majority {
+			mark = "DIVERGED"
+			diverged++
+		}
+		fmt.Fprintf(w, "%-16v %-24v %-40v %-12v %v\n", orDash(r.NodeID), r.address(), hashOrNone(h), rc.latencyOf(r), mark)
+	}
+
+	code := exitOK
+	if diverged > 0 {
+		fmt.Fprintf(w, "%v of %v nodes diverge from %v\n", diverged, len(reports), hashOrNone(majority))
+		code = exitDiverged
+	} else {
+		fmt.Fprintf(w, "all nodes store %v\n", hashOrNone(majority))
+	}
+	if expect > 0 && len(reports) < expect {
+		fmt.Fprintf(w, "expected %v nodes, got %v\n", expect, len(reports))
+		code = exitDiverged
+	}
+	return code
+}
+
+func hashOrNone(hash string) string {
+	if hash == "" {
+		return "<none>"
+	}
+	return hash
+}
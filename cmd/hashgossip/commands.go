@@ -0,0 +1,379 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"os/signal"
+	"runtime"
+	"sort"
+	"strings"
+	"syscall"
+	"text/tabwriter"
+	"time"
+
+	"github.com/DemonVex/hashgossip"
+	"github.com/DemonVex/hashgossip/codec"
+	c "github.com/DemonVex/hashgossip/consts"
+	"github.com/DemonVex/hashgossip/handlers"
+	"github.com/DemonVex/hashgossip/logger"
+	m "github.com/DemonVex/hashgossip/models"
+	"github.com/DemonVex/hashgossip/transport"
+	"github.com/DemonVex/hashgossip/wire"
+)
+
+var ErrNotSent = errors.New("no multicast address or seeds to send to")
+
+func runAgent(cli *cli, args []string) int {
+	if code, ok := cli.parse(args); !ok {
+		return code
+	}
+	conf, err := cli.loadConfig()
+	if err != nil {
+		return fail(err)
+	}
+
+	opts := hashgossip.OptionsFromConfig(conf)
+	if opts.Logger != nil {
+		logger.SetDefault(opts.Logger)
+	}
+	// SIGHUP и POST /reload перечитывают конфиг со всеми слоями и флагами
+	opts.LoadConfig = cli.loadConfig
+	node := hashgossip.NewNode(opts)
+	if err := node.Start(context.Background()); err != nil {
+		return fail(err)
+	}
+	logger.Default().Info("node started", logger.NodeID(node.ID()), logger.F("address", node.Addr().String()))
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM, syscall.SIGHUP)
+	go func() {
+		for sig := range signals {
+			if sig == syscall.SIGHUP {
+				// итог перезагрузки пишет в лог сам узел
+				if _, err := node.ReloadConfig(); err != nil {
+					logger.Default().Warn("config reload failed, old settings are kept", logger.Err(err))
+				}
+				continue
+			}
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			if err := node.Stop(ctx); err != nil {
+				logger.Default().Warn("stop failed", logger.Err(err))
+			}
+			cancel()
+			return
+		}
+	}()
+
+	if err := node.Wait(); err == hashgossip.ErrShutdownSignal {
+		return exitShutdown
+	}
+	return exitOK
+}
+
+func runWatch(cli *cli, args []string) int {
+	asJSON := cli.fs.Bool("json", false, "Print reports as JSON instead of a table")
+	timeout := cli.fs.Duration("timeout", 5*time.Second, "How long to wait for reports")
+	live := cli.fs.Bool("live", false, "Keep asking nodes and redraw the table until Ctrl-C")
+	interval := cli.fs.Duration("interval", time.Second, "How often to ask nodes in live mode")
+	if code, ok := cli.parse(args); !ok {
+		return code
+	}
+	if *live && *asJSON {
+		return cli.usageError("-live and -json can't be used together")
+	}
+	if *interval <= 0 {
+		return cli.usageError("-interval must be positive")
+	}
+	conf, err := cli.loadConfig()
+	if err != nil {
+		return fail(err)
+	}
+	if *live {
+		return watchLive(conf, *interval)
+	}
+
+	rc := newReportCollector()
+	// для вывода отчётов хранилища не нужны
+	h := &handlers.UdpHandler{OnReport: func(src *net.UDPAddr, r m.NodeReport) { rc.add(src, r) }}
+	if err := request(conf, c.PrefMonitoring, h, func() { time.Sleep(*timeout) }); err != nil {
+		return fail(err)
+	}
+
+	reports := rc.list()
+	if *asJSON {
+		err = printReportsJSON(os.Stdout, reports)
+	} else {
+		err = printReportsTable(os.Stdout, reports)
+	}
+	if err != nil {
+		return fail(err)
+	}
+	if len(reports) == 0 {
+		return exitNoAnswers
+	}
+	return exitOK
+}
+
+func runKill(cli *cli, args []string) int {
+	if code, ok := cli.parse(args); !ok {
+		return code
+	}
+	conf, err := cli.loadConfig()
+	if err != nil {
+		return fail(err)
+	}
+	if err := broadcast(conf, wire.Pack(c.PrefShutdown, codec.DefaultID, nil)); err != nil {
+		return fail(err)
+	}
+	return exitOK
+}
+
+func runPublish(cli *cli, args []string) int {
+	if code, ok := cli.parse(args); !ok {
+		return code
+	}
+	if cli.fs.NArg() > 1 {
+		return cli.usageError("too many arguments, quote the message")
+	}
+	conf, err := cli.loadConfig()
+	if err != nil {
+		return fail(err)
+	}
+
+	var payload []byte
+	if cli.fs.NArg() == 1 {
+		payload = []byte(cli.fs.Arg(0))
+	} else if payload, err = ioutil.ReadAll(os.Stdin); err != nil {
+		return fail(err)
+	}
+	if len(payload) == 0 {
+		return cli.usageError("message is empty")
+	}
+	if len(payload) > hashgossip.MaxPayloadSize {
+		return fail(hashgossip.ErrPayloadTooLarge)
+	}
+
+	// сообщение уходит узлам так же, как от соседа по кластеру, дальше они рассылают его сами
+	msg, err := m.NewMessage(payload)
+	if err != nil {
+		return fail(err)
+	}
+	packet, err := wire.Encoding{Codec: codec.Msgpack}.Encode(c.PrefMessage, msg)
+	if err != nil {
+		return fail(err)
+	}
+	if err := broadcast(conf, packet); err != nil {
+		return fail(err)
+	}
+	fmt.Println(hex.EncodeToString(msg.GetHash()))
+	return exitOK
+}
+
+func runPeers(cli *cli, args []string) int {
+	timeout := cli.fs.Duration("timeout", 5*time.Second, "How long to wait for reports")
+	if code, ok := cli.parse(args); !ok {
+		return code
+	}
+	conf, err := cli.loadConfig()
+	if err != nil {
+		return fail(err)
+	}
+
+	rc := newReportCollector()
+	h := &handlers.UdpHandler{OnReport: func(src *net.UDPAddr, r m.NodeReport) { rc.add(src, r) }}
+	if err := request(conf, c.PrefMonitoring, h, func() { time.Sleep(*timeout) }); err != nil {
+		return fail(err)
+	}
+	reports := rc.list()
+	if len(reports) == 0 {
+		fmt.Fprintln(os.Stderr, "no nodes answered")
+		return exitNoAnswers
+	}
+
+	tw := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "NODE\tPEER\tPEER ID\tSTATE\tLAST SEEN")
+	for _, r := range reports {
+		if len(r.Peers) == 0 && r.PeerCount > 0 {
+			fmt.Fprintf(tw, "%v\t(%v peers, list did not fit into report)\t\t\t\n", orDash(r.NodeID), r.PeerCount)
+			continue
+		}
+		peers := append([]m.PeerReport(nil), r.Peers...)
+		sort.Slice(peers, func(i, j int) bool { return peers[i].Address < peers[j].Address })
+		for _, p := range peers {
+			fmt.Fprintf(tw, "%v\t%v\t%v\t%v\t%v ago\n", orDash(r.NodeID), p.Address, orDash(p.ID), p.State, p.Silence.Round(time.Millisecond))
+		}
+	}
+	if err := tw.Flush(); err != nil {
+		return fail(err)
+	}
+	return exitOK
+}
+
+func runBans(cli *cli, args []string) int {
+	timeout := cli.fs.Duration("timeout", 5*time.Second, "How long to wait for answers")
+	if code, ok := cli.parse(args); !ok {
+		return code
+	}
+	conf, err := cli.loadConfig()
+	if err != nil {
+		return fail(err)
+	}
+	// отчёты о карантине пишет в лог сам обработчик BANRP
+	if err := request(conf, c.PrefBanList, &handlers.UdpHandler{}, func() { time.Sleep(*timeout) }); err != nil {
+		return fail(err)
+	}
+	return exitOK
+}
+
+func runUnban(cli *cli, args []string) int {
+	if code, ok := cli.parse(args); !ok {
+		return code
+	}
+	if cli.fs.NArg() != 1 || net.ParseIP(cli.fs.Arg(0)) == nil {
+		return cli.usageError("expected one IP address")
+	}
+	conf, err := cli.loadConfig()
+	if err != nil {
+		return fail(err)
+	}
+
+	payload, err := handlers.Encode(c.PrefUnban, codec.Msgpack, cli.fs.Arg(0))
+	if err != nil {
+		return fail(err)
+	}
+	// UNBAN принимается только с адресов самого узла, поэтому seeds не нужны
+	if err := transport.SendMulticast(conf.MulticastAddress, mcastOptions(conf), payload, nil); err != nil {
+		return fail(err)
+	}
+	return exitOK
+}
+
+func runKeygen(cli *cli, args []string) int {
+	nodeID := cli.fs.Bool("node-id", false, "Generate a node ID for NodeID instead of a token")
+	if code, ok := cli.parse(args); !ok {
+		return code
+	}
+
+	if *nodeID {
+		fmt.Println(m.NewNodeID())
+		return exitOK
+	}
+	// токен для AdminToken
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return fail(err)
+	}
+	fmt.Println(hex.EncodeToString(b))
+	return exitOK
+}
+
+// runConfig проверяет конфиг со всеми слоями, подкоманда пока одна - validate
+func runConfig(cli *cli, args []string) int {
+	// подкоманда может стоять и до флагов, и после них
+	sub := ""
+	if len(args) > 0 && args[0] == "validate" {
+		sub, args = args[0], args[1:]
+	}
+	if code, ok := cli.parse(args); !ok {
+		return code
+	}
+	if sub == "" && cli.fs.NArg() == 1 {
+		sub = cli.fs.Arg(0)
+	} else if cli.fs.NArg() > 0 {
+		return cli.usageError("too many arguments")
+	}
+	if sub != "validate" {
+		return cli.usageError("expected subcommand: validate")
+	}
+
+	if _, err := cli.loadConfig(); err != nil {
+		return fail(err)
+	}
+	fmt.Printf("%v: ok\n", sourceName(cli.configPath()))
+	return exitOK
+}
+
+func runVersion(cli *cli, args []string) int {
+	if code, ok := cli.parse(args); !ok {
+		return code
+	}
+	fmt.Printf("hashgossip %v %v %v/%v\n", c.Version, runtime.Version(), runtime.GOOS, runtime.GOARCH)
+	return exitOK
+}
+
+// broadcast отправляет payload через multicast и всем seeds. Ошибка возвращается,
+// только если пакет не ушёл никуда
+func broadcast(conf m.Config, payload []byte) error {
+	sent := 0
+	var errs []string
+	if conf.MulticastAddress != "" {
+		if err := transport.SendMulticast(conf.MulticastAddress, mcastOptions(conf), payload, nil); err != nil {
+			errs = append(errs, "multicast: "+err.Error())
+		} else {
+			sent++
+		}
+	}
+	for _, seed := range conf.Seeds {
+		if err := transport.SendPayloadToUDP(seed, payload); err != nil {
+			errs = append(errs, "seed "+seed+": "+err.Error())
+		} else {
+			sent++
+		}
+	}
+
+	if sent > 0 {
+		for _, e := range errs {
+			fmt.Fprintln(os.Stderr, "warning:", e)
+		}
+		return nil
+	}
+	if len(errs) == 0 {
+		return ErrNotSent
+	}
+	return errors.New(strings.Join(errs, "; "))
+}
+
+// request рассылает prefix со своим портом через multicast и seeds, ответы
+// обрабатывает h, пока не вернётся wait
+func request(conf m.Config, prefix []byte, h *handlers.UdpHandler, wait func()) error {
+	conn, err := listen(conf, h)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	if err := broadcast(conf, portPacket(conn, prefix)); err != nil {
+		return err
+	}
+	wait()
+	return nil
+}
+
+// listen открывает сокет для ответов узлов, их обрабатывает h
+func listen(conf m.Config, h *handlers.UdpHandler) (*net.UDPConn, error) {
+	network := conf.Network
+	if network == "" {
+		network = "udp4"
+	}
+	conn, err := net.ListenUDP(network, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	registry := handlers.NewRegistry(nil)
+	h.Register(registry)
+	go transport.ServeUDP(conn, registry.Dispatch, nil)
+	return conn, nil
+}
+
+// portPacket - запрос, в котором узлы получают порт conn для ответа
+func portPacket(conn *net.UDPConn, prefix []byte) []byte {
+	laddr, _ := conn.LocalAddr().(*net.UDPAddr)
+	return wire.Encoding{}.PortPacket(prefix, uint16(laddr.Port))
+}
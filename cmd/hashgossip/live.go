@@ -0,0 +1,161 @@
+package main
+
+import (
+	"bytes"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"os/signal"
+	"sort"
+	"sync"
+	"syscall"
+	"text/tabwriter"
+	"time"
+
+	c "github.com/DemonVex/hashgossip/consts"
+	"github.com/DemonVex/hashgossip/handlers"
+	m "github.com/DemonVex/hashgossip/models"
+)
+
+// узел считается замолчавшим, если не ответил на столько запросов подряд
+const liveStaleRequests = 3
+
+// цвета строк одной длины, иначе tabwriter сдвинет первую колонку
+const (
+	colorNone   = "\033[39m"
+	colorRed    = "\033[31m"
+	colorYellow = "\033[33m"
+	colorReset  = "\033[0m"
+	clearScreen = "\033[H\033[2J"
+)
+
+type liveNode struct {
+	addrReport
+	seen time.Time
+}
+
+// liveState - последние отчёты узлов. Узлы, которые перестали отвечать,
+// остаются в таблице, чтобы их было видно
+type liveState struct {
+	mutex *sync.Mutex
+	nodes map[string]*liveNode
+}
+
+func (s *liveState) add(src *net.UDPAddr, r m.NodeReport) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	ar := addrReport{Addr: src.String(), NodeReport: r}
+	s.nodes[key(ar)] = &liveNode{addrReport: ar, seen: time.Now()}
+}
+
+func (s *liveState) snapshot() []liveNode {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	list := make([]liveNode, 0, len(s.nodes))
+	for _, n := range s.nodes {
+		list = append(list, *n)
+	}
+	sort.Slice(list, func(i, j int) bool { return key(list[i].addrReport) < key(list[j].addrReport) })
+	return list
+}
+
+// watchLive раз в interval рассылает MONIT и перерисовывает таблицу до Ctrl-C
+func watchLive(conf m.Config, interval time.Duration) int {
+	state := &liveState{mutex: &sync.Mutex{}, nodes: make(map[string]*liveNode)}
+	conn, err := listen(conf, &handlers.UdpHandler{OnReport: state.add})
+	if err != nil {
+		return fail(err)
+	}
+	defer conn.Close()
+	monit := portPacket(conn, c.PrefMonitoring)
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	// без терминала таблицы просто выводятся одна за другой
+	tty := isTerminal(os.Stdout)
+	for {
+		if err := broadcast(conf, monit); err != nil {
+			return fail(err)
+		}
+
+		select {
+		case <-ticker.C:
+		case <-signals:
+			return exitOK
+		}
+
+		// таблица собирается целиком, чтобы экран не мигал при выводе
+		var buf bytes.Buffer
+		if tty {
+			buf.WriteString(clearScreen)
+		}
+		renderLive(&buf, state.snapshot(), interval, tty)
+		os.Stdout.Write(buf.Bytes())
+	}
+}
+
+func renderLive(w io.Writer, nodes []liveNode, interval time.Duration, color bool) {
+	now := time.Now()
+	stale := func(n liveNode) bool { return now.Sub(n.seen) > liveStaleRequests*interval }
+
+	// большинство считается только по отвечающим узлам
+	counts := make(map[string]int)
+	majority := ""
+	for _, n := range nodes {
+		if stale(n) {
+			continue
+		}
+		h := hex.EncodeToString(n.Msg.GetHash())
+		counts[h]++
+		if counts[h] > counts[majority] || (counts[h] == counts[majority] && h > majority) {
+			majority = h
+		}
+	}
+
+	fmt.Fprintf(w, "%v nodes, %v agree on %v, every %v, %v. Ctrl-C to quit\n\n",
+		len(nodes), counts[majority], shortHash(mustDecode(majority)), interval, now.Format("15:04:05"))
+
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	line := func(clr, format string, v ...interface{}) {
+		if color {
+			fmt.Fprint(tw, clr)
+		}
+		fmt.Fprintf(tw, format, v...)
+		if color {
+			fmt.Fprint(tw, colorReset)
+		}
+		fmt.Fprintln(tw)
+	}
+
+	line(colorNone, "NODE\tADDRESS\tMESSAGE\tPEERS\tHASHES\tQUEUE\tLAST REPORT\tSTATUS")
+	for _, n := range nodes {
+		clr, status := colorNone, "ok"
+		switch {
+		case stale(n):
+			clr, status = colorRed, "NOT RESPONDING"
+		case hex.EncodeToString(n.Msg.GetHash()) != majority:
+			clr, status = colorYellow, "DISAGREES"
+		}
+		line(clr, "%v\t%v\t%v\t%v\t%v\t%v\t%v ago\t%v",
+			orDash(n.NodeID), n.address(), shortHash(n.Msg.GetHash()), peersSummary(n.NodeReport),
+			n.Hashes, n.Queue, now.Sub(n.seen).Round(100*time.Millisecond), status)
+	}
+	tw.Flush()
+}
+
+func mustDecode(h string) []byte {
+	b, _ := hex.DecodeString(h)
+	return b
+}
+
+func isTerminal(f *os.File) bool {
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
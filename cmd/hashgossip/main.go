@@ -0,0 +1,180 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"math/rand"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/DemonVex/hashgossip/config"
+	m "github.com/DemonVex/hashgossip/models"
+	"github.com/DemonVex/hashgossip/transport"
+)
+
+// файл конфига, если не указаны ни -config, ни HASHGOSSIP_CONFIG
+const defaultConfig = "config.toml"
+
+// коды выхода одинаковы для всех команд
+const (
+	exitOK = 0
+	// конфиг не прочитан или неверен, сеть недоступна и прочие ошибки
+	exitError = 1
+	// неверные аргументы
+	exitUsage = 2
+	// check: узлы хранят разные сообщения или ответили не все
+	exitDiverged = 3
+	// check, watch, peers: ни один узел не ответил
+	exitNoAnswers = 4
+	// agent остановлен сигналом SHUTD из кластера
+	exitShutdown = 5
+)
+
+type command struct {
+	name    string
+	args    string
+	summary string
+	run     func(cli *cli, args []string) int
+}
+
+var commands = []command{
+	{"agent", "", "Run a gossip node until Ctrl-C or a kill command", runAgent},
+	{"watch", "", "Ask nodes for reports and print them as a table or JSON", runWatch},
+	{"check", "", "Compare stored messages across nodes, fail if they differ", runCheck},
+	{"kill", "", "Send shutdown signal to all nodes", runKill},
+	{"publish", "[MESSAGE]", "Publish a message (argument or stdin) to the cluster", runPublish},
+	{"peers", "", "Print peers known to every node", runPeers},
+	{"bans", "", "Print quarantined peers of local nodes", runBans},
+	{"unban", "IP", "Release peer from quarantine on local nodes", runUnban},
+	{"keygen", "", "Generate a random admin API token or node ID", runKeygen},
+	{"config", "validate", "Check the config file and HASHGOSSIP_* variables", runConfig},
+	{"version", "", "Print version", runVersion},
+}
+
+// cli - общие для всех команд флаги
+type cli struct {
+	fs        *flag.FlagSet
+	config    string
+	multicast string
+	seeds     string
+}
+
+func main() {
+	rand.Seed(time.Now().UnixNano())
+
+	if len(os.Args) < 2 || os.Args[1] == "-h" || os.Args[1] == "--help" || os.Args[1] == "help" {
+		usage(os.Stderr)
+		if len(os.Args) < 2 {
+			os.Exit(exitUsage)
+		}
+		os.Exit(exitOK)
+	}
+
+	for _, cmd := range commands {
+		if cmd.name == os.Args[1] {
+			os.Exit(cmd.run(newCLI(cmd), os.Args[2:]))
+		}
+	}
+	fmt.Fprintf(os.Stderr, "unknown command %q\n\n", os.Args[1])
+	usage(os.Stderr)
+	os.Exit(exitUsage)
+}
+
+func usage(w io.Writer) {
+	fmt.Fprintf(w, "Usage: %v COMMAND [flags]\n\nCommands:\n", os.Args[0])
+	for _, cmd := range commands {
+		fmt.Fprintf(w, "  %-10v %v\n", cmd.name, cmd.summary)
+	}
+	fmt.Fprintf(w, "\nRun '%v COMMAND -h' for command flags.\n", os.Args[0])
+}
+
+func newCLI(cmd command) *cli {
+	c := &cli{fs: flag.NewFlagSet(cmd.name, flag.ContinueOnError)}
+	c.fs.StringVar(&c.config, "config", "", "Path to the config file (default $"+config.EnvConfig+" or "+defaultConfig+" if it exists)")
+	c.fs.StringVar(&c.multicast, "multicast", "", "Multicast address, overrides MulticastAddress from the config")
+	c.fs.StringVar(&c.seeds, "seeds", "", "Comma-separated seed addresses, override Seeds from the config")
+	c.fs.Usage = func() {
+		out := c.fs.Output()
+		fmt.Fprintf(out, "Usage: %v %v [flags] %v\n\n%v\n\nFlags:\n", os.Args[0], cmd.name, cmd.args, cmd.summary)
+		c.fs.PrintDefaults()
+	}
+	return c
+}
+
+// parse разбирает флаги команды. Если команду выполнять не нужно, ok = false,
+// а code - код выхода: 0 для -h и exitUsage для ошибки
+func (c *cli) parse(args []string) (code int, ok bool) {
+	err := c.fs.Parse(args)
+	if err == flag.ErrHelp {
+		return exitOK, false
+	}
+	if err != nil {
+		return exitUsage, false
+	}
+	return exitOK, true
+}
+
+// usageError выводит ошибку в аргументах и справку команды
+func (c *cli) usageError(format string, v ...interface{}) int {
+	fmt.Fprintf(c.fs.Output(), format+"\n\n", v...)
+	c.fs.Usage()
+	return exitUsage
+}
+
+// configPath - файл конфига команды, пустой, если его нет и настройки берутся по умолчанию
+func (c *cli) configPath() string {
+	return config.Path(c.config, defaultConfig)
+}
+
+// loadConfig собирает конфиг: значения по умолчанию, файл, переменные HASHGOSSIP_*
+// и общие флаги. Ошибки всех слоёв и проверки значений выводятся вместе.
+func (c *cli) loadConfig() (m.Config, error) {
+	path := c.configPath()
+	conf, err := config.Load(path, os.Environ())
+	errs, invalid := err.(config.Errors)
+	if err != nil && !invalid {
+		return conf, err
+	}
+
+	if c.multicast != "" {
+		conf.MulticastAddress = c.multicast
+	}
+	if c.seeds != "" {
+		conf.Seeds = nil
+		for _, s := range strings.Split(c.seeds, ",") {
+			if s = strings.TrimSpace(s); s != "" {
+				conf.Seeds = append(conf.Seeds, s)
+			}
+		}
+	}
+
+	errs = append(errs, config.Validate(conf)...)
+	if len(errs) > 0 {
+		return conf, errors.New(fmt.Sprintf("invalid config %v:\n  %v", sourceName(path), strings.Join(errs, "\n  ")))
+	}
+	return conf, nil
+}
+
+func sourceName(path string) string {
+	if path == "" {
+		return "(defaults)"
+	}
+	return path
+}
+
+func mcastOptions(conf m.Config) transport.MulticastOptions {
+	return transport.MulticastOptions{
+		Interfaces: conf.MulticastInterfaces,
+		TTL:        conf.MulticastTTL,
+		Loopback:   conf.MulticastLoopback,
+	}
+}
+
+// fail выводит ошибку и возвращает exitError
+func fail(err error) int {
+	fmt.Fprintln(os.Stderr, "error:", err)
+	return exitError
+}
@@ -0,0 +1,152 @@
+package main
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"sort"
+	"sync"
+	"text/tabwriter"
+	"time"
+
+	m "github.com/DemonVex/hashgossip/models"
+)
+
+// addrReport - отчёт узла и адрес, с которого он пришёл
+type addrReport struct {
+	Addr string
+	m.NodeReport
+}
+
+// reportCollector собирает отчёты REPOR, по одному на узел
+type reportCollector struct {
+	mutex   *sync.Mutex
+	start   time.Time
+	reports map[string]addrReport
+	latency map[string]time.Duration
+}
+
+func newReportCollector() *reportCollector {
+	return &reportCollector{
+		mutex:   &sync.Mutex{},
+		start:   time.Now(),
+		reports: make(map[string]addrReport),
+		latency: make(map[string]time.Duration),
+	}
+}
+
+// add возвращает число собранных отчётов и false, если отчёт этого узла уже был.
+// Узел, найденный и через multicast, и через seed, отвечает дважды, поэтому
+// отчёты различаются по NodeID
+func (rc *reportCollector) add(src *net.UDPAddr, r m.NodeReport) (int, bool) {
+	rc.mutex.Lock()
+	defer rc.mutex.Unlock()
+
+	key := r.NodeID
+	if key == "" {
+		key = src.String()
+	}
+	if _, ok := rc.reports[key]; ok {
+		return len(rc.reports), false
+	}
+	rc.reports[key] = addrReport{Addr: src.String(), NodeReport: r}
+	rc.latency[key] = time.Since(rc.start)
+	return len(rc.reports), true
+}
+
+// untilCount возвращает обработчик отчётов и канал, который закрывается, когда
+// соберутся отчёты expect разных узлов. При expect <= 0 канал не закрывается
+func (rc *reportCollector) untilCount(expect int) (func(*net.UDPAddr, m.NodeReport), <-chan struct{}) {
+	enough := make(chan struct{})
+	return func(src *net.UDPAddr, r m.NodeReport) {
+		// повторный отчёт не меняет счёт, поэтому канал закрывается ровно один раз
+		if count, added := rc.add(src, r); added && count == expect {
+			close(enough)
+		}
+	}, enough
+}
+
+// list возвращает отчёты в порядке прихода
+func (rc *reportCollector) list() []addrReport {
+	rc.mutex.Lock()
+	defer rc.mutex.Unlock()
+
+	list := make([]addrReport, 0, len(rc.reports))
+	for _, r := range rc.reports {
+		list = append(list, r)
+	}
+	sort.Slice(list, func(i, j int) bool { return rc.latency[key(list[i])] < rc.latency[key(list[j])] })
+	return list
+}
+
+func (rc *reportCollector) latencyOf(r addrReport) time.Duration {
+	rc.mutex.Lock()
+	defer rc.mutex.Unlock()
+	return rc.latency[key(r)]
+}
+
+// address - адрес узла для таблиц. Узлы старых версий его не присылают,
+// тогда показывается адрес, с которого пришёл отчёт
+func (r addrReport) address() string {
+	if r.Address != "" {
+		return r.Address
+	}
+	return r.Addr
+}
+
+func key(r addrReport) string {
+	if r.NodeID == "" {
+		return r.Addr
+	}
+	return r.NodeID
+}
+
+func printReportsJSON(w io.Writer, reports []addrReport) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(reports)
+}
+
+func printReportsTable(w io.Writer, reports []addrReport) error {
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "NODE\tADDRESS\tVERSION\tUPTIME\tPEERS\tHASHES\tQUEUE\tIN\tOUT\tINVALID\tCONFIG\tMESSAGE")
+	for _, r := range reports {
+		fmt.Fprintf(tw, "%v\t%v\t%v\t%v\t%v\t%v\t%v\t%v\t%v\t%v\t%v\t%v\n",
+			orDash(r.NodeID), r.address(), orDash(r.Version), r.Uptime.Round(time.Second), peersSummary(r.NodeReport),
+			r.Hashes, r.Queue, r.PacketsIn, r.PacketsOut, r.Invalid, orDash(r.ConfigHash), shortHash(r.Msg.GetHash()))
+	}
+	return tw.Flush()
+}
+
+// peersSummary - живые пиры из всех известных
+func peersSummary(r m.NodeReport) string {
+	if len(r.Peers) == 0 {
+		return fmt.Sprint(r.PeerCount)
+	}
+	alive := 0
+	for _, p := range r.Peers {
+		if p.State == m.PeerAlive.String() {
+			alive++
+		}
+	}
+	return fmt.Sprintf("%v/%v", alive, r.PeerCount)
+}
+
+func shortHash(h []byte) string {
+	if len(h) == 0 {
+		return "-"
+	}
+	if len(h) > 6 {
+		h = h[:6]
+	}
+	return hex.EncodeToString(h)
+}
+
+func orDash(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
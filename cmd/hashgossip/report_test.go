@@ -0,0 +1,84 @@
+package main
+
+import (
+	"bytes"
+	"net"
+	"strings"
+	"testing"
+
+	m "github.com/DemonVex/hashgossip/models"
+)
+
+func TestReportCollectorIgnoresDuplicates(t *testing.T) {
+	rc := newReportCollector()
+	multicast := &net.UDPAddr{IP: net.ParseIP("192.0.2.1"), Port: 40001}
+	seed := &net.UDPAddr{IP: net.ParseIP("192.0.2.1"), Port: 40002}
+
+	if count, added := rc.add(multicast, m.NodeReport{NodeID: "a"}); count != 1 || !added {
+		t.Fatalf("add(a) = %v, %v, want 1, true", count, added)
+	}
+	if count, added := rc.add(seed, m.NodeReport{NodeID: "a"}); count != 1 || added {
+		t.Errorf("second add(a) = %v, %v, want 1, false", count, added)
+	}
+	// без NodeID отчёты различаются по адресу
+	rc.add(multicast, m.NodeReport{})
+	if count, added := rc.add(seed, m.NodeReport{}); count != 3 || !added {
+		t.Errorf("add from another address = %v, %v, want 3, true", count, added)
+	}
+}
+
+func TestUntilCountDuplicateAtExpectedCount(t *testing.T) {
+	rc := newReportCollector()
+	onReport, enough := rc.untilCount(2)
+	src := &net.UDPAddr{IP: net.ParseIP("192.0.2.1"), Port: 40001}
+
+	onReport(src, m.NodeReport{NodeID: "a"})
+	select {
+	case <-enough:
+		t.Fatal("closed after one report of two")
+	default:
+	}
+	onReport(src, m.NodeReport{NodeID: "b"})
+	// узел, ответивший и через multicast, и через seed, не должен закрыть канал повторно
+	onReport(src, m.NodeReport{NodeID: "b"})
+	onReport(src, m.NodeReport{NodeID: "a"})
+	select {
+	case <-enough:
+	default:
+		t.Fatal("not closed after reports of two nodes")
+	}
+	if n := len(rc.list()); n != 2 {
+		t.Errorf("collected %v reports, want 2", n)
+	}
+}
+
+func TestUntilCountWithoutExpect(t *testing.T) {
+	rc := newReportCollector()
+	onReport, enough := rc.untilCount(0)
+	onReport(&net.UDPAddr{IP: net.ParseIP("192.0.2.1"), Port: 40001}, m.NodeReport{NodeID: "a"})
+	select {
+	case <-enough:
+		t.Fatal("closed without expected count")
+	default:
+	}
+}
+
+func TestReportTableShowsAdvertisedAddress(t *testing.T) {
+	// отчёт уходит с временного порта, в таблице нужен адрес узла
+	reports := []addrReport{
+		{Addr: "192.0.2.1:51234", NodeReport: m.NodeReport{NodeID: "a", Address: "192.0.2.1:9000"}},
+		{Addr: "192.0.2.2:51235", NodeReport: m.NodeReport{NodeID: "old"}},
+	}
+	var buf bytes.Buffer
+	if err := printReportsTable(&buf, reports); err != nil {
+		t.Fatal(err)
+	}
+	out := buf.String()
+	if !strings.Contains(out, "192.0.2.1:9000") || strings.Contains(out, "51234") {
+		t.Errorf("table shows the reply port instead of the advertised address:\n%v", out)
+	}
+	// узел старой версии адрес не присылает
+	if !strings.Contains(out, "192.0.2.2:51235") {
+		t.Errorf("table lost the source address of a report without Address:\n%v", out)
+	}
+}
@@ -0,0 +1,207 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/DemonVex/hashgossip/tracing"
+)
+
+var hashFlag = flag.String("hash", "", "Hash of the message (hex, prefix is enough)")
+
+// span - участок трассы на одном узле
+type span struct {
+	id       string
+	parent   string
+	node     string
+	kind     tracing.Kind
+	from     string
+	time     time.Time
+	known    bool
+	copies   int
+	forwards int
+	children []*span
+}
+
+func main() {
+	flag.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: %v -hash HASH TRACE_FILE...\n\n", os.Args[0])
+		fmt.Fprintln(os.Stderr, "Rebuilds the propagation tree of a message from trace files written with TraceFile.")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if *hashFlag == "" || flag.NArg() == 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	var events []tracing.Event
+	for _, path := range flag.Args() {
+		f, err := os.Open(path)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		read, err := tracing.ReadEvents(f)
+		f.Close()
+		if err != nil {
+			fmt.Fprintln(os.Stderr, path, err)
+			os.Exit(1)
+		}
+		events = append(events, read...)
+	}
+
+	traces, order := groupTraces(events, *hashFlag)
+	if len(order) == 0 {
+		fmt.Fprintln(os.Stderr, "no events for message", *hashFlag)
+		os.Exit(1)
+	}
+
+	for i, id := range order {
+		if i > 0 {
+			fmt.Println()
+		}
+		printTrace(os.Stdout, id, traces[id])
+	}
+}
+
+// groupTraces отбирает события сообщения с хэшем, начинающимся на hash.
+// Одно и то же содержимое могли опубликовать дважды, у каждой публикации своя трасса,
+// order - трассы в порядке первого события
+func groupTraces(events []tracing.Event, hash string) (map[string][]tracing.Event, []string) {
+	traces := make(map[string][]tracing.Event)
+	var order []string
+	for _, e := range events {
+		if !strings.HasPrefix(e.Hash, strings.ToLower(hash)) {
+			continue
+		}
+		if _, ok := traces[e.TraceID]; !ok {
+			order = append(order, e.TraceID)
+		}
+		traces[e.TraceID] = append(traces[e.TraceID], e)
+	}
+	return traces, order
+}
+
+func printTrace(w io.Writer, traceID string, events []tracing.Event) {
+	roots := buildTree(events)
+	fmt.Fprintf(w, "trace %v message %v\n", traceID, events[0].Hash)
+	for _, r := range roots {
+		start := r.time
+		if start.IsZero() {
+			start = events[0].Time
+		}
+		printSpan(w, r, nil, start, "", "")
+	}
+}
+
+// buildTree собирает участки трассы в дерево по ссылкам на родителя и возвращает корни.
+// События сортируются по времени
+func buildTree(events []tracing.Event) []*span {
+	sort.Slice(events, func(i, j int) bool { return events[i].Time.Before(events[j].Time) })
+
+	spans := make(map[string]*span)
+	get := func(id string) *span {
+		s, ok := spans[id]
+		if !ok {
+			s = &span{id: id}
+			spans[id] = s
+		}
+		return s
+	}
+	// копии считаются на узле-получателе, а не на участке отправителя
+	copies := make(map[string]int)
+
+	for _, e := range events {
+		switch e.Kind {
+		case tracing.KindPublish, tracing.KindAccept:
+			s := get(e.SpanID)
+			s.parent, s.node, s.kind, s.from, s.time, s.known = e.ParentSpanID, e.NodeID, e.Kind, e.Peer, e.Time, true
+		case tracing.KindForward:
+			s := get(e.SpanID)
+			s.forwards++
+			// узел без publish, например демо-режим, известен по первой пересылке
+			if !s.known && s.node == "" {
+				s.node, s.time = e.NodeID, e.Time
+			}
+		case tracing.KindReceive:
+			copies[e.NodeID]++
+		}
+	}
+
+	// родители, которые сами трассу не писали, становятся пустыми участками
+	var missing []string
+	for _, s := range spans {
+		if _, ok := spans[s.parent]; s.parent != "" && !ok {
+			missing = append(missing, s.parent)
+		}
+	}
+	for _, id := range missing {
+		get(id)
+	}
+
+	var roots []*span
+	for _, s := range spans {
+		s.copies = copies[s.node]
+		if s.parent == "" {
+			roots = append(roots, s)
+		} else {
+			spans[s.parent].children = append(spans[s.parent].children, s)
+		}
+	}
+	sortSpans(roots)
+	return roots
+}
+
+func printSpan(w io.Writer, s, parent *span, start time.Time, prefix, branch string) {
+	fmt.Fprintf(w, "%v%v%v\n", prefix, branch, describe(s, parent, start))
+
+	// продолжение линий дерева под текущим участком
+	switch branch {
+	case "├── ":
+		prefix += "│   "
+	case "└── ":
+		prefix += "    "
+	}
+	sortSpans(s.children)
+	for i, c := range s.children {
+		b := "├── "
+		if i == len(s.children)-1 {
+			b = "└── "
+		}
+		printSpan(w, c, s, start, prefix, b)
+	}
+}
+
+// describe выводит время от начала трассы и длительность перехода от родителя
+func describe(s, parent *span, start time.Time) string {
+	node := s.node
+	if node == "" {
+		node = "?"
+	}
+	if s.time.IsZero() {
+		return fmt.Sprintf("%v (span %v, not traced)", node, s.id)
+	}
+
+	kind := string(s.kind)
+	if kind == "" {
+		kind = "origin"
+	}
+	line := fmt.Sprintf("%v %v at +%v", node, kind, s.time.Sub(start))
+	if parent != nil && !parent.time.IsZero() {
+		line += fmt.Sprintf(" hop %v", s.time.Sub(parent.time))
+	}
+	if s.from != "" {
+		line += " from " + s.from
+	}
+	return line + fmt.Sprintf(" (copies %v, forwards %v)", s.copies, s.forwards)
+}
+
+func sortSpans(spans []*span) {
+	sort.Slice(spans, func(i, j int) bool { return spans[i].time.Before(spans[j].time) })
+}
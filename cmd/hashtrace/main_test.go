@@ -0,0 +1,108 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/DemonVex/hashgossip/tracing"
+)
+
+// трасса сообщения abcd: a публикует и рассылает b и c, b пересылает c,
+// d принял копию от узла, который трассу не писал. Последняя строка оборвана
+const fixture = `{"time":"2024-01-01T00:00:00Z","kind":"publish","trace_id":"t1","span_id":"a1","node_id":"a","msg_hash":"abcd"}
+{"time":"2024-01-01T00:00:00.001Z","kind":"forward","trace_id":"t1","span_id":"a1","node_id":"a","msg_hash":"abcd","peer":"b:1"}
+{"time":"2024-01-01T00:00:00.001Z","kind":"forward","trace_id":"t1","span_id":"a1","node_id":"a","msg_hash":"abcd","peer":"c:1"}
+{"time":"2024-01-01T00:00:00.002Z","kind":"receive","trace_id":"t1","span_id":"a1","node_id":"b","msg_hash":"abcd","peer":"a:1"}
+{"time":"2024-01-01T00:00:00.002Z","kind":"accept","trace_id":"t1","span_id":"b1","parent_span_id":"a1","node_id":"b","msg_hash":"abcd","peer":"a:1"}
+{"time":"2024-01-01T00:00:00.003Z","kind":"receive","trace_id":"t1","span_id":"a1","node_id":"c","msg_hash":"abcd","peer":"a:1"}
+{"time":"2024-01-01T00:00:00.003Z","kind":"accept","trace_id":"t1","span_id":"c1","parent_span_id":"a1","node_id":"c","msg_hash":"abcd","peer":"a:1"}
+{"time":"2024-01-01T00:00:00.004Z","kind":"forward","trace_id":"t1","span_id":"b1","node_id":"b","msg_hash":"abcd","peer":"c:1"}
+{"time":"2024-01-01T00:00:00.005Z","kind":"receive","trace_id":"t1","span_id":"b1","node_id":"c","msg_hash":"abcd","peer":"b:1"}
+{"time":"2024-01-01T00:00:00.006Z","kind":"accept","trace_id":"t1","span_id":"d1","parent_span_id":"x9","node_id":"d","msg_hash":"abcd","peer":"x:1"}
+{"time":"2024-01-01T00:00:01Z","kind":"publish","trace_id":"t2","span_id":"a2","node_id":"a","msg_hash":"abcd"}
+{"time":"2024-01-01T00:00:01Z","kind":"publish","trace_id":"t3","span_id":"e1","node_id":"e","msg_hash":"ffff"}
+{"time":"2024-01-01T00:00:02Z","kind":"acc`
+
+func readFixture(t *testing.T) []tracing.Event {
+	t.Helper()
+	events, err := tracing.ReadEvents(strings.NewReader(fixture))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(events) != 12 {
+		t.Fatalf("read %v events, want 12 without the broken line", len(events))
+	}
+	return events
+}
+
+func TestGroupTraces(t *testing.T) {
+	traces, order := groupTraces(readFixture(t), "ABC")
+	if strings.Join(order, ",") != "t1,t2" {
+		t.Fatalf("traces %v, want t1 and t2 of message abcd", order)
+	}
+	if len(traces["t1"]) != 10 || len(traces["t2"]) != 1 {
+		t.Errorf("t1 has %v events, t2 has %v, want 10 and 1", len(traces["t1"]), len(traces["t2"]))
+	}
+}
+
+func TestBuildTree(t *testing.T) {
+	traces, _ := groupTraces(readFixture(t), "abcd")
+	roots := buildTree(traces["t1"])
+
+	byID := make(map[string]*span)
+	for _, r := range roots {
+		byID[r.id] = r
+	}
+	if len(roots) != 2 || byID["a1"] == nil || byID["x9"] == nil {
+		t.Fatalf("roots %v, want the publish a1 and the untraced parent x9", ids(roots))
+	}
+
+	a := byID["a1"]
+	if a.node != "a" || a.kind != tracing.KindPublish || a.forwards != 2 {
+		t.Errorf("a1 = %+v, want publish on a with 2 forwards", a)
+	}
+	if ids(a.children) != "b1,c1" {
+		t.Fatalf("a1 children %v, want b1,c1 in order of arrival", ids(a.children))
+	}
+	b, c := a.children[0], a.children[1]
+	if b.node != "b" || b.parent != "a1" || b.from != "a:1" || b.forwards != 1 || b.copies != 1 {
+		t.Errorf("b1 = %+v", b)
+	}
+	// c получил копию и от a, и от b
+	if c.node != "c" || c.forwards != 0 || c.copies != 2 {
+		t.Errorf("c1 = %+v, want 2 copies and no forwards", c)
+	}
+
+	x := byID["x9"]
+	if !x.time.IsZero() || ids(x.children) != "d1" || x.children[0].node != "d" {
+		t.Errorf("x9 = %+v children %v, want an untraced span with d1", x, ids(x.children))
+	}
+}
+
+func TestPrintTrace(t *testing.T) {
+	traces, _ := groupTraces(readFixture(t), "abcd")
+	var buf bytes.Buffer
+	printTrace(&buf, "t1", traces["t1"])
+
+	for _, want := range []string{
+		"trace t1 message abcd\n",
+		"a publish at +0s (copies 0, forwards 2)\n",
+		"├── b accept at +2ms hop 2ms from a:1 (copies 1, forwards 1)\n",
+		"└── c accept at +3ms hop 3ms from a:1 (copies 2, forwards 0)\n",
+		"? (span x9, not traced)\n",
+		"└── d accept at +6ms from x:1 (copies 0, forwards 0)\n",
+	} {
+		if !strings.Contains(buf.String(), want) {
+			t.Errorf("output does not contain %q:\n%v", want, buf.String())
+		}
+	}
+}
+
+func ids(spans []*span) string {
+	var list []string
+	for _, s := range spans {
+		list = append(list, s.id)
+	}
+	return strings.Join(list, ",")
+}
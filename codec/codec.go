@@ -0,0 +1,84 @@
+package codec
+
+import (
+	"encoding/json"
+
+	"github.com/vmihailenco/msgpack"
+)
+
+// идентификаторы кодеков в байте флагов заголовка пакета
+const (
+	DefaultID  byte = 0
+	MsgpackID  byte = 1
+	ProtobufID byte = 2
+	JSONID     byte = 3
+)
+
+type Codec interface {
+	ID() byte
+	Name() string
+	Marshal(v interface{}) ([]byte, error)
+	Unmarshal(data []byte, v interface{}) error
+}
+
+var (
+	Msgpack  Codec = msgpackCodec{}
+	Protobuf Codec = protobufCodec{}
+	JSON     Codec = jsonCodec{}
+)
+
+var codecs = []Codec{Msgpack, Protobuf, JSON}
+
+func ByID(id byte) (Codec, bool) {
+	for _, cd := range codecs {
+		if cd.ID() == id {
+			return cd, true
+		}
+	}
+	return nil, false
+}
+
+func ByName(name string) (Codec, bool) {
+	for _, cd := range codecs {
+		if cd.Name() == name {
+			return cd, true
+		}
+	}
+	return nil, false
+}
+
+type msgpackCodec struct{}
+
+func (msgpackCodec) ID() byte {
+	return MsgpackID
+}
+
+func (msgpackCodec) Name() string {
+	return "msgpack"
+}
+
+func (msgpackCodec) Marshal(v interface{}) ([]byte, error) {
+	return msgpack.Marshal(v)
+}
+
+func (msgpackCodec) Unmarshal(data []byte, v interface{}) error {
+	return msgpack.Unmarshal(data, v)
+}
+
+type jsonCodec struct{}
+
+func (jsonCodec) ID() byte {
+	return JSONID
+}
+
+func (jsonCodec) Name() string {
+	return "json"
+}
+
+func (jsonCodec) Marshal(v interface{}) ([]byte, error) {
+	return json.Marshal(v)
+}
+
+func (jsonCodec) Unmarshal(data []byte, v interface{}) error {
+	return json.Unmarshal(data, v)
+}
@@ -0,0 +1,156 @@
+package codec
+
+import (
+	"net"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/DemonVex/hashgossip/models"
+)
+
+func testMessage() models.Message {
+	return models.Message{
+		Payload:  []byte("payload"),
+		Checksum: []byte{1, 2, 3, 4},
+		Created:  time.Date(2026, 10, 19, 12, 0, 0, 0, time.UTC).UnixNano(),
+		TraceID:  []byte{9, 9, 9},
+		SpanID:   []byte{8, 8},
+	}
+}
+
+func testPeers() []models.Peer {
+	return []models.Peer{
+		{IP: net.ParseIP("192.0.2.1"), Port: 7946, ID: "a"},
+		{IP: net.ParseIP("2001:db8::1"), Port: 7947},
+		{IP: net.ParseIP("fe80::1"), Port: 7948, Zone: "eth0", ID: "c"},
+	}
+}
+
+func samePeer(a, b models.Peer) bool {
+	return a.IP.Equal(b.IP) && a.Port == b.Port && a.Zone == b.Zone && a.ID == b.ID
+}
+
+func TestRoundTrip(t *testing.T) {
+	for _, cd := range codecs {
+		t.Run(cd.Name(), func(t *testing.T) {
+			var msg models.Message
+			roundTrip(t, cd, testMessage(), &msg)
+			if !reflect.DeepEqual(msg, testMessage()) {
+				t.Errorf("Message = %+v, want %+v", msg, testMessage())
+			}
+
+			for _, p := range testPeers() {
+				var got models.Peer
+				roundTrip(t, cd, p, &got)
+				if !samePeer(got, p) {
+					t.Errorf("Peer = %v, want %v", got, p)
+				}
+			}
+
+			var wp models.WelcomePack
+			roundTrip(t, cd, models.WelcomePack{PeerList: testPeers(), Msg: testMessage()}, &wp)
+			if !reflect.DeepEqual(wp.Msg, testMessage()) || len(wp.PeerList) != len(testPeers()) {
+				t.Fatalf("WelcomePack = %+v", wp)
+			}
+			for i, p := range testPeers() {
+				if !samePeer(wp.PeerList[i], p) {
+					t.Errorf("WelcomePack.PeerList[%v] = %v, want %v", i, wp.PeerList[i], p)
+				}
+			}
+
+			report := models.NodeReport{
+				NodeID:     "node",
+				Version:    "v1",
+				Uptime:     time.Minute,
+				Msg:        testMessage(),
+				Peers:      []models.PeerReport{{Address: "192.0.2.1:7946", ID: "a", State: "alive", Silence: time.Second}},
+				PeerCount:  1,
+				Hashes:     2,
+				Queue:      3,
+				PacketsIn:  4,
+				PacketsOut: 5,
+				Invalid:    6,
+				ConfigHash: "abc",
+				Address:    "192.0.2.2:7946",
+			}
+			var gotReport models.NodeReport
+			roundTrip(t, cd, report, &gotReport)
+			if !reflect.DeepEqual(gotReport, report) {
+				t.Errorf("NodeReport = %+v, want %+v", gotReport, report)
+			}
+
+			var ip string
+			roundTrip(t, cd, "192.0.2.1", &ip)
+			if ip != "192.0.2.1" {
+				t.Errorf("UNBAN body = %q, want 192.0.2.1", ip)
+			}
+
+			until := time.Date(2026, 10, 19, 12, 5, 0, 123, time.UTC)
+			bans := []models.Ban{
+				{IP: net.ParseIP("192.0.2.1"), Reason: "invalid", Until: until},
+				{IP: net.ParseIP("2001:db8::1"), Reason: "rate limit", Until: until.Add(time.Minute)},
+			}
+			var gotBans []models.Ban
+			roundTrip(t, cd, bans, &gotBans)
+			if len(gotBans) != len(bans) {
+				t.Fatalf("BANRP body = %+v, want %+v", gotBans, bans)
+			}
+			for i, b := range bans {
+				g := gotBans[i]
+				if !g.IP.Equal(b.IP) || g.Reason != b.Reason || !g.Until.Equal(b.Until) {
+					t.Errorf("ban %v = %+v, want %+v", i, g, b)
+				}
+			}
+		})
+	}
+}
+
+func TestProtobufEmptyBanList(t *testing.T) {
+	data, err := Protobuf.Marshal([]models.Ban{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	bans := []models.Ban{{Reason: "stale"}}
+	if err := Protobuf.Unmarshal(data, &bans); err != nil {
+		t.Fatal(err)
+	}
+	if len(bans) != 0 {
+		t.Errorf("bans = %+v, want empty", bans)
+	}
+}
+
+func TestProtobufUnsupportedType(t *testing.T) {
+	if _, err := Protobuf.Marshal(42); err == nil {
+		t.Error("Marshal(int) succeeded, want error")
+	}
+	var v struct{ A int }
+	if err := Protobuf.Unmarshal(nil, &v); err == nil {
+		t.Error("Unmarshal(*struct) succeeded, want error")
+	}
+}
+
+func TestByIDAndName(t *testing.T) {
+	for _, cd := range codecs {
+		if got, ok := ByID(cd.ID()); !ok || got != cd {
+			t.Errorf("ByID(%v) = %v, %v", cd.ID(), got, ok)
+		}
+		if got, ok := ByName(cd.Name()); !ok || got != cd {
+			t.Errorf("ByName(%q) = %v, %v", cd.Name(), got, ok)
+		}
+	}
+	if _, ok := ByID(DefaultID); ok {
+		t.Error("ByID(DefaultID) found a codec, the default is chosen per packet type")
+	}
+}
+
+func roundTrip(t *testing.T, cd Codec, v, out interface{}) {
+	t.Helper()
+	data, err := cd.Marshal(v)
+	if err != nil {
+		t.Fatalf("Marshal(%T): %v", v, err)
+	}
+	if err := cd.Unmarshal(data, out); err != nil {
+		t.Fatalf("Unmarshal(%T): %v", out, err)
+	}
+}
@@ -0,0 +1,5 @@
+// Package pb - типы кодека protobuf, сгенерированные из hashgossip.proto.
+// Нужны protoc и protoc-gen-go v1.0.0, той же версии, что github.com/golang/protobuf в vendor.
+package pb
+
+//go:generate protoc --go_out=. hashgossip.proto
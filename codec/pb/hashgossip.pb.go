@@ -0,0 +1,419 @@
+// Code generated by protoc-gen-go. DO NOT EDIT.
+// source: hashgossip.proto
+
+/*
+Package pb is a generated protocol buffer package.
+
+It is generated from these files:
+
+	hashgossip.proto
+
+It has these top-level messages:
+
+	Message
+	Peer
+	WelcomePack
+	PeerReport
+	NodeReport
+	Unban
+	Ban
+	BanList
+*/
+package pb
+
+import proto "github.com/golang/protobuf/proto"
+import fmt "fmt"
+import math "math"
+
+// Reference imports to suppress errors if they are not otherwise used.
+var _ = proto.Marshal
+var _ = fmt.Errorf
+var _ = math.Inf
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the proto package it is being compiled against.
+// A compilation error at this line likely means your copy of the
+// proto package needs to be updated.
+const _ = proto.ProtoPackageIsVersion2 // please upgrade the proto package
+
+type Message struct {
+	Payload  []byte `protobuf:"bytes,1,opt,name=payload,proto3" json:"payload,omitempty"`
+	Checksum []byte `protobuf:"bytes,2,opt,name=checksum,proto3" json:"checksum,omitempty"`
+	Created  int64  `protobuf:"varint,3,opt,name=created" json:"created,omitempty"`
+	TraceId  []byte `protobuf:"bytes,4,opt,name=trace_id,json=traceId,proto3" json:"trace_id,omitempty"`
+	SpanId   []byte `protobuf:"bytes,5,opt,name=span_id,json=spanId,proto3" json:"span_id,omitempty"`
+}
+
+func (m *Message) Reset()                    { *m = Message{} }
+func (m *Message) String() string            { return proto.CompactTextString(m) }
+func (*Message) ProtoMessage()               {}
+func (*Message) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{0} }
+
+func (m *Message) GetPayload() []byte {
+	if m != nil {
+		return m.Payload
+	}
+	return nil
+}
+
+func (m *Message) GetChecksum() []byte {
+	if m != nil {
+		return m.Checksum
+	}
+	return nil
+}
+
+func (m *Message) GetCreated() int64 {
+	if m != nil {
+		return m.Created
+	}
+	return 0
+}
+
+func (m *Message) GetTraceId() []byte {
+	if m != nil {
+		return m.TraceId
+	}
+	return nil
+}
+
+func (m *Message) GetSpanId() []byte {
+	if m != nil {
+		return m.SpanId
+	}
+	return nil
+}
+
+type Peer struct {
+	Ip   []byte `protobuf:"bytes,1,opt,name=ip,proto3" json:"ip,omitempty"`
+	Port uint32 `protobuf:"varint,2,opt,name=port" json:"port,omitempty"`
+	Zone string `protobuf:"bytes,3,opt,name=zone" json:"zone,omitempty"`
+	Id   string `protobuf:"bytes,4,opt,name=id" json:"id,omitempty"`
+}
+
+func (m *Peer) Reset()                    { *m = Peer{} }
+func (m *Peer) String() string            { return proto.CompactTextString(m) }
+func (*Peer) ProtoMessage()               {}
+func (*Peer) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{1} }
+
+func (m *Peer) GetIp() []byte {
+	if m != nil {
+		return m.Ip
+	}
+	return nil
+}
+
+func (m *Peer) GetPort() uint32 {
+	if m != nil {
+		return m.Port
+	}
+	return 0
+}
+
+func (m *Peer) GetZone() string {
+	if m != nil {
+		return m.Zone
+	}
+	return ""
+}
+
+func (m *Peer) GetId() string {
+	if m != nil {
+		return m.Id
+	}
+	return ""
+}
+
+type WelcomePack struct {
+	PeerList []*Peer  `protobuf:"bytes,1,rep,name=peer_list,json=peerList" json:"peer_list,omitempty"`
+	Msg      *Message `protobuf:"bytes,2,opt,name=msg" json:"msg,omitempty"`
+}
+
+func (m *WelcomePack) Reset()                    { *m = WelcomePack{} }
+func (m *WelcomePack) String() string            { return proto.CompactTextString(m) }
+func (*WelcomePack) ProtoMessage()               {}
+func (*WelcomePack) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{2} }
+
+func (m *WelcomePack) GetPeerList() []*Peer {
+	if m != nil {
+		return m.PeerList
+	}
+	return nil
+}
+
+func (m *WelcomePack) GetMsg() *Message {
+	if m != nil {
+		return m.Msg
+	}
+	return nil
+}
+
+type PeerReport struct {
+	Address string `protobuf:"bytes,1,opt,name=address" json:"address,omitempty"`
+	Id      string `protobuf:"bytes,2,opt,name=id" json:"id,omitempty"`
+	State   string `protobuf:"bytes,3,opt,name=state" json:"state,omitempty"`
+	Silence int64  `protobuf:"varint,4,opt,name=silence" json:"silence,omitempty"`
+}
+
+func (m *PeerReport) Reset()                    { *m = PeerReport{} }
+func (m *PeerReport) String() string            { return proto.CompactTextString(m) }
+func (*PeerReport) ProtoMessage()               {}
+func (*PeerReport) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{3} }
+
+func (m *PeerReport) GetAddress() string {
+	if m != nil {
+		return m.Address
+	}
+	return ""
+}
+
+func (m *PeerReport) GetId() string {
+	if m != nil {
+		return m.Id
+	}
+	return ""
+}
+
+func (m *PeerReport) GetState() string {
+	if m != nil {
+		return m.State
+	}
+	return ""
+}
+
+func (m *PeerReport) GetSilence() int64 {
+	if m != nil {
+		return m.Silence
+	}
+	return 0
+}
+
+type NodeReport struct {
+	NodeId     string        `protobuf:"bytes,1,opt,name=node_id,json=nodeId" json:"node_id,omitempty"`
+	Version    string        `protobuf:"bytes,2,opt,name=version" json:"version,omitempty"`
+	Uptime     int64         `protobuf:"varint,3,opt,name=uptime" json:"uptime,omitempty"`
+	Msg        *Message      `protobuf:"bytes,4,opt,name=msg" json:"msg,omitempty"`
+	Peers      []*PeerReport `protobuf:"bytes,5,rep,name=peers" json:"peers,omitempty"`
+	PeerCount  int64         `protobuf:"varint,6,opt,name=peer_count,json=peerCount" json:"peer_count,omitempty"`
+	Hashes     int64         `protobuf:"varint,7,opt,name=hashes" json:"hashes,omitempty"`
+	Queue      int64         `protobuf:"varint,8,opt,name=queue" json:"queue,omitempty"`
+	PacketsIn  uint64        `protobuf:"varint,9,opt,name=packets_in,json=packetsIn" json:"packets_in,omitempty"`
+	PacketsOut uint64        `protobuf:"varint,10,opt,name=packets_out,json=packetsOut" json:"packets_out,omitempty"`
+	Invalid    uint64        `protobuf:"varint,11,opt,name=invalid" json:"invalid,omitempty"`
+	ConfigHash string        `protobuf:"bytes,12,opt,name=config_hash,json=configHash" json:"config_hash,omitempty"`
+	Address    string        `protobuf:"bytes,13,opt,name=address" json:"address,omitempty"`
+}
+
+func (m *NodeReport) Reset()                    { *m = NodeReport{} }
+func (m *NodeReport) String() string            { return proto.CompactTextString(m) }
+func (*NodeReport) ProtoMessage()               {}
+func (*NodeReport) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{4} }
+
+func (m *NodeReport) GetNodeId() string {
+	if m != nil {
+		return m.NodeId
+	}
+	return ""
+}
+
+func (m *NodeReport) GetVersion() string {
+	if m != nil {
+		return m.Version
+	}
+	return ""
+}
+
+func (m *NodeReport) GetUptime() int64 {
+	if m != nil {
+		return m.Uptime
+	}
+	return 0
+}
+
+func (m *NodeReport) GetMsg() *Message {
+	if m != nil {
+		return m.Msg
+	}
+	return nil
+}
+
+func (m *NodeReport) GetPeers() []*PeerReport {
+	if m != nil {
+		return m.Peers
+	}
+	return nil
+}
+
+func (m *NodeReport) GetPeerCount() int64 {
+	if m != nil {
+		return m.PeerCount
+	}
+	return 0
+}
+
+func (m *NodeReport) GetHashes() int64 {
+	if m != nil {
+		return m.Hashes
+	}
+	return 0
+}
+
+func (m *NodeReport) GetQueue() int64 {
+	if m != nil {
+		return m.Queue
+	}
+	return 0
+}
+
+func (m *NodeReport) GetPacketsIn() uint64 {
+	if m != nil {
+		return m.PacketsIn
+	}
+	return 0
+}
+
+func (m *NodeReport) GetPacketsOut() uint64 {
+	if m != nil {
+		return m.PacketsOut
+	}
+	return 0
+}
+
+func (m *NodeReport) GetInvalid() uint64 {
+	if m != nil {
+		return m.Invalid
+	}
+	return 0
+}
+
+func (m *NodeReport) GetConfigHash() string {
+	if m != nil {
+		return m.ConfigHash
+	}
+	return ""
+}
+
+func (m *NodeReport) GetAddress() string {
+	if m != nil {
+		return m.Address
+	}
+	return ""
+}
+
+// тело UNBAN - IP, который нужно выпустить из карантина
+type Unban struct {
+	Ip string `protobuf:"bytes,1,opt,name=ip" json:"ip,omitempty"`
+}
+
+func (m *Unban) Reset()                    { *m = Unban{} }
+func (m *Unban) String() string            { return proto.CompactTextString(m) }
+func (*Unban) ProtoMessage()               {}
+func (*Unban) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{5} }
+
+func (m *Unban) GetIp() string {
+	if m != nil {
+		return m.Ip
+	}
+	return ""
+}
+
+type Ban struct {
+	Ip     []byte `protobuf:"bytes,1,opt,name=ip,proto3" json:"ip,omitempty"`
+	Reason string `protobuf:"bytes,2,opt,name=reason" json:"reason,omitempty"`
+	// unix время в наносекундах
+	Until int64 `protobuf:"varint,3,opt,name=until" json:"until,omitempty"`
+}
+
+func (m *Ban) Reset()                    { *m = Ban{} }
+func (m *Ban) String() string            { return proto.CompactTextString(m) }
+func (*Ban) ProtoMessage()               {}
+func (*Ban) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{6} }
+
+func (m *Ban) GetIp() []byte {
+	if m != nil {
+		return m.Ip
+	}
+	return nil
+}
+
+func (m *Ban) GetReason() string {
+	if m != nil {
+		return m.Reason
+	}
+	return ""
+}
+
+func (m *Ban) GetUntil() int64 {
+	if m != nil {
+		return m.Until
+	}
+	return 0
+}
+
+// тело BANRP - все адреса в карантине
+type BanList struct {
+	Bans []*Ban `protobuf:"bytes,1,rep,name=bans" json:"bans,omitempty"`
+}
+
+func (m *BanList) Reset()                    { *m = BanList{} }
+func (m *BanList) String() string            { return proto.CompactTextString(m) }
+func (*BanList) ProtoMessage()               {}
+func (*BanList) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{7} }
+
+func (m *BanList) GetBans() []*Ban {
+	if m != nil {
+		return m.Bans
+	}
+	return nil
+}
+
+func init() {
+	proto.RegisterType((*Message)(nil), "hashgossip.Message")
+	proto.RegisterType((*Peer)(nil), "hashgossip.Peer")
+	proto.RegisterType((*WelcomePack)(nil), "hashgossip.WelcomePack")
+	proto.RegisterType((*PeerReport)(nil), "hashgossip.PeerReport")
+	proto.RegisterType((*NodeReport)(nil), "hashgossip.NodeReport")
+	proto.RegisterType((*Unban)(nil), "hashgossip.Unban")
+	proto.RegisterType((*Ban)(nil), "hashgossip.Ban")
+	proto.RegisterType((*BanList)(nil), "hashgossip.BanList")
+}
+
+func init() { proto.RegisterFile("hashgossip.proto", fileDescriptor0) }
+
+var fileDescriptor0 = []byte{
+	// 542 bytes of a gzipped FileDescriptorProto
+	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0x7c, 0x53, 0x5f, 0x6f, 0xd3, 0x3e,
+	0x14, 0x55, 0xfe, 0x34, 0x69, 0x6e, 0xb7, 0xdf, 0x6f, 0x32, 0x68, 0x33, 0x48, 0x88, 0x2a, 0x08,
+	0xa9, 0x0f, 0xb0, 0x87, 0xf1, 0x0d, 0xba, 0x17, 0x2a, 0xc1, 0x98, 0x2c, 0x21, 0x24, 0x5e, 0x2a,
+	0x37, 0xbe, 0x6b, 0xad, 0xa6, 0x76, 0x88, 0x9d, 0x49, 0xf0, 0x1d, 0xe0, 0x33, 0x23, 0xdf, 0x24,
+	0xa3, 0x68, 0x12, 0x6f, 0x39, 0xf7, 0xf8, 0xfa, 0x9c, 0x7b, 0xae, 0x03, 0x67, 0x3b, 0xe9, 0x76,
+	0x5b, 0xeb, 0x9c, 0x6e, 0x2e, 0x9b, 0xd6, 0x7a, 0xcb, 0xe0, 0x4f, 0xa5, 0xfc, 0x19, 0x41, 0xfe,
+	0x11, 0x9d, 0x93, 0x5b, 0x64, 0x1c, 0xf2, 0x46, 0x7e, 0xaf, 0xad, 0x54, 0x3c, 0x9a, 0x47, 0x8b,
+	0x13, 0x31, 0x42, 0xf6, 0x1c, 0xa6, 0xd5, 0x0e, 0xab, 0xbd, 0xeb, 0x0e, 0x3c, 0x26, 0xea, 0x01,
+	0x87, 0xae, 0xaa, 0x45, 0xe9, 0x51, 0xf1, 0x64, 0x1e, 0x2d, 0x12, 0x31, 0x42, 0xf6, 0x0c, 0xa6,
+	0xbe, 0x95, 0x15, 0xae, 0xb5, 0xe2, 0x69, 0x7f, 0x21, 0xe1, 0x95, 0x62, 0x17, 0x90, 0xbb, 0x46,
+	0x9a, 0xc0, 0x4c, 0x88, 0xc9, 0x02, 0x5c, 0xa9, 0xf2, 0x06, 0xd2, 0x5b, 0xc4, 0x96, 0xfd, 0x07,
+	0xb1, 0x6e, 0x06, 0x1b, 0xb1, 0x6e, 0x18, 0x83, 0xb4, 0xb1, 0xad, 0x27, 0xf5, 0x53, 0x41, 0xdf,
+	0xa1, 0xf6, 0xc3, 0x1a, 0x24, 0xd9, 0x42, 0xd0, 0x37, 0xf5, 0xf5, 0x6a, 0x85, 0x88, 0xb5, 0x2a,
+	0x2b, 0x98, 0x7d, 0xc1, 0xba, 0xb2, 0x07, 0xbc, 0x95, 0xd5, 0x9e, 0xbd, 0x85, 0xa2, 0x41, 0x6c,
+	0xd7, 0xb5, 0x76, 0x9e, 0x47, 0xf3, 0x64, 0x31, 0xbb, 0x3a, 0xbb, 0x3c, 0x0a, 0x28, 0x68, 0x8b,
+	0x69, 0x38, 0xf2, 0x41, 0x3b, 0xcf, 0x5e, 0x43, 0x72, 0x70, 0x5b, 0x12, 0x9d, 0x5d, 0x3d, 0x39,
+	0x3e, 0x38, 0x64, 0x26, 0x02, 0x5f, 0xde, 0x01, 0x50, 0x23, 0x92, 0x2d, 0x0e, 0xb9, 0x54, 0xaa,
+	0x45, 0xe7, 0xc8, 0x7f, 0x21, 0x46, 0x38, 0x98, 0x8b, 0x47, 0x73, 0xec, 0x29, 0x4c, 0x9c, 0x97,
+	0x7e, 0x9c, 0xa0, 0x07, 0xa1, 0xdf, 0xe9, 0x1a, 0x4d, 0x85, 0x34, 0x47, 0x22, 0x46, 0x58, 0xfe,
+	0x4a, 0x00, 0x6e, 0xac, 0xc2, 0x41, 0xe8, 0x02, 0x72, 0x63, 0x15, 0xc5, 0xdb, 0x0b, 0x65, 0x01,
+	0xae, 0x54, 0xb8, 0xe1, 0x1e, 0x5b, 0xa7, 0xad, 0x19, 0xc4, 0x46, 0xc8, 0xce, 0x21, 0xeb, 0x1a,
+	0xaf, 0x0f, 0x38, 0xec, 0x6a, 0x40, 0xe3, 0xa0, 0xe9, 0xbf, 0x07, 0x65, 0x6f, 0x60, 0x12, 0xb2,
+	0x71, 0x7c, 0x42, 0xd1, 0x9d, 0x3f, 0x8a, 0x8e, 0x8c, 0x89, 0xfe, 0x10, 0x7b, 0x01, 0x40, 0x61,
+	0x57, 0xb6, 0x33, 0x9e, 0x67, 0x24, 0x48, 0xf1, 0x5f, 0x87, 0x42, 0xf0, 0x12, 0xda, 0xd1, 0xf1,
+	0xbc, 0xf7, 0xd2, 0xa3, 0x90, 0xca, 0xb7, 0x0e, 0x3b, 0xe4, 0x53, 0x2a, 0xf7, 0x80, 0x2e, 0x93,
+	0xd5, 0x1e, 0xbd, 0x5b, 0x6b, 0xc3, 0x8b, 0x79, 0xb4, 0x48, 0x45, 0x31, 0x54, 0x56, 0x86, 0xbd,
+	0x84, 0xd9, 0x48, 0xdb, 0xce, 0x73, 0x20, 0x7e, 0xec, 0xf8, 0xd4, 0xd1, 0x56, 0xb4, 0xb9, 0x97,
+	0xb5, 0x56, 0x7c, 0x46, 0xe4, 0x08, 0x43, 0x6b, 0x65, 0xcd, 0x9d, 0xde, 0xae, 0x83, 0x01, 0x7e,
+	0x42, 0x89, 0x41, 0x5f, 0x7a, 0x2f, 0xdd, 0xee, 0x78, 0xa1, 0xa7, 0x7f, 0x2d, 0xb4, 0xbc, 0x80,
+	0xc9, 0x67, 0xb3, 0x91, 0xe6, 0xe8, 0xb9, 0x86, 0xcd, 0x36, 0xe5, 0x35, 0x24, 0x4b, 0x69, 0x1e,
+	0xbd, 0xe2, 0x73, 0xc8, 0x5a, 0x94, 0xee, 0x61, 0x2f, 0x03, 0x0a, 0x23, 0x77, 0xc6, 0xeb, 0x7a,
+	0xd8, 0x4a, 0x0f, 0xca, 0x4b, 0xc8, 0x97, 0xd2, 0xd0, 0x43, 0x7c, 0x05, 0xe9, 0x46, 0x1a, 0x37,
+	0x3c, 0xd9, 0xff, 0x8f, 0x73, 0x5f, 0x4a, 0x23, 0x88, 0x5c, 0xa6, 0x5f, 0xe3, 0x66, 0xb3, 0xc9,
+	0xe8, 0x27, 0x7f, 0xf7, 0x7b, 0x00, 0x8a, 0xde, 0x7d, 0x29, 0xf8, 0x03, 0x00, 0x00,
+}
@@ -0,0 +1,190 @@
+package codec
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+
+	"github.com/DemonVex/hashgossip/codec/pb"
+	"github.com/DemonVex/hashgossip/models"
+)
+
+var ErrUnsupportedType = errors.New("type is not supported by protobuf codec")
+
+// protobufCodec кодирует proto.Message напрямую, а модели узла
+// переводит в типы из codec/pb
+type protobufCodec struct{}
+
+func (protobufCodec) ID() byte {
+	return ProtobufID
+}
+
+func (protobufCodec) Name() string {
+	return "protobuf"
+}
+
+func (protobufCodec) Marshal(v interface{}) ([]byte, error) {
+	switch t := v.(type) {
+	case proto.Message:
+		return proto.Marshal(t)
+	case models.Message:
+		return proto.Marshal(messageToPb(t))
+	case models.Peer:
+		return proto.Marshal(peerToPb(t))
+	case models.WelcomePack:
+		wp := &pb.WelcomePack{Msg: messageToPb(t.Msg)}
+		for _, p := range t.PeerList {
+			wp.PeerList = append(wp.PeerList, peerToPb(p))
+		}
+		return proto.Marshal(wp)
+	case models.NodeReport:
+		return proto.Marshal(reportToPb(t))
+	case string:
+		// строка в протоколе только одна - IP в теле UNBAN
+		return proto.Marshal(&pb.Unban{Ip: t})
+	case []models.Ban:
+		bl := &pb.BanList{}
+		for _, b := range t {
+			bl.Bans = append(bl.Bans, banToPb(b))
+		}
+		return proto.Marshal(bl)
+	}
+	return nil, errors.New(fmt.Sprintf("%v: %T", ErrUnsupportedType, v))
+}
+
+func (protobufCodec) Unmarshal(data []byte, v interface{}) error {
+	switch t := v.(type) {
+	case proto.Message:
+		return proto.Unmarshal(data, t)
+	case *models.Message:
+		var m pb.Message
+		if err := proto.Unmarshal(data, &m); err != nil {
+			return err
+		}
+		*t = messageFromPb(&m)
+		return nil
+	case *models.Peer:
+		var p pb.Peer
+		if err := proto.Unmarshal(data, &p); err != nil {
+			return err
+		}
+		*t = peerFromPb(&p)
+		return nil
+	case *models.WelcomePack:
+		var wp pb.WelcomePack
+		if err := proto.Unmarshal(data, &wp); err != nil {
+			return err
+		}
+		t.Msg = messageFromPb(wp.Msg)
+		t.PeerList = t.PeerList[:0]
+		for _, p := range wp.PeerList {
+			t.PeerList = append(t.PeerList, peerFromPb(p))
+		}
+		return nil
+	case *models.NodeReport:
+		var r pb.NodeReport
+		if err := proto.Unmarshal(data, &r); err != nil {
+			return err
+		}
+		*t = reportFromPb(&r)
+		return nil
+	case *string:
+		var u pb.Unban
+		if err := proto.Unmarshal(data, &u); err != nil {
+			return err
+		}
+		*t = u.Ip
+		return nil
+	case *[]models.Ban:
+		var bl pb.BanList
+		if err := proto.Unmarshal(data, &bl); err != nil {
+			return err
+		}
+		*t = (*t)[:0]
+		for _, b := range bl.Bans {
+			*t = append(*t, banFromPb(b))
+		}
+		return nil
+	}
+	return errors.New(fmt.Sprintf("%v: %T", ErrUnsupportedType, v))
+}
+
+func messageToPb(m models.Message) *pb.Message {
+	return &pb.Message{Payload: m.Payload, Checksum: m.Checksum, Created: m.Created, TraceId: m.TraceID, SpanId: m.SpanID}
+}
+
+func messageFromPb(m *pb.Message) models.Message {
+	if m == nil {
+		return models.Message{}
+	}
+	return models.Message{Payload: m.Payload, Checksum: m.Checksum, Created: m.Created, TraceID: m.TraceId, SpanID: m.SpanId}
+}
+
+func reportToPb(r models.NodeReport) *pb.NodeReport {
+	out := &pb.NodeReport{
+		NodeId:     r.NodeID,
+		Version:    r.Version,
+		Uptime:     int64(r.Uptime),
+		Msg:        messageToPb(r.Msg),
+		PeerCount:  int64(r.PeerCount),
+		Hashes:     int64(r.Hashes),
+		Queue:      int64(r.Queue),
+		PacketsIn:  r.PacketsIn,
+		PacketsOut: r.PacketsOut,
+		Invalid:    r.Invalid,
+		ConfigHash: r.ConfigHash,
+		Address:    r.Address,
+	}
+	for _, p := range r.Peers {
+		out.Peers = append(out.Peers, &pb.PeerReport{Address: p.Address, Id: p.ID, State: p.State, Silence: int64(p.Silence)})
+	}
+	return out
+}
+
+func reportFromPb(r *pb.NodeReport) models.NodeReport {
+	out := models.NodeReport{
+		NodeID:     r.NodeId,
+		Version:    r.Version,
+		Uptime:     time.Duration(r.Uptime),
+		Msg:        messageFromPb(r.Msg),
+		PeerCount:  int(r.PeerCount),
+		Hashes:     int(r.Hashes),
+		Queue:      int(r.Queue),
+		PacketsIn:  r.PacketsIn,
+		PacketsOut: r.PacketsOut,
+		Invalid:    r.Invalid,
+		ConfigHash: r.ConfigHash,
+		Address:    r.Address,
+	}
+	for _, p := range r.Peers {
+		out.Peers = append(out.Peers, models.PeerReport{Address: p.Address, ID: p.Id, State: p.State, Silence: time.Duration(p.Silence)})
+	}
+	return out
+}
+
+func banToPb(b models.Ban) *pb.Ban {
+	ip := b.IP
+	if ip4 := ip.To4(); ip4 != nil {
+		ip = ip4
+	}
+	return &pb.Ban{Ip: ip, Reason: b.Reason, Until: b.Until.UnixNano()}
+}
+
+func banFromPb(b *pb.Ban) models.Ban {
+	return models.Ban{IP: net.IP(b.Ip), Reason: b.Reason, Until: time.Unix(0, b.Until)}
+}
+
+func peerToPb(p models.Peer) *pb.Peer {
+	ip := p.IP
+	if ip4 := ip.To4(); ip4 != nil {
+		ip = ip4
+	}
+	return &pb.Peer{Ip: ip, Port: uint32(p.Port), Zone: p.Zone, Id: p.ID}
+}
+
+func peerFromPb(p *pb.Peer) models.Peer {
+	return models.Peer{IP: net.IP(p.Ip), Port: uint16(p.Port), Zone: p.Zone, ID: p.Id}
+}
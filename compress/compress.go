@@ -0,0 +1,135 @@
+package compress
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+)
+
+type Algorithm byte
+
+const (
+	None Algorithm = iota
+	Flate
+	Gzip
+	Fast
+)
+
+func (a Algorithm) String() string {
+	switch a {
+	case None:
+		return "none"
+	case Flate:
+		return "flate"
+	case Gzip:
+		return "gzip"
+	case Fast:
+		return "fast"
+	}
+	return fmt.Sprintf("unknown(%d)", byte(a))
+}
+
+// ограничение на распакованный размер, чтобы маленький пакет не раздулся в гигабайты
+const MaxDecompressedSize = 1 << 20
+
+var ErrTooLarge = errors.New(fmt.Sprintf("decompressed body is larger than %v bytes", MaxDecompressedSize))
+
+type Options struct {
+	Algorithm Algorithm
+	// уровень flate, для gzip используется он же, fast уровней не имеет
+	Level int
+	// тела не длиннее Threshold байт не сжимаются
+	Threshold int
+}
+
+// ParseMode разбирает режим из конфига: none, flate, gzip или fast
+func ParseMode(mode string, threshold int) (Options, error) {
+	o := Options{Level: flate.DefaultCompression, Threshold: threshold}
+	switch mode {
+	case "", "none":
+		o.Algorithm = None
+	case "flate":
+		o.Algorithm = Flate
+	case "gzip":
+		o.Algorithm = Gzip
+	case "fast":
+		o.Algorithm = Fast
+	default:
+		return o, errors.New(fmt.Sprintf("unknown compression mode %q", mode))
+	}
+	return o, nil
+}
+
+// Compress сжимает тело, если оно длиннее порога и сжатие действительно его уменьшает.
+// Возвращает использованный алгоритм, None если тело осталось как было.
+func (o Options) Compress(body []byte) (Algorithm, []byte) {
+	if o.Algorithm == None || len(body) <= o.Threshold {
+		return None, body
+	}
+	if o.Algorithm == Fast {
+		if out := fastEncode(body); len(out) < len(body) {
+			return Fast, out
+		}
+		return None, body
+	}
+
+	var buf bytes.Buffer
+	var w io.WriteCloser
+	var err error
+	switch o.Algorithm {
+	case Flate:
+		w, err = flate.NewWriter(&buf, o.Level)
+	case Gzip:
+		w, err = gzip.NewWriterLevel(&buf, o.Level)
+	default:
+		return None, body
+	}
+	if err != nil {
+		return None, body
+	}
+
+	if _, err := w.Write(body); err != nil {
+		return None, body
+	}
+	if err := w.Close(); err != nil {
+		return None, body
+	}
+
+	if buf.Len() >= len(body) {
+		return None, body
+	}
+	return o.Algorithm, buf.Bytes()
+}
+
+func Decompress(alg Algorithm, body []byte) ([]byte, error) {
+	var r io.ReadCloser
+	switch alg {
+	case None:
+		return body, nil
+	case Fast:
+		return fastDecode(body)
+	case Flate:
+		r = flate.NewReader(bytes.NewReader(body))
+	case Gzip:
+		var err error
+		if r, err = gzip.NewReader(bytes.NewReader(body)); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, errors.New(fmt.Sprintf("unknown compression algorithm %d", byte(alg)))
+	}
+	defer r.Close()
+
+	out, err := ioutil.ReadAll(io.LimitReader(r, MaxDecompressedSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(out) > MaxDecompressedSize {
+		return nil, ErrTooLarge
+	}
+	return out, nil
+}
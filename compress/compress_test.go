@@ -0,0 +1,143 @@
+package compress
+
+import (
+	"bytes"
+	"compress/flate"
+	"fmt"
+	"math/rand"
+	"net"
+	"testing"
+
+	"github.com/DemonVex/hashgossip/codec"
+	"github.com/DemonVex/hashgossip/models"
+)
+
+func TestParseMode(t *testing.T) {
+	for mode, want := range map[string]Algorithm{"": None, "none": None, "flate": Flate, "gzip": Gzip, "fast": Fast} {
+		o, err := ParseMode(mode, 100)
+		if err != nil || o.Algorithm != want || o.Threshold != 100 {
+			t.Errorf("ParseMode(%q) = %+v, %v, want %v", mode, o, err, want)
+		}
+	}
+	for _, mode := range []string{"snappy", "lz4", "FLATE"} {
+		if _, err := ParseMode(mode, 0); err == nil {
+			t.Errorf("ParseMode(%q) succeeded, want error", mode)
+		}
+	}
+}
+
+func TestCompressRoundTrip(t *testing.T) {
+	body := bytes.Repeat([]byte("hashgossip "), 100)
+	for _, alg := range []Algorithm{Flate, Gzip, Fast} {
+		got, packed := Options{Algorithm: alg, Level: flate.DefaultCompression}.Compress(body)
+		if got != alg || len(packed) >= len(body) {
+			t.Fatalf("%v: Compress = %v, %v bytes", alg, got, len(packed))
+		}
+		out, err := Decompress(alg, packed)
+		if err != nil || !bytes.Equal(out, body) {
+			t.Errorf("%v: Decompress = %v bytes, %v", alg, len(out), err)
+		}
+	}
+}
+
+func TestCompressKeepsBody(t *testing.T) {
+	for _, alg := range []Algorithm{Gzip, Fast} {
+		o := Options{Algorithm: alg, Level: flate.DefaultCompression, Threshold: 16}
+		// короче порога
+		if got, out := o.Compress([]byte("short")); got != None || string(out) != "short" {
+			t.Errorf("%v: Compress(short) = %v, %q", alg, got, out)
+		}
+		// сжатие не уменьшает случайные данные, тело остаётся как было
+		random := []byte(models.NewNodeID() + models.NewNodeID())
+		if got, out := o.Compress(random); got != None || !bytes.Equal(out, random) {
+			t.Errorf("%v: Compress(random) = %v, %v bytes", alg, got, len(out))
+		}
+	}
+}
+
+func TestDecompressLimits(t *testing.T) {
+	bomb := bytes.Repeat([]byte{0}, MaxDecompressedSize+1)
+	_, packed := Options{Algorithm: Flate, Level: flate.BestCompression}.Compress(bomb)
+	if _, err := Decompress(Flate, packed); err != ErrTooLarge {
+		t.Errorf("Decompress(bomb) error = %v, want %v", err, ErrTooLarge)
+	}
+	if _, err := Decompress(Algorithm(4), []byte{1}); err == nil {
+		t.Error("Decompress(unknown algorithm) succeeded, want error")
+	}
+	if _, err := Decompress(Gzip, []byte("not gzip")); err == nil {
+		t.Error("Decompress(garbage) succeeded, want error")
+	}
+}
+
+// welcomePack - WELCO, который получает новый узел в кластере из 50 пиров.
+// Идентификаторы случайные, как у настоящих узлов, но одни и те же от запуска к запуску.
+func welcomePack(b *testing.B) models.WelcomePack {
+	msg, err := models.NewMessage(bytes.Repeat([]byte("m"), 32))
+	if err != nil {
+		b.Fatal(err)
+	}
+	rnd := rand.New(rand.NewSource(1))
+	wp := models.WelcomePack{Msg: msg}
+	for i := 0; i < 50; i++ {
+		wp.PeerList = append(wp.PeerList, models.Peer{
+			IP:   net.IPv4(10, 0, byte(i/250), byte(i%250+1)),
+			Port: 7946,
+			ID:   fmt.Sprintf("%016x", rnd.Uint64()),
+		})
+	}
+	return wp
+}
+
+// bodies - тела WELCO и MESSA каждым кодеком
+func bodies(b *testing.B) map[string][]byte {
+	wp := welcomePack(b)
+	out := make(map[string][]byte)
+	for _, cd := range []codec.Codec{codec.Msgpack, codec.Protobuf, codec.JSON} {
+		for name, v := range map[string]interface{}{"welcome": wp, "message": wp.Msg} {
+			body, err := cd.Marshal(v)
+			if err != nil {
+				b.Fatal(err)
+			}
+			out[name+"/"+cd.Name()] = body
+		}
+	}
+	return out
+}
+
+// go test -bench . ./compress печатает и время, и размер тела после сжатия (wire-B)
+func BenchmarkCompress(b *testing.B) {
+	for name, body := range bodies(b) {
+		for _, alg := range []Algorithm{Flate, Gzip, Fast} {
+			o := Options{Algorithm: alg, Level: flate.DefaultCompression}
+			b.Run(fmt.Sprintf("%v/%v", name, alg), func(b *testing.B) {
+				b.SetBytes(int64(len(body)))
+				b.ReportAllocs()
+				var out []byte
+				for i := 0; i < b.N; i++ {
+					_, out = o.Compress(body)
+				}
+				b.ReportMetric(float64(len(out)), "wire-B")
+			})
+		}
+	}
+}
+
+func BenchmarkDecompress(b *testing.B) {
+	for name, body := range bodies(b) {
+		for _, alg := range []Algorithm{Flate, Gzip, Fast} {
+			used, packed := Options{Algorithm: alg, Level: flate.DefaultCompression}.Compress(body)
+			b.Run(fmt.Sprintf("%v/%v", name, alg), func(b *testing.B) {
+				if used == None {
+					b.Skip("body does not shrink and is sent uncompressed")
+				}
+				b.SetBytes(int64(len(body)))
+				b.ReportAllocs()
+				for i := 0; i < b.N; i++ {
+					if _, err := Decompress(used, packed); err != nil {
+						b.Fatal(err)
+					}
+				}
+			})
+		}
+	}
+}
@@ -0,0 +1,112 @@
+package compress
+
+import (
+	"encoding/binary"
+	"errors"
+)
+
+// Fast - простое LZ сжатие в духе snappy: без энтропийного кодирования,
+// поэтому сжимает хуже flate, но в несколько раз быстрее.
+//
+// Формат: длина распакованного тела (uvarint), затем элементы двух видов.
+// Байт тега < 0x80 - литерал: следующие tag+1 байт копируются как есть.
+// Тег >= 0x80 - повтор: (tag & 0x7f) + 4 байт, начиная на offset байт назад,
+// offset - следующие два байта, little endian.
+const (
+	fastMinMatch   = 4
+	fastMaxMatch   = 0x7f + fastMinMatch
+	fastMaxLiteral = 0x80
+	fastMaxOffset  = 0xffff
+	fastTableBits  = 14
+)
+
+var ErrCorrupt = errors.New("corrupt fast compressed body")
+
+func fastHash(u uint32) uint32 {
+	return u * 0x1e35a7bd >> (32 - fastTableBits)
+}
+
+func fastEncode(src []byte) []byte {
+	dst := make([]byte, binary.MaxVarintLen64, binary.MaxVarintLen64+len(src)+len(src)/fastMaxLiteral+1)
+	dst = dst[:binary.PutUvarint(dst, uint64(len(src)))]
+
+	// позиция+1 последнего места, где встречались эти четыре байта, 0 - не встречались
+	var table [1 << fastTableBits]int32
+	lit := 0
+	for i := 0; i+fastMinMatch <= len(src); {
+		cur := binary.LittleEndian.Uint32(src[i:])
+		h := fastHash(cur)
+		cand := int(table[h]) - 1
+		table[h] = int32(i + 1)
+		if cand < 0 || i-cand > fastMaxOffset || binary.LittleEndian.Uint32(src[cand:]) != cur {
+			i++
+			continue
+		}
+
+		length := fastMinMatch
+		for i+length < len(src) && length < fastMaxMatch && src[cand+length] == src[i+length] {
+			length++
+		}
+		dst = appendLiterals(dst, src[lit:i])
+		offset := i - cand
+		dst = append(dst, 0x80|byte(length-fastMinMatch), byte(offset), byte(offset>>8))
+		i += length
+		lit = i
+	}
+	return appendLiterals(dst, src[lit:])
+}
+
+func appendLiterals(dst, lit []byte) []byte {
+	for len(lit) > 0 {
+		n := len(lit)
+		if n > fastMaxLiteral {
+			n = fastMaxLiteral
+		}
+		dst = append(dst, byte(n-1))
+		dst = append(dst, lit[:n]...)
+		lit = lit[n:]
+	}
+	return dst
+}
+
+func fastDecode(src []byte) ([]byte, error) {
+	size, n := binary.Uvarint(src)
+	if n <= 0 {
+		return nil, ErrCorrupt
+	}
+	if size > MaxDecompressedSize {
+		return nil, ErrTooLarge
+	}
+
+	dst := make([]byte, 0, size)
+	for src = src[n:]; len(src) > 0; {
+		tag := src[0]
+		if tag < 0x80 {
+			length := int(tag) + 1
+			if len(src) < 1+length || len(dst)+length > int(size) {
+				return nil, ErrCorrupt
+			}
+			dst = append(dst, src[1:1+length]...)
+			src = src[1+length:]
+			continue
+		}
+
+		if len(src) < 3 {
+			return nil, ErrCorrupt
+		}
+		length := int(tag&0x7f) + fastMinMatch
+		offset := int(binary.LittleEndian.Uint16(src[1:]))
+		if offset == 0 || offset > len(dst) || len(dst)+length > int(size) {
+			return nil, ErrCorrupt
+		}
+		// повтор может перекрывать сам себя, поэтому копируется побайтно
+		for k := 0; k < length; k++ {
+			dst = append(dst, dst[len(dst)-offset])
+		}
+		src = src[3:]
+	}
+	if len(dst) != int(size) {
+		return nil, ErrCorrupt
+	}
+	return dst, nil
+}
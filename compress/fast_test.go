@@ -0,0 +1,62 @@
+package compress
+
+import (
+	"bytes"
+	"encoding/binary"
+	"math/rand"
+	"testing"
+)
+
+func TestFastRoundTrip(t *testing.T) {
+	rnd := rand.New(rand.NewSource(1))
+	random := make([]byte, 3000)
+	rnd.Read(random)
+	long := make([]byte, 200000)
+	for i := range long {
+		// повтор дальше fastMaxOffset не должен ломать смещения
+		long[i] = byte(i / 70000)
+	}
+	for name, body := range map[string][]byte{
+		"empty":    {},
+		"short":    []byte("abc"),
+		"repeated": bytes.Repeat([]byte("hashgossip "), 100),
+		// повтор перекрывает сам себя: каждый байт копируется с позиции на один назад
+		"run":    bytes.Repeat([]byte{7}, 1000),
+		"random": random,
+		"mixed":  append(append([]byte{}, random[:200]...), bytes.Repeat(random[:50], 20)...),
+		"long":   long,
+	} {
+		packed := fastEncode(body)
+		out, err := fastDecode(packed)
+		if err != nil || !bytes.Equal(out, body) {
+			t.Errorf("%v: round trip = %v bytes, %v, want %v bytes", name, len(out), err, len(body))
+		}
+	}
+	if packed := fastEncode(bytes.Repeat([]byte{7}, 1000)); len(packed) > 30 {
+		t.Errorf("run of 1000 bytes is packed into %v bytes", len(packed))
+	}
+}
+
+func TestFastDecodeCorrupt(t *testing.T) {
+	packed := fastEncode(bytes.Repeat([]byte("hashgossip "), 20))
+	for name, body := range map[string][]byte{
+		"empty":          {},
+		"truncated":      packed[:len(packed)-1],
+		"extra":          append(append([]byte{}, packed...), 0, 'x'),
+		"literal past":   {3, 2, 'a'},
+		"zero offset":    {5, 0, 'a', 0x80, 0, 0},
+		"offset too far": {5, 0, 'a', 0x80, 2, 0},
+		"short copy":     {5, 0, 'a', 0x80, 1},
+		"longer":         {1, 4, 'a', 'b', 'c', 'd', 'e'},
+	} {
+		if _, err := fastDecode(body); err != ErrCorrupt {
+			t.Errorf("%v: fastDecode error = %v, want %v", name, err, ErrCorrupt)
+		}
+	}
+
+	huge := make([]byte, binary.MaxVarintLen64)
+	huge = huge[:binary.PutUvarint(huge, MaxDecompressedSize+1)]
+	if _, err := Decompress(Fast, huge); err != ErrTooLarge {
+		t.Errorf("Decompress(huge) error = %v, want %v", err, ErrTooLarge)
+	}
+}
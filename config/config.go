@@ -0,0 +1,142 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	m "github.com/DemonVex/hashgossip/models"
+
+	"github.com/BurntSushi/toml"
+)
+
+// EnvPrefix - префикс переменных окружения, которые заменяют значения из файла
+const EnvPrefix = "HASHGOSSIP_"
+
+// EnvConfig - путь к файлу конфига, если он не указан флагом
+const EnvConfig = EnvPrefix + "CONFIG"
+
+// Errors - все найденные в конфиге ошибки, чтобы исправить их за один раз
+type Errors []string
+
+func (e Errors) Error() string {
+	return strings.Join(e, "\n")
+}
+
+func (e *Errors) add(format string, v ...interface{}) {
+	*e = append(*e, fmt.Sprintf(format, v...))
+}
+
+// Default - настройки, которые действуют, если их нет ни в файле, ни в окружении
+func Default() m.Config {
+	return m.Config{
+		Network:              "udp4",
+		MulticastAddress:     "224.0.0.1:9999",
+		LimitMessages:        10,
+		InvalidFrequent:      5,
+		Codec:                "msgpack",
+		Compression:          "none",
+		CompressionThreshold: 512,
+		BatchMTU:             1400,
+		BatchLinger:          m.Duration{Duration: 10 * time.Millisecond},
+		MulticastTTL:         1,
+		MulticastLoopback:    true,
+		ProbeInterval:        m.Duration{Duration: time.Second},
+		SuspectTimeout:       m.Duration{Duration: 5 * time.Second},
+		DeadTimeout:          m.Duration{Duration: 15 * time.Second},
+		PeerCacheInterval:    m.Duration{Duration: 30 * time.Second},
+		PeerCacheMaxAge:      m.Duration{Duration: 24 * time.Hour},
+		LogLevel:             "info",
+		LogFormat:            "logfmt",
+		LogSampleFirst:       100,
+		LogSampleThereafter:  100,
+		RateLimit: m.RateLimit{
+			Source: m.Limit{Rate: 2000, Burst: 4000},
+			Types: map[string]m.Limit{
+				"HELLO": {Rate: 5, Burst: 50},
+				"MONIT": {Rate: 1, Burst: 5},
+			},
+		},
+		Reputation: m.Reputation{
+			InvalidPenalty:   10,
+			MalformedPenalty: 5,
+			RateLimitPenalty: 1,
+			Recovery:         1,
+			Cooldown:         m.Duration{Duration: 5 * time.Minute},
+		},
+	}
+}
+
+// WithDefaults заменяет значениями из Default поля, у которых нулевое значение
+// означает "по умолчанию": Network, Codec, CompressionThreshold и интервалы
+// проверки и кэша пиров. Остальные нулевые значения что-то значат сами по себе,
+// например пустой MulticastAddress выключает multicast, и не меняются
+func WithDefaults(conf m.Config) m.Config {
+	def := Default()
+	if conf.Network == "" {
+		conf.Network = def.Network
+	}
+	if conf.Codec == "" {
+		conf.Codec = def.Codec
+	}
+	if conf.CompressionThreshold <= 0 {
+		conf.CompressionThreshold = def.CompressionThreshold
+	}
+	for _, d := range []struct {
+		value *m.Duration
+		def   m.Duration
+	}{
+		{&conf.ProbeInterval, def.ProbeInterval},
+		{&conf.SuspectTimeout, def.SuspectTimeout},
+		{&conf.DeadTimeout, def.DeadTimeout},
+		{&conf.PeerCacheInterval, def.PeerCacheInterval},
+		{&conf.PeerCacheMaxAge, def.PeerCacheMaxAge},
+	} {
+		if d.value.Duration <= 0 {
+			*d.value = d.def
+		}
+	}
+	return conf
+}
+
+// Load собирает конфиг слоями: значения по умолчанию, файл path (пустой - без файла)
+// и переменные окружения HASHGOSSIP_* из environ. Неизвестные ключи файла и ошибки
+// в переменных возвращаются вместе как Errors, конфиг при этом заполнен остальными значениями.
+func Load(path string, environ []string) (m.Config, error) {
+	conf := Default()
+	var errs Errors
+	if path != "" {
+		// таблицы вроде RateLimit.Types дополняют значения по умолчанию, а не заменяют их
+		md, err := toml.DecodeFile(path, &conf)
+		if err != nil {
+			return conf, errors.New(fmt.Sprintf("can't read config file %v: %v", path, err))
+		}
+		for _, key := range md.Undecoded() {
+			errs.add("unknown key %v in %v", key, path)
+		}
+	}
+	errs = append(errs, applyEnv(&conf, environ)...)
+
+	if len(errs) > 0 {
+		return conf, errs
+	}
+	return conf, nil
+}
+
+// Path выбирает файл конфига: flag, если он задан, иначе HASHGOSSIP_CONFIG, иначе def.
+// Отсутствующий def не ошибка, тогда возвращается пустая строка и конфиг
+// собирается из значений по умолчанию и окружения.
+func Path(flag, def string) string {
+	if flag != "" {
+		return flag
+	}
+	if env := os.Getenv(EnvConfig); env != "" {
+		return env
+	}
+	if _, err := os.Stat(def); err != nil {
+		return ""
+	}
+	return def
+}
@@ -0,0 +1,162 @@
+package config
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	m "github.com/DemonVex/hashgossip/models"
+)
+
+func writeConfig(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "hashgossip.toml")
+	if err := ioutil.WriteFile(path, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoadWithoutFileIsDefault(t *testing.T) {
+	conf, err := Load("", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(conf, Default()) {
+		t.Errorf("Load without file and environment = %+v, want Default()", conf)
+	}
+}
+
+func TestLoadLayers(t *testing.T) {
+	path := writeConfig(t, `
+LimitMessages = 20
+Codec = "json"
+SuspectTimeout = "3s"
+Seeds = ["10.0.0.1:9000"]
+
+[RateLimit.Types.PROBE]
+Rate = 10
+Burst = 20
+`)
+	environ := []string{
+		"HASHGOSSIP_CODEC=protobuf",
+		"HASHGOSSIP_SEEDS=10.0.0.2:9000, 10.0.0.3:9000",
+		"HASHGOSSIP_RATE_LIMIT_TYPES_HELLO_RATE=7",
+		"HASHGOSSIP_REPUTATION_INVALID_PENALTY=2.5",
+		"PATH=/bin",
+	}
+	conf, err := Load(path, environ)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// файл заменяет значения по умолчанию
+	if conf.LimitMessages != 20 || conf.SuspectTimeout.Duration != 3*time.Second {
+		t.Errorf("file values are not applied: LimitMessages %v, SuspectTimeout %v", conf.LimitMessages, conf.SuspectTimeout)
+	}
+	// окружение заменяет файл
+	if conf.Codec != "protobuf" {
+		t.Errorf("Codec = %q, want protobuf from environment", conf.Codec)
+	}
+	if want := []string{"10.0.0.2:9000", "10.0.0.3:9000"}; !reflect.DeepEqual(conf.Seeds, want) {
+		t.Errorf("Seeds = %v, want %v", conf.Seeds, want)
+	}
+	if conf.Reputation.InvalidPenalty != 2.5 {
+		t.Errorf("Reputation.InvalidPenalty = %v, want 2.5", conf.Reputation.InvalidPenalty)
+	}
+	// не заданное нигде остаётся по умолчанию
+	if conf.DeadTimeout != Default().DeadTimeout || conf.BatchMTU != Default().BatchMTU {
+		t.Errorf("defaults are lost: DeadTimeout %v, BatchMTU %v", conf.DeadTimeout, conf.BatchMTU)
+	}
+	// таблицы дополняют значения по умолчанию, переменная меняет одно поле записи
+	types := conf.RateLimit.Types
+	if types["PROBE"] != (m.Limit{Rate: 10, Burst: 20}) {
+		t.Errorf("RateLimit.Types.PROBE = %+v, want Rate 10 Burst 20", types["PROBE"])
+	}
+	if types["HELLO"] != (m.Limit{Rate: 7, Burst: Default().RateLimit.Types["HELLO"].Burst}) {
+		t.Errorf("RateLimit.Types.HELLO = %+v, want Rate 7 and the default Burst", types["HELLO"])
+	}
+	if types["MONIT"] != Default().RateLimit.Types["MONIT"] {
+		t.Errorf("default RateLimit.Types.MONIT is lost: %+v", types["MONIT"])
+	}
+}
+
+func TestLoadReportsAllErrors(t *testing.T) {
+	path := writeConfig(t, `
+LimitMessages = 3
+Colour = "blue"
+`)
+	environ := []string{
+		"HASHGOSSIP_BATCH_MTU=big",
+		"HASHGOSSIP_NO_SUCH_KEY=1",
+		"HASHGOSSIP_CONFIG=/elsewhere.toml",
+	}
+	conf, err := Load(path, environ)
+	errs, ok := err.(Errors)
+	if !ok {
+		t.Fatalf("Load error = %v, want Errors", err)
+	}
+	for _, want := range []string{"unknown key Colour", "HASHGOSSIP_BATCH_MTU", "unknown environment variable HASHGOSSIP_NO_SUCH_KEY"} {
+		if !strings.Contains(errs.Error(), want) {
+			t.Errorf("errors %q do not mention %q", errs.Error(), want)
+		}
+	}
+	if len(errs) != 3 {
+		t.Errorf("got %v errors, want 3: %v", len(errs), errs)
+	}
+	// остальные значения всё равно применены
+	if conf.LimitMessages != 3 {
+		t.Errorf("LimitMessages = %v, want 3 despite errors", conf.LimitMessages)
+	}
+}
+
+func TestLoadMissingFile(t *testing.T) {
+	if _, err := Load(filepath.Join(t.TempDir(), "missing.toml"), nil); err == nil {
+		t.Error("Load of a missing file succeeded")
+	}
+}
+
+func TestPath(t *testing.T) {
+	def := writeConfig(t, "")
+	os.Unsetenv(EnvConfig)
+	if got := Path("flag.toml", def); got != "flag.toml" {
+		t.Errorf("Path with flag = %q, want flag.toml", got)
+	}
+	if got := Path("", def); got != def {
+		t.Errorf("Path without flag = %q, want %q", got, def)
+	}
+	if got := Path("", def+".missing"); got != "" {
+		t.Errorf("Path with missing default = %q, want empty", got)
+	}
+	os.Setenv(EnvConfig, "env.toml")
+	defer os.Unsetenv(EnvConfig)
+	if got := Path("", def); got != "env.toml" {
+		t.Errorf("Path with %v = %q, want env.toml", EnvConfig, got)
+	}
+}
+
+func TestWithDefaults(t *testing.T) {
+	conf := WithDefaults(m.Config{
+		SuspectTimeout: m.Duration{Duration: 2 * time.Second},
+		BatchLinger:    m.Duration{},
+	})
+	def := Default()
+	if conf.Network != def.Network || conf.Codec != def.Codec || conf.CompressionThreshold != def.CompressionThreshold {
+		t.Errorf("Network, Codec, CompressionThreshold = %q, %q, %v, want defaults", conf.Network, conf.Codec, conf.CompressionThreshold)
+	}
+	if conf.ProbeInterval != def.ProbeInterval || conf.DeadTimeout != def.DeadTimeout ||
+		conf.PeerCacheInterval != def.PeerCacheInterval || conf.PeerCacheMaxAge != def.PeerCacheMaxAge {
+		t.Errorf("zero intervals are not defaulted: %+v", conf)
+	}
+	if conf.SuspectTimeout.Duration != 2*time.Second {
+		t.Errorf("SuspectTimeout = %v, want the set 2s", conf.SuspectTimeout)
+	}
+	// нулевые значения, которые что-то значат, не трогаются
+	if conf.BatchLinger.Duration != 0 || conf.MulticastAddress != "" || conf.LimitMessages != 0 {
+		t.Errorf("meaningful zero values are replaced: %+v", conf)
+	}
+}
@@ -0,0 +1,159 @@
+package config
+
+import (
+	"encoding"
+	"errors"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"unicode"
+
+	m "github.com/DemonVex/hashgossip/models"
+)
+
+// applyEnv записывает в conf переменные HASHGOSSIP_*. Имя переменной - путь к полю
+// в верхнем регистре через подчёркивание: LimitMessages - HASHGOSSIP_LIMIT_MESSAGES,
+// RateLimit.Source.Rate - HASHGOSSIP_RATE_LIMIT_SOURCE_RATE, лимит типа пакета -
+// HASHGOSSIP_RATE_LIMIT_TYPES_HELLO_RATE. Списки задаются через запятую.
+func applyEnv(conf *m.Config, environ []string) Errors {
+	var errs Errors
+	v := reflect.ValueOf(conf).Elem()
+	for _, kv := range environ {
+		i := strings.IndexByte(kv, '=')
+		if i < 0 || !strings.HasPrefix(kv[:i], EnvPrefix) {
+			continue
+		}
+		name, value := kv[:i], kv[i+1:]
+		if name == EnvConfig {
+			continue
+		}
+
+		found, err := setEnv(v, strings.TrimPrefix(name, EnvPrefix), value)
+		switch {
+		case !found:
+			errs.add("unknown environment variable %v", name)
+		case err != nil:
+			errs.add("%v: %v", name, err)
+		}
+	}
+	return errs
+}
+
+// setEnv ищет в структуре v поле по имени name и записывает в него value
+func setEnv(v reflect.Value, name, value string) (bool, error) {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		f, fv := t.Field(i), v.Field(i)
+		field := envName(f.Name)
+
+		if name == field && isLeaf(fv) {
+			return true, setValue(fv, value)
+		}
+		rest := strings.TrimPrefix(name, field+"_")
+		if rest == name {
+			continue
+		}
+
+		switch {
+		case fv.Kind() == reflect.Struct && !isLeaf(fv):
+			if found, err := setEnv(fv, rest, value); found {
+				return true, err
+			}
+		case fv.Kind() == reflect.Map && fv.Type().Elem().Kind() == reflect.Struct:
+			// ключ карты не содержит подчёркиваний, дальше идёт поле значения
+			j := strings.IndexByte(rest, '_')
+			if j <= 0 {
+				continue
+			}
+			key := reflect.ValueOf(rest[:j])
+			elem := reflect.New(fv.Type().Elem()).Elem()
+			if !fv.IsNil() {
+				if old := fv.MapIndex(key); old.IsValid() {
+					elem.Set(old)
+				}
+			}
+			found, err := setEnv(elem, rest[j+1:], value)
+			if !found {
+				continue
+			}
+			if err == nil {
+				if fv.IsNil() {
+					fv.Set(reflect.MakeMap(fv.Type()))
+				}
+				fv.SetMapIndex(key, elem)
+			}
+			return true, err
+		}
+	}
+	return false, nil
+}
+
+// isLeaf - поле задаётся одной переменной: простые типы и всё, что разбирается из текста, как Duration
+func isLeaf(v reflect.Value) bool {
+	if _, ok := v.Addr().Interface().(encoding.TextUnmarshaler); ok {
+		return true
+	}
+	switch v.Kind() {
+	case reflect.String, reflect.Bool, reflect.Int, reflect.Float64:
+		return true
+	case reflect.Slice:
+		return v.Type().Elem().Kind() == reflect.String
+	}
+	return false
+}
+
+func setValue(v reflect.Value, value string) error {
+	if u, ok := v.Addr().Interface().(encoding.TextUnmarshaler); ok {
+		return u.UnmarshalText([]byte(value))
+	}
+
+	switch v.Kind() {
+	case reflect.String:
+		v.SetString(value)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return errors.New(fmt.Sprintf("%q is not a boolean", value))
+		}
+		v.SetBool(b)
+	case reflect.Int:
+		n, err := strconv.Atoi(value)
+		if err != nil {
+			return errors.New(fmt.Sprintf("%q is not an integer", value))
+		}
+		v.SetInt(int64(n))
+	case reflect.Float64:
+		f, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return errors.New(fmt.Sprintf("%q is not a number", value))
+		}
+		v.SetFloat(f)
+	case reflect.Slice:
+		list := reflect.MakeSlice(v.Type(), 0, 0)
+		for _, s := range strings.Split(value, ",") {
+			if s = strings.TrimSpace(s); s != "" {
+				list = reflect.Append(list, reflect.ValueOf(s))
+			}
+		}
+		v.Set(list)
+	}
+	return nil
+}
+
+// envName переводит имя поля в имя переменной: MulticastTTL - MULTICAST_TTL, NodeID - NODE_ID
+func envName(field string) string {
+	r := []rune(field)
+	var b strings.Builder
+	for i, c := range r {
+		if i > 0 && unicode.IsUpper(c) {
+			prev := r[i-1]
+			nextLower := i+1 < len(r) && unicode.IsLower(r[i+1])
+			if unicode.IsLower(prev) || unicode.IsDigit(prev) || (unicode.IsUpper(prev) && nextLower) {
+				b.WriteByte('_')
+			}
+		}
+		b.WriteRune(unicode.ToUpper(c))
+	}
+	return b.String()
+}
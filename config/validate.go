@@ -0,0 +1,180 @@
+package config
+
+import (
+	"net"
+	"net/url"
+	"sort"
+	"strconv"
+
+	"github.com/DemonVex/hashgossip/codec"
+	"github.com/DemonVex/hashgossip/compress"
+	c "github.com/DemonVex/hashgossip/consts"
+	"github.com/DemonVex/hashgossip/logger"
+	m "github.com/DemonVex/hashgossip/models"
+	"github.com/DemonVex/hashgossip/transport"
+)
+
+// Validate проверяет значения, с которыми узел не запустится или будет работать
+// не так, как ожидается. Возвращает nil, если ошибок нет.
+func Validate(conf m.Config) Errors {
+	var errs Errors
+
+	switch conf.Network {
+	case "", "udp", "udp4", "udp6":
+	default:
+		errs.add("Network must be udp4, udp6 or udp, got %q", conf.Network)
+	}
+	if conf.MulticastAddress != "" {
+		if ip, ok := hostPort(conf.MulticastAddress); !ok || ip == nil || !ip.IsMulticast() {
+			errs.add("MulticastAddress must be a multicast IP:port like 224.0.0.1:9999, got %q", conf.MulticastAddress)
+		}
+	}
+	if conf.MulticastTTL < 0 || conf.MulticastTTL > 255 {
+		errs.add("MulticastTTL must be between 0 and 255, got %v", conf.MulticastTTL)
+	}
+	for _, seed := range conf.Seeds {
+		if _, ok := hostPort(seed); !ok {
+			errs.add("Seeds: %q is not a host:port", seed)
+		}
+	}
+	// нулевые значения заменяются значениями по умолчанию, проверяются действующие
+	effective := WithDefaults(conf)
+	if _, err := transport.ResolveBindAddr(effective.Network, conf.BindAddress); err != nil {
+		errs.add("BindAddress: %v", err)
+	}
+	if conf.AdvertiseAddress != "" && net.ParseIP(conf.AdvertiseAddress) == nil {
+		errs.add("AdvertiseAddress must be an IP address, got %q", conf.AdvertiseAddress)
+	}
+
+	// демо-режим выбирает число сообщений из [0:LimitMessages)
+	if conf.LimitMessages < 0 {
+		errs.add("LimitMessages must not be negative, got %v", conf.LimitMessages)
+	} else if conf.DemoMode && conf.LimitMessages == 0 {
+		errs.add("LimitMessages must be positive in DemoMode, with 0 the node publishes nothing")
+	}
+	if conf.InvalidFrequent < 0 || conf.InvalidFrequent > 100 {
+		errs.add("InvalidFrequent is a percentage and must be between 0 and 100, got %v", conf.InvalidFrequent)
+	}
+
+	if _, ok := codec.ByName(conf.Codec); !ok && conf.Codec != "" {
+		errs.add("Codec must be msgpack, protobuf or json, got %q", conf.Codec)
+	}
+	if _, err := compress.ParseMode(conf.Compression, conf.CompressionThreshold); err != nil {
+		errs.add("Compression: %v, expected none, flate, gzip or fast", err)
+	}
+	if conf.CompressionThreshold < 0 {
+		errs.add("CompressionThreshold must not be negative, got %v", conf.CompressionThreshold)
+	}
+	if conf.BatchMTU < 0 || conf.BatchMTU > transport.MaxDatagramSize {
+		errs.add("BatchMTU must be between 0 and %v, got %v", transport.MaxDatagramSize, conf.BatchMTU)
+	}
+
+	for _, d := range []struct {
+		name  string
+		value m.Duration
+	}{
+		{"BatchLinger", conf.BatchLinger},
+		{"ProbeInterval", conf.ProbeInterval},
+		{"SuspectTimeout", conf.SuspectTimeout},
+		{"DeadTimeout", conf.DeadTimeout},
+		{"PeerCacheInterval", conf.PeerCacheInterval},
+		{"PeerCacheMaxAge", conf.PeerCacheMaxAge},
+		{"Reputation.Cooldown", conf.Reputation.Cooldown},
+	} {
+		if d.value.Duration < 0 {
+			errs.add("%v must not be negative, got %v", d.name, d.value)
+		}
+	}
+	probe, suspect, dead := effective.ProbeInterval.Duration, effective.SuspectTimeout.Duration, effective.DeadTimeout.Duration
+	if probe >= suspect {
+		errs.add("SuspectTimeout (%v) must be longer than ProbeInterval (%v)", suspect, probe)
+	}
+	if suspect >= dead {
+		errs.add("DeadTimeout (%v) must be longer than SuspectTimeout (%v)", dead, suspect)
+	}
+
+	if conf.AdminAddress != "" {
+		host, _, err := net.SplitHostPort(conf.AdminAddress)
+		ip := net.ParseIP(host)
+		loopback := host == "localhost" || (ip != nil && ip.IsLoopback())
+		switch {
+		case err != nil:
+			errs.add("AdminAddress must be a host:port like 127.0.0.1:8080, got %q", conf.AdminAddress)
+		case !loopback && !conf.AdminAllowRemote:
+			errs.add("AdminAddress %v is not a loopback address, set AdminAllowRemote and AdminToken to expose it", conf.AdminAddress)
+		}
+	}
+	if conf.AdminAllowRemote && conf.AdminToken == "" {
+		errs.add("AdminAllowRemote requires AdminToken, generate one with 'hashgossip keygen'")
+	}
+
+	if _, err := logger.ParseLevel(conf.LogLevel); err != nil {
+		errs.add("LogLevel: %v, expected debug, info, warn or error", err)
+	}
+	switch conf.LogFormat {
+	case "", logger.FormatLogfmt, logger.FormatJSON:
+	default:
+		errs.add("LogFormat must be %v or %v, got %q", logger.FormatLogfmt, logger.FormatJSON, conf.LogFormat)
+	}
+	if conf.LogSampleFirst < 0 || conf.LogSampleThereafter < 0 {
+		errs.add("LogSampleFirst and LogSampleThereafter must not be negative")
+	}
+	if conf.TraceEndpoint != "" {
+		if u, err := url.Parse(conf.TraceEndpoint); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			errs.add("TraceEndpoint must be an http(s) URL, got %q", conf.TraceEndpoint)
+		}
+	}
+
+	validateLimit(&errs, "RateLimit.Source", conf.RateLimit.Source)
+	validateLimit(&errs, "RateLimit.Outbound", conf.RateLimit.Outbound)
+	types := make([]string, 0, len(conf.RateLimit.Types))
+	for t := range conf.RateLimit.Types {
+		types = append(types, t)
+	}
+	sort.Strings(types)
+	for _, t := range types {
+		if len(t) != c.PrefLen {
+			errs.add("RateLimit.Types: %q is not a packet type, expected %v letters like HELLO", t, c.PrefLen)
+		}
+		validateLimit(&errs, "RateLimit.Types."+t, conf.RateLimit.Types[t])
+	}
+
+	for _, p := range []struct {
+		name  string
+		value m.Number
+	}{
+		{"Reputation.InvalidPenalty", conf.Reputation.InvalidPenalty},
+		{"Reputation.MalformedPenalty", conf.Reputation.MalformedPenalty},
+		{"Reputation.RateLimitPenalty", conf.Reputation.RateLimitPenalty},
+	} {
+		if p.value < 0 || p.value > 100 {
+			errs.add("%v must be between 0 and 100, got %v", p.name, p.value)
+		}
+	}
+	if conf.Reputation.Recovery < 0 {
+		errs.add("Reputation.Recovery must not be negative, got %v", conf.Reputation.Recovery)
+	}
+
+	return errs
+}
+
+func validateLimit(errs *Errors, name string, l m.Limit) {
+	if l.Rate < 0 {
+		errs.add("%v.Rate must not be negative, got %v", name, l.Rate)
+	}
+	if l.Burst < 0 {
+		errs.add("%v.Burst must not be negative, got %v", name, l.Burst)
+	}
+}
+
+// hostPort разбирает host:port, ip = nil, если host - имя, а не адрес
+func hostPort(addr string) (ip net.IP, ok bool) {
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return nil, false
+	}
+	if p, err := strconv.Atoi(port); err != nil || p < 1 || p > 65535 {
+		return nil, false
+	}
+	return net.ParseIP(host), true
+}
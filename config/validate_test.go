@@ -0,0 +1,70 @@
+package config
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	m "github.com/DemonVex/hashgossip/models"
+)
+
+func TestValidateDefault(t *testing.T) {
+	if errs := Validate(Default()); errs != nil {
+		t.Errorf("Default() is invalid: %v", errs)
+	}
+	// пустой конфиг дополняется значениями по умолчанию
+	if errs := Validate(m.Config{}); errs != nil {
+		t.Errorf("empty config is invalid: %v", errs)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	for _, tt := range []struct {
+		name   string
+		change func(*m.Config)
+		want   string
+	}{
+		{"network", func(c *m.Config) { c.Network = "tcp" }, "Network must be"},
+		{"multicast address", func(c *m.Config) { c.MulticastAddress = "10.0.0.1:9999" }, "MulticastAddress must be"},
+		{"ttl", func(c *m.Config) { c.MulticastTTL = 256 }, "MulticastTTL"},
+		{"seed", func(c *m.Config) { c.Seeds = []string{"10.0.0.1"} }, `Seeds: "10.0.0.1"`},
+		{"seed port", func(c *m.Config) { c.Seeds = []string{"10.0.0.1:70000"} }, "Seeds"},
+		{"advertise", func(c *m.Config) { c.AdvertiseAddress = "node.local" }, "AdvertiseAddress"},
+		{"demo without messages", func(c *m.Config) { c.DemoMode, c.LimitMessages = true, 0 }, "LimitMessages must be positive"},
+		{"invalid frequent", func(c *m.Config) { c.InvalidFrequent = 101 }, "InvalidFrequent"},
+		{"codec", func(c *m.Config) { c.Codec = "xml" }, "Codec must be"},
+		{"compression", func(c *m.Config) { c.Compression = "snappy" }, "Compression"},
+		{"mtu", func(c *m.Config) { c.BatchMTU = 100000 }, "BatchMTU"},
+		{"negative duration", func(c *m.Config) { c.BatchLinger = m.Duration{Duration: -time.Second} }, "BatchLinger must not be negative"},
+		{"suspect after probe", func(c *m.Config) { c.ProbeInterval = m.Duration{Duration: 10 * time.Second} }, "SuspectTimeout (5s) must be longer than ProbeInterval (10s)"},
+		{"dead after suspect", func(c *m.Config) { c.DeadTimeout = m.Duration{Duration: 2 * time.Second} }, "DeadTimeout (2s) must be longer"},
+		{"remote admin", func(c *m.Config) { c.AdminAddress = "0.0.0.0:8080" }, "is not a loopback address"},
+		{"remote admin without token", func(c *m.Config) { c.AdminAddress, c.AdminAllowRemote = "0.0.0.0:8080", true }, "AdminAllowRemote requires AdminToken"},
+		{"log level", func(c *m.Config) { c.LogLevel = "trace" }, "LogLevel"},
+		{"log format", func(c *m.Config) { c.LogFormat = "xml" }, "LogFormat"},
+		{"trace endpoint", func(c *m.Config) { c.TraceEndpoint = "collector:4318" }, "TraceEndpoint"},
+		{"rate", func(c *m.Config) { c.RateLimit.Source.Rate = -1 }, "RateLimit.Source.Rate"},
+		{"packet type", func(c *m.Config) { c.RateLimit.Types = map[string]m.Limit{"HI": {Rate: 1}} }, `RateLimit.Types: "HI"`},
+		{"penalty", func(c *m.Config) { c.Reputation.InvalidPenalty = 150 }, "Reputation.InvalidPenalty"},
+		{"recovery", func(c *m.Config) { c.Reputation.Recovery = -1 }, "Reputation.Recovery"},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			conf := Default()
+			tt.change(&conf)
+			errs := Validate(conf)
+			if len(errs) != 1 || !strings.Contains(errs[0], tt.want) {
+				t.Errorf("Validate() = %q, want one error containing %q", errs, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidateReportsAllErrors(t *testing.T) {
+	conf := Default()
+	conf.Network = "tcp"
+	conf.Codec = "xml"
+	conf.LogLevel = "trace"
+	if errs := Validate(conf); len(errs) != 3 {
+		t.Errorf("Validate() = %q, want 3 errors", errs)
+	}
+}
@@ -7,8 +7,19 @@ var (
 	PrefMessage    = []byte("MESSA")
 	PrefWelcome    = []byte("WELCO")
 	PrefReport     = []byte("REPOR")
+	PrefProbe      = []byte("PROBE")
+	PrefAlive      = []byte("ALIVE")
+	PrefCompound   = []byte("COMPO")
+	PrefLeave      = []byte("LEAVE")
+	// администрирование карантина, принимаются только с адресов самого узла
+	PrefBanList   = []byte("BANLS")
+	PrefBanReport = []byte("BANRP")
+	PrefUnban     = []byte("UNBAN")
 )
 
 const (
 	PrefLen = 5
 )
+
+// Version задаётся при сборке: -ldflags "-X github.com/DemonVex/hashgossip/consts.Version=..."
+var Version = "dev"
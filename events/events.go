@@ -0,0 +1,81 @@
+package events
+
+import (
+	"context"
+
+	"github.com/DemonVex/hashgossip/logger"
+	"github.com/DemonVex/hashgossip/models"
+)
+
+type EventDelegate interface {
+	OnPeerJoin(models.Peer)
+	OnPeerLeave(models.Peer)
+	// смена состояния пира: alive <-> suspect
+	OnPeerUpdate(models.Peer)
+	OnMessageAccepted(models.Message)
+	OnMessageRejected(models.Message, error)
+}
+
+// NopDelegate ничего не делает, его удобно встраивать,
+// чтобы реализовать только нужные методы
+type NopDelegate struct{}
+
+func (NopDelegate) OnPeerJoin(models.Peer)                  {}
+func (NopDelegate) OnPeerLeave(models.Peer)                 {}
+func (NopDelegate) OnPeerUpdate(models.Peer)                {}
+func (NopDelegate) OnMessageAccepted(models.Message)        {}
+func (NopDelegate) OnMessageRejected(models.Message, error) {}
+
+// Dispatcher доставляет события делегатам в отдельной горутине.
+// События вызываются из горутины приёма пакетов, поэтому ждать медленный
+// делегат нельзя: при переполненной очереди событие отбрасывается.
+type Dispatcher struct {
+	delegates []EventDelegate
+	queue     chan func(EventDelegate)
+	log       logger.Logger
+}
+
+func NewDispatcher(size int, lg logger.Logger, delegates ...EventDelegate) *Dispatcher {
+	return &Dispatcher{delegates: delegates, queue: make(chan func(EventDelegate), size), log: logger.Or(lg)}
+}
+
+func (d *Dispatcher) StartLoop(ctx context.Context) {
+	for {
+		select {
+		case f := <-d.queue:
+			for _, e := range d.delegates {
+				f(e)
+			}
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+func (d *Dispatcher) push(f func(EventDelegate)) {
+	select {
+	case d.queue <- f:
+	default:
+		d.log.Warn("event queue is full, event dropped")
+	}
+}
+
+func (d *Dispatcher) OnPeerJoin(p models.Peer) {
+	d.push(func(e EventDelegate) { e.OnPeerJoin(p) })
+}
+
+func (d *Dispatcher) OnPeerLeave(p models.Peer) {
+	d.push(func(e EventDelegate) { e.OnPeerLeave(p) })
+}
+
+func (d *Dispatcher) OnPeerUpdate(p models.Peer) {
+	d.push(func(e EventDelegate) { e.OnPeerUpdate(p) })
+}
+
+func (d *Dispatcher) OnMessageAccepted(m models.Message) {
+	d.push(func(e EventDelegate) { e.OnMessageAccepted(m) })
+}
+
+func (d *Dispatcher) OnMessageRejected(m models.Message, reason error) {
+	d.push(func(e EventDelegate) { e.OnMessageRejected(m, reason) })
+}
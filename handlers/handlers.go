@@ -3,17 +3,24 @@ package handlers
 import (
 	"bytes"
 	"encoding/binary"
-	"log"
+	"errors"
+	"fmt"
 	"net"
 	"os"
+	"time"
 
-	"github.com/vmihailenco/msgpack"
-
+	"github.com/DemonVex/hashgossip/codec"
+	"github.com/DemonVex/hashgossip/compress"
 	c "github.com/DemonVex/hashgossip/consts"
+	"github.com/DemonVex/hashgossip/events"
+	"github.com/DemonVex/hashgossip/logger"
 	"github.com/DemonVex/hashgossip/messenger"
+	"github.com/DemonVex/hashgossip/metrics"
 	"github.com/DemonVex/hashgossip/models"
 	"github.com/DemonVex/hashgossip/storages"
+	"github.com/DemonVex/hashgossip/tracing"
 	"github.com/DemonVex/hashgossip/transport"
+	"github.com/DemonVex/hashgossip/wire"
 )
 
 type UdpHandler struct {
@@ -21,110 +28,396 @@ type UdpHandler struct {
 	MessageStorage storage.MessageStorage
 	HashStorage    storage.HashStorage
 	Gossiper       messenger.Gossiper
+	Events         events.EventDelegate
+	// снимает репутацию за битые пакеты и сообщения, может быть nil
+	Reputation storage.ReputationStorage
+	// считает ошибки разбора, неверные сообщения и задержку доставки, может быть nil
+	Metrics *metrics.Metrics
+	// через него уходят ответы, без него они отправляются сразу
+	Batcher *transport.Batcher
+	// без логгера используется logger.Default()
+	Log logger.Logger
+	// получает события receive и accept для сообщений с трассой, может быть nil
+	Tracer tracing.Tracer
+	// порт, на котором узел принимает пакеты, и идентификатор узла, отправляются в ответ на PROBE
+	Port   uint16
+	NodeID string
+	// настройки сжатия узла, алгоритм для ответа выбирает отправитель запроса
+	Compression compress.Options
+	// вызывается по сигналу SHUTD, без него процесс завершается
+	OnShutdown func()
+	// собирает отчёт для ответа на MONIT, без него в отчёте только сообщение и NodeID
+	Report func() models.NodeReport
+	// получает отчёты REPOR, без него они пишутся в лог
+	OnReport func(src *net.UDPAddr, r models.NodeReport)
 }
 
-func (u UdpHandler) Handler(src *net.UDPAddr, n int, buf []byte) {
-	header, body := buf[:c.PrefLen], buf[c.PrefLen:n]
-	switch {
-	case bytes.Equal(header, c.PrefMessage):
-		u.messageHandler(src, body)
-	case bytes.Equal(header, c.PrefWelcome):
-		u.welcomeHandler(src, body)
-	case bytes.Equal(header, c.PrefReport):
-		u.reportHandler(src, body)
-	case bytes.Equal(header, c.PrefMonitoring):
-		u.monitoringHandler(src, body)
-	case bytes.Equal(header, c.PrefShutdown):
-		u.shutdownHandler(src, body)
-	case bytes.Equal(header, c.PrefHello):
-		u.helloHandler(src, body)
+// Register добавляет встроенные типы пакетов в реестр.
+// Обработчики читают поля u в момент вызова, поэтому Port можно задать позже.
+func (u *UdpHandler) Register(r *Registry) {
+	builtin := []struct {
+		prefix  []byte
+		handler func(UdpHandler, Packet)
+	}{
+		{c.PrefMessage, UdpHandler.messageHandler},
+		{c.PrefWelcome, UdpHandler.welcomeHandler},
+		{c.PrefReport, UdpHandler.reportHandler},
+		{c.PrefMonitoring, UdpHandler.monitoringHandler},
+		{c.PrefShutdown, UdpHandler.shutdownHandler},
+		{c.PrefHello, UdpHandler.helloHandler},
+		{c.PrefProbe, UdpHandler.probeHandler},
+		{c.PrefAlive, UdpHandler.aliveHandler},
+		{c.PrefLeave, UdpHandler.leaveHandler},
+		{c.PrefBanList, UdpHandler.banListHandler},
+		{c.PrefBanReport, UdpHandler.banReportHandler},
+		{c.PrefUnban, UdpHandler.unbanHandler},
+	}
+
+	for _, b := range builtin {
+		h := b.handler
+		err := r.Register(b.prefix, codec.Msgpack, func(p Packet) { h(*u, p) })
+		if err != nil {
+			u.lg().Error("can't register handler", logger.PacketType(b.prefix), logger.Err(err))
+		}
+	}
+
+	err := r.Register(c.PrefCompound, codec.Msgpack, func(p Packet) { u.compoundHandler(r, p) })
+	if err != nil {
+		u.lg().Error("can't register handler", logger.PacketType(c.PrefCompound), logger.Err(err))
 	}
 }
 
-func (u UdpHandler) messageHandler(src *net.UDPAddr, body []byte) {
+// compoundHandler разбирает COMPO на отдельные пакеты и отправляет их в обычную обработку
+func (u UdpHandler) compoundHandler(r *Registry, p Packet) {
+	frames, err := wire.SplitCompound(p.Body)
+	if err != nil {
+		u.packetLog(p).Warn("malformed compound packet", logger.Err(err))
+		u.penalize(p, models.OffenseMalformed)
+		return
+	}
+
+	for _, f := range frames {
+		if bytes.HasPrefix(f, c.PrefCompound) {
+			// вложенные составные пакеты не разворачиваются
+			continue
+		}
+		r.dispatchInner(p.Src, f)
+	}
+}
+
+func (u UdpHandler) messageHandler(p Packet) {
 	var msg models.Message
-	err := msgpack.Unmarshal(body, &msg)
+	err := p.Decode(&msg)
 	if err != nil {
-		log.Println("message unmarshal error ", err)
+		u.packetLog(p).Warn("message unmarshal failed", logger.Err(err))
+		u.penalize(p, models.OffenseMalformed)
 		return
 	}
-	log.Printf("msg %+v...", msg.GetPayload()[0:5])
+	u.packetLog(p).Debug("message received", logger.Hash(msg.GetHash()), logger.F("payload", preview(msg.GetPayload())))
 
-	if u.saveMessage(msg) {
+	if u.saveMessage(p, &msg) {
 		// после сохранения сообщения с большим хэшем рассылаем его всем известным пирам,
 		// что может привести к тому что некоторые получат множество копий одного и тоге же сообщения
 		u.Gossiper.SendMessage(msg)
 	}
 }
 
-func (u UdpHandler) welcomeHandler(src *net.UDPAddr, body []byte) {
+func (u UdpHandler) welcomeHandler(p Packet) {
 	var wp models.WelcomePack
-	err := msgpack.Unmarshal(body, &wp)
+	err := p.Decode(&wp)
 	if err != nil {
-		log.Println("welcome unmarshal error ", err)
+		u.packetLog(p).Warn("welcome unmarshal failed", logger.Err(err))
+		u.penalize(p, models.OffenseMalformed)
 		return
 	}
 
 	u.PeerStorage.Merge(wp.PeerList)
 
 	if !wp.Msg.IsEmpty() {
-		log.Printf("welcome msg %+v...", wp.Msg.GetPayload()[0:5])
-		u.saveMessage(wp.Msg)
+		u.packetLog(p).Debug("welcome message received", logger.Hash(wp.Msg.GetHash()), logger.F("payload", preview(wp.Msg.GetPayload())))
+		u.saveMessage(p, &wp.Msg)
 	}
 }
 
-func (u UdpHandler) saveMessage(msg models.Message) bool {
+// saveMessage заменяет SpanID сообщения участком узла, если трассировка включена
+func (u UdpHandler) saveMessage(p Packet, msg *models.Message) bool {
+	traced := u.Tracer != nil && len(msg.TraceID) > 0
+	if traced {
+		u.Tracer.Record(tracing.NewEvent(tracing.KindReceive, msg.TraceID, msg.SpanID, nil, msg.GetHash(), p.Src.String()))
+	}
+
 	if msg.IsValid() {
-		stored := u.MessageStorage.Set(msg)
+		parent := msg.SpanID
+		if traced {
+			msg.SpanID = models.NewSpanID()
+		}
+		stored := u.MessageStorage.Set(*msg)
 		if stored {
-			log.Printf("new message was set %+v", msg.GetPayload()[0:5])
+			u.packetLog(p).Info("new message was set", logger.Hash(msg.GetHash()), logger.F("payload", preview(msg.GetPayload())))
 		}
 		newHash := u.HashStorage.Add(msg.GetHash())
+		if newHash && traced {
+			u.Tracer.Record(tracing.NewEvent(tracing.KindAccept, msg.TraceID, msg.SpanID, parent, msg.GetHash(), p.Src.String()))
+		}
+		if newHash && u.Metrics != nil && msg.Created != 0 {
+			u.Metrics.Accepted(time.Since(time.Unix(0, msg.Created)))
+		}
+		if newHash && u.Events != nil {
+			u.Events.OnMessageAccepted(*msg)
+		}
 		return stored && newHash
 	} else {
-		log.Println("Invalid message")
+		u.packetLog(p).Warn("invalid message", logger.Hash(msg.GetHash()))
+		u.penalize(p, models.OffenseInvalid)
+		if u.Events != nil {
+			u.Events.OnMessageRejected(*msg, models.ErrInvalidChecksum)
+		}
 	}
 	return false
 }
 
-func (u UdpHandler) reportHandler(src *net.UDPAddr, body []byte) {
-	var msg models.Message
-	err := msgpack.Unmarshal(body, &msg)
+func (u UdpHandler) reportHandler(p Packet) {
+	var r models.NodeReport
+	err := p.Decode(&r)
 	if err != nil {
-		log.Println("report unmarshal error ", err)
+		u.packetLog(p).Warn("report unmarshal failed", logger.Err(err))
+		u.penalize(p, models.OffenseMalformed)
+		return
+	}
+	if u.OnReport != nil {
+		u.OnReport(p.Src, r)
 		return
 	}
-	log.Printf("%+v", msg)
+	u.packetLog(p).Info("report", logger.NodeID(r.NodeID), logger.Hash(r.Msg.GetHash()), logger.F("version", r.Version),
+		logger.F("uptime", r.Uptime.String()), logger.F("peers", r.PeerCount), logger.F("hashes", r.Hashes))
 }
 
-func (u UdpHandler) monitoringHandler(src *net.UDPAddr, body []byte) {
-	peer := models.Peer{IP: src.IP, Port: binary.LittleEndian.Uint16(body)}
+func (u UdpHandler) monitoringHandler(p Packet) {
+	peer, err := peerFromPacket(p)
+	if err != nil {
+		u.packetLog(p).Warn("malformed packet", logger.Err(err))
+		u.penalize(p, models.OffenseMalformed)
+		return
+	}
 	address := peer.ToString()
 
-	mb, err := msgpack.Marshal(u.MessageStorage.Get())
+	report := models.NodeReport{NodeID: u.NodeID, Msg: u.MessageStorage.Get()}
+	if u.Report != nil {
+		report = u.Report()
+	}
+	enc := u.replyEncoding(p)
+	payload, err := enc.Encode(c.PrefReport, report)
+	if err == nil && len(payload) > transport.MaxDatagramSize {
+		// больше всего места занимает список пиров, их число остаётся в PeerCount
+		report.Peers = nil
+		payload, err = enc.Encode(c.PrefReport, report)
+	}
 	if err != nil {
-		log.Println("monitoring marshal error ", err)
+		u.packetLog(p).Error("monitoring marshal failed", logger.Err(err))
 		return
 	}
-	payload := append(c.PrefReport, mb...)
-	transport.SendPayloadToUDP(address, payload)
+	u.send(address, payload)
 }
 
-func (u UdpHandler) helloHandler(src *net.UDPAddr, body []byte) {
-	peer := models.Peer{IP: src.IP, Port: binary.LittleEndian.Uint16(body)}
+func (u UdpHandler) helloHandler(p Packet) {
+	peer, err := peerFromPacket(p)
+	if err != nil {
+		u.packetLog(p).Warn("malformed packet", logger.Err(err))
+		u.penalize(p, models.OffenseMalformed)
+		return
+	}
 	address := peer.ToString()
 	u.PeerStorage.Add(peer)
+	u.Gossiper.SetPeerEncoding(peer, p.Codec, p.Accepts)
+
+	wp := models.WelcomePack{PeerList: u.PeerStorage.List(), Msg: u.MessageStorage.Get()}
+	payload, err := u.replyEncoding(p).Encode(c.PrefWelcome, wp)
+	if err != nil {
+		u.packetLog(p).Error("hello marshal failed", logger.Err(err))
+		return
+	}
+	u.send(address, payload)
+}
 
-	wb, err := msgpack.Marshal(models.WelcomePack{PeerList: u.PeerStorage.List(), Msg: u.MessageStorage.Get()})
+// LEAVE отправляет узел, который останавливается по /leave или Node.Leave,
+// чтобы пиры не ждали DeadTimeout
+func (u UdpHandler) leaveHandler(p Packet) {
+	peer, err := peerFromPacket(p)
 	if err != nil {
-		log.Println("hello marshal error ", err)
+		u.packetLog(p).Warn("malformed packet", logger.Err(err))
+		u.penalize(p, models.OffenseMalformed)
 		return
 	}
-	payload := append(c.PrefWelcome, wb...)
-	transport.SendPayloadToUDP(address, payload)
+	if !u.PeerStorage.Remove(peer) {
+		u.packetLog(p).Debug("unknown peer left")
+	}
 }
 
-func (u UdpHandler) shutdownHandler(src *net.UDPAddr, body []byte) {
-	log.Println("got shutdown signal")
+func (u UdpHandler) shutdownHandler(p Packet) {
+	u.packetLog(p).Warn("got shutdown signal")
+	if u.OnShutdown != nil {
+		u.OnShutdown()
+		return
+	}
 	os.Exit(2)
 }
+
+func (u UdpHandler) probeHandler(p Packet) {
+	peer, err := peerFromPacket(p)
+	if err != nil {
+		u.packetLog(p).Warn("malformed packet", logger.Err(err))
+		u.penalize(p, models.OffenseMalformed)
+		return
+	}
+	// раз пир нас проверяет, значит он жив
+	u.PeerStorage.Touch(peer)
+
+	u.Gossiper.SetPeerEncoding(peer, p.Codec, p.Accepts)
+
+	payload := u.replyEncoding(p).IdentityPacket(c.PrefAlive, u.Port, u.NodeID)
+	u.send(peer.ToString(), payload)
+}
+
+func (u UdpHandler) aliveHandler(p Packet) {
+	peer, err := peerFromPacket(p)
+	if err != nil {
+		u.packetLog(p).Warn("malformed packet", logger.Err(err))
+		u.penalize(p, models.OffenseMalformed)
+		return
+	}
+	u.PeerStorage.Touch(peer)
+}
+
+func (u UdpHandler) banListHandler(p Packet) {
+	peer, ok := u.adminPeer(p)
+	if !ok {
+		return
+	}
+
+	bans := []models.Ban{}
+	if u.Reputation != nil {
+		bans = u.Reputation.Bans()
+	}
+	payload, err := u.replyEncoding(p).Encode(c.PrefBanReport, bans)
+	if err != nil {
+		u.packetLog(p).Error("ban list marshal failed", logger.Err(err))
+		return
+	}
+	u.send(peer.ToString(), payload)
+}
+
+func (u UdpHandler) banReportHandler(p Packet) {
+	var bans []models.Ban
+	err := p.Decode(&bans)
+	if err != nil {
+		u.packetLog(p).Warn("ban report unmarshal failed", logger.Err(err))
+		u.penalize(p, models.OffenseMalformed)
+		return
+	}
+	u.packetLog(p).Info("ban report", logger.F("banned", len(bans)))
+	for _, b := range bans {
+		u.packetLog(p).Info("banned peer", logger.F("ip", b.IP), logger.F("until", b.Until.Format(time.RFC3339)), logger.F("reason", b.Reason))
+	}
+}
+
+// в теле UNBAN порт для ответа не нужен, передаётся только адрес
+func (u UdpHandler) unbanHandler(p Packet) {
+	if !transport.IsLocalIP(p.Src.IP) {
+		u.packetLog(p).Warn("admin commands are accepted only from local addresses")
+		return
+	}
+
+	var address string
+	if err := p.Decode(&address); err != nil {
+		u.packetLog(p).Warn("unban unmarshal failed", logger.Err(err))
+		return
+	}
+	ip := net.ParseIP(address)
+	if ip == nil {
+		u.packetLog(p).Warn("invalid address to unban", logger.F("ip", address))
+		return
+	}
+	if u.Reputation == nil || !u.Reputation.Unban(ip) {
+		u.packetLog(p).Info("address is not banned", logger.F("ip", ip))
+	}
+}
+
+// adminPeer проверяет, что команда пришла с этой же машины, и возвращает адрес для ответа
+func (u UdpHandler) adminPeer(p Packet) (models.Peer, bool) {
+	if !transport.IsLocalIP(p.Src.IP) {
+		u.packetLog(p).Warn("admin commands are accepted only from local addresses")
+		return models.Peer{}, false
+	}
+	peer, err := peerFromPacket(p)
+	if err != nil {
+		u.packetLog(p).Warn("malformed packet", logger.Err(err))
+		return models.Peer{}, false
+	}
+	return peer, true
+}
+
+func (u UdpHandler) penalize(p Packet, o models.Offense) {
+	if u.Metrics != nil {
+		switch o {
+		case models.OffenseInvalid:
+			u.Metrics.InvalidMessage()
+		case models.OffenseMalformed:
+			u.Metrics.DecodeError(p.Type)
+		}
+	}
+	if u.Reputation != nil {
+		u.Reputation.Penalize(p.Src.IP, o)
+	}
+}
+
+func (u UdpHandler) send(address string, payload []byte) {
+	var err error
+	if u.Batcher != nil {
+		err = u.Batcher.Send(address, payload)
+	} else {
+		err = transport.SendPayloadToUDP(address, payload)
+	}
+	if err != nil {
+		u.lg().Warn("reply failed", logger.Peer(address), logger.Err(err))
+	}
+}
+
+func (u UdpHandler) lg() logger.Logger {
+	return logger.Or(u.Log)
+}
+
+func (u UdpHandler) packetLog(p Packet) logger.Logger {
+	return u.lg().With(logger.PacketType(p.Type), logger.Peer(p.Src.String()))
+}
+
+// ответ кодируется тем кодеком и сжатием, которые просил отправитель
+func (u UdpHandler) replyEncoding(p Packet) wire.Encoding {
+	co := u.Compression
+	co.Algorithm = p.Accepts
+	return wire.Encoding{Codec: p.Codec, Compression: co, Accepts: u.Compression.Algorithm}
+}
+
+// пакеты HELLO, MONIT, PROBE, ALIVE и LEAVE несут в теле порт, на котором отправитель ждёт ответ,
+// а HELLO, PROBE, ALIVE и LEAVE после порта ещё и идентификатор узла
+func peerFromPacket(p Packet) (models.Peer, error) {
+	if len(p.Body) < 2 {
+		return models.Peer{}, errors.New(fmt.Sprintf("%s from %v: body is too short", p.Type, p.Src))
+	}
+	if len(p.Body) > 2+models.MaxNodeIDLen {
+		return models.Peer{}, errors.New(fmt.Sprintf("%s from %v: node id is too long", p.Type, p.Src))
+	}
+	return models.Peer{
+		IP:   p.Src.IP,
+		Port: binary.LittleEndian.Uint16(p.Body),
+		Zone: p.Src.Zone,
+		ID:   string(p.Body[2:]),
+	}, nil
+}
+
+// начало payload для логов, сообщение может быть короче пяти байт
+func preview(payload []byte) string {
+	if len(payload) > 5 {
+		payload = payload[:5]
+	}
+	return fmt.Sprintf("%x", payload)
+}
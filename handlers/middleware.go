@@ -0,0 +1,34 @@
+package handlers
+
+import (
+	"runtime/debug"
+
+	"github.com/DemonVex/hashgossip/logger"
+)
+
+// Middleware оборачивает обработчик пакетов: проверки доступа, ограничения,
+// метрики. Первый переданный в Use middleware выполняется первым.
+type Middleware func(next HandlerFunc) HandlerFunc
+
+// Recover не даёт панике в обработчике (например на битом теле пакета) уронить узел
+func Recover(lg logger.Logger) Middleware {
+	lg = logger.Or(lg)
+	return func(next HandlerFunc) HandlerFunc {
+		return func(p Packet) {
+			defer func() {
+				if r := recover(); r != nil {
+					lg.Error("panic in handler", logger.PacketType(p.Type), logger.Peer(p.Src.String()),
+						logger.F("panic", r), logger.F("stack", string(debug.Stack())))
+				}
+			}()
+			next(p)
+		}
+	}
+}
+
+func chain(h HandlerFunc, mws []Middleware) HandlerFunc {
+	for i := len(mws) - 1; i >= 0; i-- {
+		h = mws[i](h)
+	}
+	return h
+}
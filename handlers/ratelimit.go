@@ -0,0 +1,117 @@
+package handlers
+
+import (
+	"sync"
+
+	"github.com/DemonVex/hashgossip/logger"
+	"github.com/DemonVex/hashgossip/models"
+	"github.com/DemonVex/hashgossip/ratelimit"
+)
+
+// RateLimiter отбрасывает пакеты сверх лимита на адрес отправителя
+// и на пару адрес + тип пакета
+type RateLimiter struct {
+	limitsMutex *sync.Mutex
+	source      models.Limit
+	types       map[string]models.Limit
+	perSource   *ratelimit.Keyed
+	perType     map[string]*ratelimit.Keyed
+
+	mutex   *sync.Mutex
+	dropped map[string]uint64
+	onDrop  func(Packet)
+	log     logger.Logger
+}
+
+// нулевой Rate у source означает отсутствие общего лимита на адрес,
+// onDrop вызывается на каждый отброшенный пакет и может быть nil
+func NewRateLimiter(source models.Limit, types map[string]models.Limit, onDrop func(Packet), lg logger.Logger) *RateLimiter {
+	rl := &RateLimiter{
+		log:         logger.Or(lg),
+		limitsMutex: &sync.Mutex{},
+		mutex:       &sync.Mutex{},
+		dropped:     make(map[string]uint64),
+		onDrop:      onDrop,
+	}
+	rl.SetLimits(source, types)
+	return rl
+}
+
+// SetLimits меняет лимиты на лету. Баки лимитов, которые не изменились, сохраняются,
+// а у изменённых все адреса начинают с полным баком
+func (rl *RateLimiter) SetLimits(source models.Limit, types map[string]models.Limit) {
+	rl.limitsMutex.Lock()
+	defer rl.limitsMutex.Unlock()
+
+	if source != rl.source {
+		rl.perSource = nil
+		if source.Rate > 0 {
+			rl.perSource = ratelimit.NewKeyed(float64(source.Rate), source.Burst)
+		}
+	}
+	perType := make(map[string]*ratelimit.Keyed)
+	for t, l := range types {
+		if l.Rate <= 0 {
+			continue
+		}
+		if k, ok := rl.perType[t]; ok && rl.types[t] == l {
+			perType[t] = k
+		} else {
+			perType[t] = ratelimit.NewKeyed(float64(l.Rate), l.Burst)
+		}
+	}
+	rl.source, rl.types, rl.perType = source, types, perType
+}
+
+func (rl *RateLimiter) limits() (*ratelimit.Keyed, map[string]*ratelimit.Keyed) {
+	rl.limitsMutex.Lock()
+	defer rl.limitsMutex.Unlock()
+	return rl.perSource, rl.perType
+}
+
+func (rl *RateLimiter) Middleware() Middleware {
+	return func(next HandlerFunc) HandlerFunc {
+		return func(p Packet) {
+			source := p.Src.IP.String()
+			perSource, perType := rl.limits()
+			// лимит источника считает датаграммы, вложенные в COMPO пакеты им уже оплачены.
+			// Лимиты типов применяются к каждому пакету, иначе COMPO из сотни HELLO обходил бы их
+			if perSource != nil && !p.Inner && !perSource.Allow(source) {
+				rl.drop(p)
+				return
+			}
+			if k, ok := perType[string(p.Type)]; ok && !k.Allow(source) {
+				rl.drop(p)
+				return
+			}
+			next(p)
+		}
+	}
+}
+
+func (rl *RateLimiter) drop(p Packet) {
+	if rl.onDrop != nil {
+		rl.onDrop(p)
+	}
+
+	rl.mutex.Lock()
+	defer rl.mutex.Unlock()
+
+	rl.dropped[string(p.Type)]++
+	// первый отброшенный пакет каждой тысячи, чтобы флуд не превратился во флуд логов
+	if rl.dropped[string(p.Type)]%1000 == 1 {
+		rl.log.Warn("rate limit exceeded, packet dropped", logger.PacketType(p.Type), logger.Peer(p.Src.String()), logger.F("total", rl.dropped[string(p.Type)]))
+	}
+}
+
+// Dropped возвращает число отброшенных пакетов по типам
+func (rl *RateLimiter) Dropped() map[string]uint64 {
+	rl.mutex.Lock()
+	defer rl.mutex.Unlock()
+
+	dropped := make(map[string]uint64, len(rl.dropped))
+	for t, n := range rl.dropped {
+		dropped[t] = n
+	}
+	return dropped
+}
@@ -0,0 +1,179 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"sync"
+	"sync/atomic"
+
+	"github.com/DemonVex/hashgossip/codec"
+	"github.com/DemonVex/hashgossip/compress"
+	c "github.com/DemonVex/hashgossip/consts"
+	"github.com/DemonVex/hashgossip/logger"
+	"github.com/DemonVex/hashgossip/wire"
+)
+
+var (
+	ErrBadPrefix         = errors.New(fmt.Sprintf("packet type must be %v bytes long", c.PrefLen))
+	ErrAlreadyRegistered = errors.New("packet type is already registered")
+)
+
+// Packet действителен только во время вызова обработчика:
+// Type и Body ссылаются на буфер чтения, который переиспользуется
+type Packet struct {
+	Src   *net.UDPAddr
+	Type  []byte
+	Body  []byte
+	Codec codec.Codec
+	// сжатие, которое отправитель просит использовать в ответах ему
+	Accepts compress.Algorithm
+	// размер пакета на проводе вместе с заголовком
+	Size int
+	// пакет пришёл внутри COMPO, внешняя датаграмма уже посчитана и прошла лимит источника
+	Inner bool
+}
+
+func (p Packet) Decode(v interface{}) error {
+	return p.Codec.Unmarshal(p.Body, v)
+}
+
+type HandlerFunc func(Packet)
+
+type route struct {
+	codec   codec.Codec
+	handler HandlerFunc
+	// handler, обёрнутый в middleware
+	wrapped HandlerFunc
+}
+
+// Registry сопоставляет префикс пакета с обработчиком и кодеком его тела.
+// Встроенные типы регистрируются так же, как и пользовательские.
+type Registry struct {
+	mutex       *sync.RWMutex
+	routes      map[string]route
+	middlewares []Middleware
+	unknown     uint64
+	onMalformed func(src *net.UDPAddr, typ []byte)
+	log         logger.Logger
+}
+
+func NewRegistry(lg logger.Logger) *Registry {
+	return &Registry{mutex: &sync.RWMutex{}, routes: make(map[string]route), log: logger.Or(lg)}
+}
+
+func (r *Registry) Register(prefix []byte, cd codec.Codec, h HandlerFunc) error {
+	if len(prefix) != c.PrefLen {
+		return ErrBadPrefix
+	}
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if _, ok := r.routes[string(prefix)]; ok {
+		return ErrAlreadyRegistered
+	}
+	r.routes[string(prefix)] = route{codec: cd, handler: h, wrapped: chain(h, r.middlewares)}
+	return nil
+}
+
+// Use добавляет middleware ко всем уже зарегистрированным и будущим типам пакетов
+func (r *Registry) Use(mws ...Middleware) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	r.middlewares = append(r.middlewares, mws...)
+	for prefix, rt := range r.routes {
+		rt.wrapped = chain(rt.handler, r.middlewares)
+		r.routes[prefix] = rt
+	}
+}
+
+// OnMalformed задаёт функцию, которая вызывается на пакеты, не прошедшие разбор
+// заголовка, кодека или распаковки. Вызывается до middleware.
+// typ - тип пакета, nil если не разобрался даже заголовок.
+func (r *Registry) OnMalformed(f func(src *net.UDPAddr, typ []byte)) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.onMalformed = f
+}
+
+// Dispatch подходит как обработчик для transport.ServeUDP
+func (r *Registry) Dispatch(src *net.UDPAddr, n int, buf []byte) {
+	r.dispatch(src, buf[:n], false)
+}
+
+// dispatchInner обрабатывает пакет, вложенный в COMPO
+func (r *Registry) dispatchInner(src *net.UDPAddr, frame []byte) {
+	r.dispatch(src, frame, true)
+}
+
+func (r *Registry) dispatch(src *net.UDPAddr, buf []byte, inner bool) {
+	header, flags, body, err := wire.Unpack(buf)
+	if err == wire.ErrVersion {
+		// узел другой версии не злоумышленник, репутацию за это не снимаем
+		r.countUnknown(src, header)
+		r.log.Warn("packet of another wire version is dropped", logger.PacketType(header), logger.Peer(src.String()),
+			logger.F("version", wire.VersionOf(buf)), logger.F("expected", wire.Version))
+		return
+	}
+	if err != nil {
+		r.countUnknown(src, buf)
+		r.malformed(src, nil)
+		return
+	}
+
+	r.mutex.RLock()
+	rt, ok := r.routes[string(header)]
+	r.mutex.RUnlock()
+	if !ok {
+		r.countUnknown(src, header)
+		return
+	}
+
+	// отвечать и декодировать нужно тем кодеком, который выбрал отправитель
+	cd := rt.codec
+	if id := wire.CodecID(flags); id != codec.DefaultID {
+		if cd, ok = codec.ByID(id); !ok {
+			r.countUnknown(src, header)
+			r.malformed(src, header)
+			return
+		}
+	}
+
+	if alg := wire.BodyCompression(flags); alg != compress.None {
+		if body, err = compress.Decompress(alg, body); err != nil {
+			r.log.Warn("can't decompress packet", logger.PacketType(header), logger.Peer(src.String()), logger.Err(err))
+			r.countUnknown(src, header)
+			r.malformed(src, header)
+			return
+		}
+	}
+
+	rt.wrapped(Packet{Src: src, Type: header, Body: body, Codec: cd, Accepts: wire.AcceptedCompression(flags), Size: len(buf), Inner: inner})
+}
+
+func (r *Registry) countUnknown(src *net.UDPAddr, header []byte) {
+	total := atomic.AddUint64(&r.unknown, 1)
+	// на флуд мусором лог не должен расти, число таких пакетов есть в метриках
+	r.log.Debug("unknown packet", logger.F("header", fmt.Sprintf("%q", header)), logger.Peer(src.String()), logger.F("total", total))
+}
+
+func (r *Registry) malformed(src *net.UDPAddr, typ []byte) {
+	r.mutex.RLock()
+	f := r.onMalformed
+	r.mutex.RUnlock()
+	if f != nil {
+		f(src, typ)
+	}
+}
+
+// Unknown возвращает число пакетов неизвестного типа
+func (r *Registry) Unknown() uint64 {
+	return atomic.LoadUint64(&r.unknown)
+}
+
+// Encode собирает пакет из префикса и тела, закодированного cd (nil - msgpack), без сжатия
+func Encode(prefix []byte, cd codec.Codec, v interface{}) ([]byte, error) {
+	return wire.Encoding{Codec: cd}.Encode(prefix, v)
+}
@@ -0,0 +1,109 @@
+package handlers
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net"
+	"testing"
+
+	"github.com/DemonVex/hashgossip/codec"
+	c "github.com/DemonVex/hashgossip/consts"
+	"github.com/DemonVex/hashgossip/logger"
+	"github.com/DemonVex/hashgossip/models"
+	"github.com/DemonVex/hashgossip/wire"
+)
+
+func quietLogger(t *testing.T) logger.Logger {
+	lg, err := logger.New(ioutil.Discard, "", logger.ErrorLevel, logger.Sampling{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return lg
+}
+
+func TestDispatchRejectsOtherWireVersion(t *testing.T) {
+	var buf bytes.Buffer
+	lg, err := logger.New(&buf, logger.FormatLogfmt, logger.WarnLevel, logger.Sampling{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := NewRegistry(lg)
+	handled, malformed := 0, 0
+	r.Register(c.PrefHello, codec.Msgpack, func(Packet) { handled++ })
+	r.OnMalformed(func(*net.UDPAddr, []byte) { malformed++ })
+	src := &net.UDPAddr{IP: net.ParseIP("192.0.2.1"), Port: 7946}
+
+	packet := wire.Pack(c.PrefHello, 0, []byte{1, 2})
+	r.Dispatch(src, len(packet), packet)
+	if handled != 1 {
+		t.Fatalf("packet of the current version is not handled")
+	}
+
+	packet[c.PrefLen] = wire.Version + 1
+	r.Dispatch(src, len(packet), packet)
+	if handled != 1 {
+		t.Error("packet of another version reached the handler")
+	}
+	// другая версия - не повод снимать репутацию
+	if malformed != 0 {
+		t.Error("packet of another version is reported as malformed")
+	}
+	if r.Unknown() != 1 {
+		t.Errorf("Unknown() = %v, want 1", r.Unknown())
+	}
+	if !bytes.Contains(buf.Bytes(), []byte("another wire version")) {
+		t.Errorf("version mismatch is not logged, got %q", buf.String())
+	}
+}
+
+func TestDispatchShortPacketIsMalformed(t *testing.T) {
+	r := NewRegistry(quietLogger(t))
+	malformed := 0
+	r.OnMalformed(func(_ *net.UDPAddr, typ []byte) {
+		malformed++
+		if typ != nil {
+			t.Errorf("type of short packet = %q, want nil", typ)
+		}
+	})
+	r.Dispatch(&net.UDPAddr{IP: net.ParseIP("192.0.2.1")}, 3, []byte("HEL"))
+	if malformed != 1 {
+		t.Errorf("short packet is not reported as malformed")
+	}
+}
+
+func TestCompoundFramesChargeSourceOnce(t *testing.T) {
+	r := NewRegistry(quietLogger(t))
+	counted := map[string]int{}
+	r.Use(func(next HandlerFunc) HandlerFunc {
+		return func(p Packet) {
+			if !p.Inner {
+				counted[string(p.Type)]++
+			}
+			next(p)
+		}
+	})
+	// источник пропускает одну датаграмму, а тип HELLO - два пакета
+	limiter := NewRateLimiter(models.Limit{Rate: 0.001, Burst: 1},
+		map[string]models.Limit{"HELLO": {Rate: 0.001, Burst: 2}}, nil, quietLogger(t))
+	r.Use(limiter.Middleware())
+
+	handled := 0
+	r.Register(c.PrefHello, codec.Msgpack, func(Packet) { handled++ })
+	u := UdpHandler{Log: quietLogger(t)}
+	r.Register(c.PrefCompound, codec.Msgpack, func(p Packet) { u.compoundHandler(r, p) })
+
+	hello := wire.Pack(c.PrefHello, 0, []byte{1, 2})
+	packet := wire.Compound([][]byte{hello, hello, hello, hello})
+	r.Dispatch(&net.UDPAddr{IP: net.ParseIP("192.0.2.1"), Port: 7946}, len(packet), packet)
+
+	// COMPO из множества HELLO не должен обходить лимит типа
+	if handled != 2 {
+		t.Errorf("handled %v inner HELLO frames, want 2 allowed by the HELLO limit", handled)
+	}
+	if dropped := limiter.Dropped(); dropped["HELLO"] != 2 || dropped["COMPO"] != 0 {
+		t.Errorf("dropped %v, want 2 HELLO and no COMPO", dropped)
+	}
+	if counted["COMPO"] != 1 || counted["HELLO"] != 0 {
+		t.Errorf("counted %v, want only the outer COMPO once", counted)
+	}
+}
@@ -0,0 +1,28 @@
+package handlers
+
+import (
+	"bytes"
+	"sync/atomic"
+
+	c "github.com/DemonVex/hashgossip/consts"
+	"github.com/DemonVex/hashgossip/storages"
+)
+
+// Quarantine отбрасывает пакеты пиров, которые сейчас в карантине.
+// Команды BANLS и UNBAN пропускаются, чтобы узлы за тем же адресом, что и
+// нарушитель, могли снять карантин, доступ к ним проверяют сами обработчики.
+// dropped считает отброшенные пакеты, может быть nil.
+func Quarantine(rs storage.ReputationStorage, dropped *uint64) Middleware {
+	return func(next HandlerFunc) HandlerFunc {
+		return func(p Packet) {
+			admin := bytes.Equal(p.Type, c.PrefBanList) || bytes.Equal(p.Type, c.PrefUnban)
+			if !admin && rs.IsBanned(p.Src.IP) {
+				if dropped != nil {
+					atomic.AddUint64(dropped, 1)
+				}
+				return
+			}
+			next(p)
+		}
+	}
+}
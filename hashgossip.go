@@ -1,117 +1,813 @@
-package main
+package hashgossip
 
 import (
-	"encoding/binary"
-	"flag"
+	"context"
+	"errors"
 	"fmt"
-	"log"
+	"io"
 	"math/rand"
 	"net"
+	"net/http"
 	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
 	"time"
 
+	"github.com/DemonVex/hashgossip/codec"
+	"github.com/DemonVex/hashgossip/compress"
+	"github.com/DemonVex/hashgossip/config"
 	c "github.com/DemonVex/hashgossip/consts"
+	"github.com/DemonVex/hashgossip/events"
 	"github.com/DemonVex/hashgossip/handlers"
+	"github.com/DemonVex/hashgossip/logger"
 	"github.com/DemonVex/hashgossip/messenger"
+	"github.com/DemonVex/hashgossip/metrics"
 	m "github.com/DemonVex/hashgossip/models"
 	"github.com/DemonVex/hashgossip/storages"
+	"github.com/DemonVex/hashgossip/tracing"
 	"github.com/DemonVex/hashgossip/transport"
+	"github.com/DemonVex/hashgossip/wire"
+)
+
+// запас на заголовок пакета, контрольную сумму, трассу и разметку msgpack
+const MaxPayloadSize = transport.MaxDatagramSize - 192
 
-	"github.com/BurntSushi/toml"
+// файлы в DataDir помимо журналов хранилищ
+const (
+	nodeIDFile    = "node_id"
+	peerCacheFile = "peers.json"
 )
 
 var (
-	killerFlag  = flag.Bool("killer", false, "Send shutdown signal over multicast")
-	watcherFlag = flag.Bool("watcher", false, "Send monitoring signal over multicast and 10 sec receive results")
+	ErrPayloadTooLarge = errors.New(fmt.Sprintf("payload is larger than %v bytes", MaxPayloadSize))
+	ErrAlreadyStarted  = errors.New("node is already started")
+	// узел остановлен по сигналу SHUTD из кластера
+	ErrShutdownSignal = errors.New("got shutdown signal")
+)
+
+type (
+	EventDelegate = events.EventDelegate
+	HandlerFunc   = handlers.HandlerFunc
+	Middleware    = handlers.Middleware
+	Packet        = handlers.Packet
 )
 
-func main() {
-	rand.Seed(time.Now().UnixNano())
-	var conf m.Config
-	if _, err := toml.DecodeFile("config.toml", &conf); err != nil {
-		log.Fatal("can't read config file ", err)
+type Options struct {
+	Network          string
+	BindAddress      string
+	AdvertiseAddress string
+	Interface        string
+
+	MulticastAddress string
+	Multicast        transport.MulticastOptions
+	Seeds            []string
+	// кодек, которым узел кодирует свои пакеты и который просит использовать пиров
+	Codec codec.Codec
+	// сжатие, которое узел просит использовать пиров, и порог размера тела
+	Compression compress.Options
+	// исходящие пакеты к одному пиру объединяются в датаграмму до BatchMTU байт
+	// и ждут не дольше BatchLinger, нулевой BatchLinger отключает объединение
+	BatchMTU    int
+	BatchLinger time.Duration
+
+	// нулевые интервалы заменяются значениями config.Default()
+	ProbeInterval  time.Duration
+	SuspectTimeout time.Duration
+	DeadTimeout    time.Duration
+
+	// каталог для журнала сообщений и хэшей, кеша пиров и идентификатора узла,
+	// пустой - хранить только в памяти
+	DataDir string
+	// пустой NodeID берётся из DataDir, а без него генерируется при каждом запуске
+	NodeID string
+	// как часто сохранять известных пиров в DataDir и сколько доверять сохранённым.
+	// Нулевой PeerCacheInterval заменяется значением по умолчанию, нулевой
+	// PeerCacheMaxAge снимает ограничение на возраст
+	PeerCacheInterval time.Duration
+	PeerCacheMaxAge   time.Duration
+
+	// адрес HTTP API (host:port), пустой - API выключен. Без AdminAllowRemote
+	// принимается только loopback, а с ним обязателен AdminToken
+	AdminAddress     string
+	AdminToken       string
+	AdminAllowRemote bool
+
+	// лимиты на входящие пакеты и исходящие байты рассылки
+	RateLimit m.RateLimit
+
+	// штрафы за нарушения и карантин, нулевой Cooldown отключает карантин
+	Reputation m.Reputation
+
+	// получает события о пирах и сообщениях, вызывается не из горутины приёма пакетов
+	Events EventDelegate
+
+	// nil - logger.Default(). Все записи узла получают поле node_id
+	Logger logger.Logger
+
+	// получает события распространения сообщений, nil - трассировка выключена.
+	// Узел закрывает Tracer при остановке
+	Tracer tracing.Tracer
+
+	// перечитывает конфиг для ReloadConfig и POST /reload, nil - перезагрузка недоступна
+	LoadConfig func() (m.Config, error)
+	// конфиг, из которого OptionsFromConfig собрал настройки, с ним Reload сравнивает новый
+	config *m.Config
+
+	// генерировать случайные сообщения, как это делал узел до появления Publish
+	DemoMode        bool
+	LimitMessages   int
+	InvalidFrequent int
+}
+
+func OptionsFromConfig(conf m.Config) Options {
+	conf = config.WithDefaults(conf)
+	cd, ok := codec.ByName(conf.Codec)
+	if !ok {
+		cd = codec.Msgpack
+	}
+	co, err := compress.ParseMode(conf.Compression, conf.CompressionThreshold)
+	if err != nil {
+		logger.Default().Warn("bad compression config", logger.Err(err))
+	}
+	lg, err := loggerFromConfig(conf)
+	if err != nil {
+		logger.Default().Warn("bad log config, default logger is used", logger.Err(err))
+	}
+	tr, err := tracerFromConfig(conf, lg)
+	if err != nil {
+		logger.Or(lg).Warn("can't open trace file, tracing is disabled", logger.Err(err))
+	}
+
+	return Options{
+		Network:          conf.Network,
+		BindAddress:      conf.BindAddress,
+		AdvertiseAddress: conf.AdvertiseAddress,
+		Interface:        conf.Interface,
+		MulticastAddress: conf.MulticastAddress,
+		Multicast: transport.MulticastOptions{
+			Interfaces: conf.MulticastInterfaces,
+			TTL:        conf.MulticastTTL,
+			Loopback:   conf.MulticastLoopback,
+		},
+		Seeds:             conf.Seeds,
+		Codec:             cd,
+		Compression:       co,
+		BatchMTU:          conf.BatchMTU,
+		BatchLinger:       conf.BatchLinger.Duration,
+		ProbeInterval:     conf.ProbeInterval.Duration,
+		SuspectTimeout:    conf.SuspectTimeout.Duration,
+		DeadTimeout:       conf.DeadTimeout.Duration,
+		DataDir:           conf.DataDir,
+		NodeID:            conf.NodeID,
+		PeerCacheInterval: conf.PeerCacheInterval.Duration,
+		PeerCacheMaxAge:   conf.PeerCacheMaxAge.Duration,
+		AdminAddress:      conf.AdminAddress,
+		AdminToken:        conf.AdminToken,
+		AdminAllowRemote:  conf.AdminAllowRemote,
+		RateLimit:         conf.RateLimit,
+		Reputation:        conf.Reputation,
+		Logger:            lg,
+		Tracer:            tr,
+		DemoMode:          conf.DemoMode,
+		LimitMessages:     conf.LimitMessages,
+		InvalidFrequent:   conf.InvalidFrequent,
+		config:            &conf,
+	}
+}
+
+// loggerFromConfig пишет в stderr, при ошибке возвращает nil
+func loggerFromConfig(conf m.Config) (logger.Logger, error) {
+	level := logger.InfoLevel
+	if conf.LogLevel != "" {
+		var err error
+		if level, err = logger.ParseLevel(conf.LogLevel); err != nil {
+			return nil, err
+		}
+	}
+	sampling := logger.Sampling{First: conf.LogSampleFirst, Thereafter: conf.LogSampleThereafter}
+	return logger.New(os.Stderr, conf.LogFormat, level, sampling)
+}
+
+// tracerFromConfig возвращает nil, если не заданы ни TraceFile, ни TraceEndpoint
+func tracerFromConfig(conf m.Config, lg logger.Logger) (tracing.Tracer, error) {
+	var tracers []tracing.Tracer
+	if conf.TraceFile != "" {
+		t, err := tracing.NewFileTracer(conf.TraceFile, lg)
+		if err != nil {
+			return nil, err
+		}
+		tracers = append(tracers, t)
+	}
+	if conf.TraceEndpoint != "" {
+		tracers = append(tracers, tracing.NewOTLPTracer(conf.TraceEndpoint, lg))
+	}
+
+	switch len(tracers) {
+	case 0:
+		return nil, nil
+	case 1:
+		return tracers[0], nil
+	}
+	return tracing.Multi(tracers...), nil
+}
+
+type Node struct {
+	// первым полем ради выравнивания для atomic на 32-битных платформах
+	quarantined uint64
+
+	// защищает настройки, которые меняет Reload
+	mutex *sync.Mutex
+	opts  Options
+	// конфиг, с которым узел работает, nil если Options собраны не из конфига
+	conf *m.Config
+	id   string
+	self m.Peer
+
+	peers    storage.PeerStorage
+	messages storage.MessageStorage
+	hashes   storage.HashStorage
+	gossiper messenger.Gossiper
+	handler  handlers.UdpHandler
+	registry *handlers.Registry
+	limiter  *handlers.RateLimiter
+	// репутация пиров, quarantined считает отброшенные карантином пакеты
+	reputation storage.ReputationStorage
+	batcher    *transport.Batcher
+	events     *events.Dispatcher
+	metrics    *metrics.Metrics
+	subs       *subscriptions
+	log        logger.Logger
+	tracer     tracing.Tracer
+
+	started   time.Time
+	conn      *net.UDPConn
+	mcastConn *net.UDPConn
+	admin     *http.Server
+	cancel    context.CancelFunc
+	wg        *sync.WaitGroup
+	stopOnce  *sync.Once
+	// 1, если при остановке нужно разослать пирам LEAVE
+	leaving int32
+	done    chan struct{}
+	err     error
+}
+
+func NewNode(opts Options) *Node {
+	n := &Node{
+		mutex:    &sync.Mutex{},
+		opts:     opts,
+		id:       opts.NodeID,
+		messages: storage.NewMessageStorage(),
+		hashes:   storage.NewHashStorage(),
+		metrics:  metrics.New(),
+		wg:       &sync.WaitGroup{},
+		stopOnce: &sync.Once{},
+		done:     make(chan struct{}),
+	}
+
+	// Reload меняет конфиг узла, копия не даёт ему менять чужие Options
+	if opts.config != nil {
+		conf := *opts.config
+		n.conf = &conf
+	}
+
+	// идентификатор нужен логгеру, поэтому сохранённый в DataDir читается уже здесь
+	if n.id == "" && opts.DataDir != "" {
+		n.id, _ = storage.ReadNodeID(filepath.Join(opts.DataDir, nodeIDFile))
+	}
+	if n.id == "" {
+		n.id = m.NewNodeID()
+	}
+	n.log = logger.Or(opts.Logger).With(logger.NodeID(n.id))
+	if opts.Tracer != nil {
+		n.tracer = tracing.WithNode(opts.Tracer, n.id)
+	}
+	// карантин выключен, пока в Options.Reputation не задан Cooldown
+	n.reputation = storage.NewReputationStorage(opts.Reputation, transport.IsLocalIP, n.log)
+	n.subs = newSubscriptions(n.log)
+
+	delegates := []events.EventDelegate{n.subs}
+	if opts.Events != nil {
+		delegates = append(delegates, opts.Events)
+	}
+	n.events = events.NewDispatcher(256, n.log, delegates...)
+
+	n.peers = storage.NewPeerStorage(n.events, n.log)
+	if n.opts.Codec == nil {
+		n.opts.Codec = codec.Msgpack
+	}
+	def := config.Default()
+	if n.opts.Network == "" {
+		n.opts.Network = def.Network
+	}
+	if n.opts.BatchMTU <= 0 {
+		n.opts.BatchMTU = def.BatchMTU
+	}
+	// с нулевым интервалом не запустится ticker, а с нулевыми таймаутами Reap удалит всех пиров
+	for _, d := range []struct {
+		value *time.Duration
+		def   m.Duration
+	}{
+		{&n.opts.ProbeInterval, def.ProbeInterval},
+		{&n.opts.SuspectTimeout, def.SuspectTimeout},
+		{&n.opts.DeadTimeout, def.DeadTimeout},
+		{&n.opts.PeerCacheInterval, def.PeerCacheInterval},
+	} {
+		if *d.value <= 0 {
+			*d.value = d.def.Duration
+		}
+	}
+	n.batcher = transport.NewBatcher(n.opts.BatchMTU, n.opts.BatchLinger, n.log)
+	n.batcher.OnSend(n.countSent)
+	n.gossiper = messenger.NewGossiper(n.peers, n.encoding(), n.batcher, outboundBucket(n.opts.RateLimit.Outbound), n.tracer, n.log)
+	n.handler = handlers.UdpHandler{
+		PeerStorage:    n.peers,
+		MessageStorage: n.messages,
+		HashStorage:    n.hashes,
+		Gossiper:       n.gossiper,
+		Events:         n.events,
+		Reputation:     n.reputation,
+		Metrics:        n.metrics,
+		Batcher:        n.batcher,
+		OnShutdown:     func() { n.shutdown(ErrShutdownSignal) },
+		Report:         n.Report,
+		Compression:    opts.Compression,
+		Log:            n.log,
+		Tracer:         n.tracer,
+	}
+	n.registry = handlers.NewRegistry(n.log)
+	n.registry.Use(handlers.Recover(n.log))
+	// считаются все входящие датаграммы, в том числе отброшенные карантином и лимитами.
+	// Пакеты внутри COMPO не считаются, их байты уже учтены в COMPO
+	n.registry.Use(func(next handlers.HandlerFunc) handlers.HandlerFunc {
+		return func(p handlers.Packet) {
+			if !p.Inner {
+				n.metrics.PacketIn(p.Type, p.Size)
+			}
+			next(p)
+		}
+	})
+	n.registry.Use(handlers.Quarantine(n.reputation, &n.quarantined))
+	n.limiter = handlers.NewRateLimiter(opts.RateLimit.Source, opts.RateLimit.Types, func(p handlers.Packet) {
+		n.reputation.Penalize(p.Src.IP, m.OffenseRateLimit)
+	}, n.log)
+	n.registry.Use(n.limiter.Middleware())
+	n.registry.OnMalformed(func(src *net.UDPAddr, typ []byte) {
+		n.metrics.DecodeError(typ)
+		n.reputation.Penalize(src.IP, m.OffenseMalformed)
+	})
+	n.handler.Register(n.registry)
+	return n
+}
+
+// Start поднимает сокеты, рассылает приветствие и запускает фоновые горутины.
+// Узел работает до вызова Stop, сигнала SHUTD или отмены ctx.
+func (n *Node) Start(ctx context.Context) error {
+	if n.conn != nil {
+		return ErrAlreadyStarted
+	}
+
+	bindAddr, err := transport.ResolveBindAddr(n.opts.Network, n.opts.BindAddress)
+	if err != nil {
+		return err
+	}
+	advertiseIP, err := transport.ResolveAdvertiseIP(n.opts.Network, n.opts.AdvertiseAddress, n.opts.Interface, bindAddr)
+	if err != nil {
+		return err
+	}
+	if advertiseIP.IsLoopback() && n.opts.AdvertiseAddress == "" {
+		n.log.Warn("no routable address found, loopback is advertised; set AdvertiseAddress to reach other hosts", logger.F("advertise", advertiseIP))
+	}
+
+	if n.opts.DataDir != "" {
+		if err := n.openStorages(); err != nil {
+			return err
+		}
+	}
+
+	n.conn, err = net.ListenUDP(n.opts.Network, bindAddr)
+	if err != nil {
+		n.closeStorages()
+		return err
+	}
+	n.handler.Port = uint16(n.Addr().Port)
+	n.handler.NodeID = n.id
+	n.started = time.Now()
+
+	runCtx, cancel := context.WithCancel(ctx)
+	n.cancel = cancel
+	// диспетчер запускается до добавления первого пира, чтобы не потерять его событие
+	n.goRun(func() { n.events.StartLoop(runCtx) })
+
+	n.self = m.Peer{IP: advertiseIP, Port: n.handler.Port, ID: n.id}
+	n.peers.Add(n.self)
+	cached := n.cachedPeers()
+
+	n.mcastConn, err = transport.ListenMulticastUDP(n.opts.MulticastAddress, n.opts.Multicast, n.log)
+	if err != nil {
+		n.log.Warn("can't join multicast group, fallback to seeds", logger.Err(err))
+		n.mcastConn = nil
+		if len(n.opts.Seeds) == 0 && len(cached) == 0 {
+			err = errors.New("no seeds configured")
+			n.shutdown(err)
+			return err
+		}
+	}
+
+	detector := messenger.FailureDetector{
+		Peers:          n.peers,
+		Port:           n.handler.Port,
+		NodeID:         n.id,
+		Encoding:       n.encoding(),
+		Batcher:        n.batcher,
+		Interval:       n.opts.ProbeInterval,
+		SuspectTimeout: n.opts.SuspectTimeout,
+		DeadTimeout:    n.opts.DeadTimeout,
+		Log:            n.log,
+	}
+
+	n.goRun(func() { n.gossiper.StartLoop(runCtx) })
+	n.goRun(func() { detector.StartLoop(runCtx) })
+	n.goRun(func() { transport.ServeUDP(n.conn, n.registry.Dispatch, n.log) })
+	if n.mcastConn != nil {
+		n.goRun(func() { transport.ServeMulticastUDP(n.mcastConn, n.registry.Dispatch, n.log) })
+	}
+	if n.opts.DataDir != "" {
+		n.goRun(func() { n.savePeersLoop(runCtx) })
+	}
+	if n.opts.AdminAddress != "" {
+		if err := n.startAdmin(); err != nil {
+			n.shutdown(err)
+			return err
+		}
+	}
+
+	// строится сеть узлов каждый с каждым
+	// при этом каждый узел отвечает списком всех известных ему пиров,
+	// в то же время сложность слияния знакомых пиров и новых равна O(m*n),
+	// что в итоге приводит подключение нового пира в сеть очень тяжёлой операцией
+	// при большом количестве пиров
+	if err := n.join(cached); err != nil {
+		n.shutdown(err)
+		return err
 	}
 
-	flag.Parse()
-	if *killerFlag {
-		transport.SendPayloadToUDP(conf.MulticastAddress, c.PrefShutdown)
-		os.Exit(0)
+	if n.opts.DemoMode && n.opts.LimitMessages > 0 {
+		limit := rand.Intn(n.opts.LimitMessages)
+		n.goRun(func() { messenger.StartEmmitingMessages(runCtx, n.gossiper, limit, n.opts.InvalidFrequent, n.log) })
 	}
 
-	peerStorage := storage.NewPeerStorage()
-	messageStorage := storage.NewMessageStorage()
-	hashStorage := storage.NewHashStorage()
-	gossiper := messenger.NewGossiper(peerStorage)
+	go func() {
+		<-runCtx.Done()
+		n.shutdown(nil)
+	}()
 
-	udpHandler := handlers.UdpHandler{
-		PeerStorage:    peerStorage,
-		MessageStorage: messageStorage,
-		HashStorage:    hashStorage,
-		Gossiper:       gossiper,
+	return nil
+}
+
+// Stop останавливает все горутины узла и закрывает каналы подписчиков.
+// Если ctx истечёт раньше, возвращается его ошибка, а остановка продолжается в фоне.
+func (n *Node) Stop(ctx context.Context) error {
+	n.shutdown(nil)
+	return n.waitDone(ctx)
+}
+
+// Leave останавливает узел так же, как Stop, но перед этим сообщает пирам об уходе,
+// и они удаляют его сразу, не дожидаясь DeadTimeout
+func (n *Node) Leave(ctx context.Context) error {
+	atomic.StoreInt32(&n.leaving, 1)
+	n.shutdown(nil)
+	return n.waitDone(ctx)
+}
+
+func (n *Node) waitDone(ctx context.Context) error {
+	select {
+	case <-n.done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
 	}
-	go gossiper.StartLoop()
+}
+
+// Wait блокируется до полной остановки узла и возвращает её причину:
+// nil для Stop и отмены контекста, ErrShutdownSignal для сигнала из кластера.
+func (n *Node) Wait() error {
+	<-n.done
+	return n.err
+}
 
-	udpListener, err := net.ListenUDP("udp4", nil)
+// ID возвращает идентификатор узла, сохранённый в DataDir читается уже в NewNode
+func (n *Node) ID() string {
+	return n.id
+}
+
+// SetLogLevel меняет уровень логирования узла на лету
+func (n *Node) SetLogLevel(level logger.Level) {
+	n.log.SetLevel(level)
+}
+
+func (n *Node) LogLevel() logger.Level {
+	return n.log.Level()
+}
+
+// Addr возвращает адрес, на котором узел принимает UDP пакеты
+func (n *Node) Addr() *net.UDPAddr {
+	if n.conn == nil {
+		return nil
+	}
+	addr, _ := n.conn.LocalAddr().(*net.UDPAddr)
+	return addr
+}
+
+func (n *Node) goRun(f func()) {
+	n.wg.Add(1)
+	go func() {
+		defer n.wg.Done()
+		f()
+	}()
+}
+
+func (n *Node) shutdown(reason error) {
+	n.stopOnce.Do(func() {
+		n.err = reason
+		if n.cancel != nil {
+			n.cancel()
+		}
+		// закрытие сокетов прерывает ReadFromUDP в ServeUDP и ServeMulticastUDP
+		if n.conn != nil {
+			n.conn.Close()
+		}
+		if n.mcastConn != nil {
+			n.mcastConn.Close()
+		}
+		if n.admin != nil {
+			n.admin.Close()
+		}
+
+		// shutdown может быть вызван из обработчика пакетов,
+		// поэтому ждать его же горутину здесь нельзя
+		go func() {
+			n.wg.Wait()
+			n.batcher.Flush()
+			if atomic.LoadInt32(&n.leaving) == 1 {
+				n.announceLeave()
+			}
+			n.closeStorages()
+			if n.tracer != nil {
+				if err := n.tracer.Close(); err != nil {
+					n.log.Warn("tracer close failed", logger.Err(err))
+				}
+			}
+			n.subs.close()
+			close(n.done)
+		}()
+	})
+}
+
+// openStorages заменяет хранилища в памяти на восстановленные из DataDir
+func (n *Node) openStorages() error {
+	if err := os.MkdirAll(n.opts.DataDir, 0755); err != nil {
+		return err
+	}
+	if n.opts.NodeID == "" {
+		id, err := storage.LoadNodeID(filepath.Join(n.opts.DataDir, nodeIDFile), n.id)
+		if err != nil {
+			return err
+		}
+		n.id = id
+	}
+
+	messages, err := storage.NewFileMessageStorage(n.opts.DataDir, n.log)
 	if err != nil {
-		log.Fatal("can't start listen UDP ", err)
+		return err
+	}
+	hashes, err := storage.NewFileHashStorage(n.opts.DataDir, n.log)
+	if err != nil {
+		messages.(io.Closer).Close()
+		return err
+	}
+
+	n.messages, n.handler.MessageStorage = messages, messages
+	n.hashes, n.handler.HashStorage = hashes, hashes
+	return nil
+}
+
+func (n *Node) closeStorages() {
+	for _, s := range []interface{}{n.messages, n.hashes} {
+		if c, ok := s.(io.Closer); ok {
+			if err := c.Close(); err != nil {
+				n.log.Error("storage close failed", logger.Err(err))
+			}
+		}
 	}
-	defer udpListener.Close()
-	go transport.ServeUDP(udpListener, udpHandler.Handler)
+}
 
-	laddr, _ := udpListener.LocalAddr().(*net.UDPAddr)
+func (n *Node) peerCachePath() string {
+	return filepath.Join(n.opts.DataDir, peerCacheFile)
+}
 
-	if *watcherFlag {
-		payload := make([]byte, c.PrefLen+2)
-		copy(payload, c.PrefMonitoring)
-		binary.LittleEndian.PutUint16(payload[c.PrefLen:], uint16(laddr.Port))
+// cachedPeers возвращает сохранённых в DataDir пиров, кроме самого узла
+func (n *Node) cachedPeers() []m.Peer {
+	if n.opts.DataDir == "" {
+		return nil
+	}
+	cached, err := storage.LoadPeers(n.peerCachePath(), n.opts.PeerCacheMaxAge)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			n.log.Warn("can't load peer cache", logger.Err(err))
+		}
+		return nil
+	}
 
-		transport.SendPayloadToUDP(conf.MulticastAddress, payload)
-		time.Sleep(5 * time.Second)
-		os.Exit(0)
+	peers := cached[:0]
+	for _, p := range cached {
+		if p.Equal(n.self) || (p.ID != "" && p.ID == n.id) || n.peers.IsIn(p) {
+			continue
+		}
+		peers = append(peers, p)
 	}
+	return peers
+}
 
-	log.SetPrefix(fmt.Sprintf("[%v]", laddr.Port))
-	peerStorage.Add(m.Peer{IP: getOutboundIP(), Port: uint16(laddr.Port)})
-	go transport.ServeMulticastUDP(conf.MulticastAddress, udpHandler.Handler)
+// savePeersLoop сохраняет пиров раз в PeerCacheInterval и при остановке узла
+func (n *Node) savePeersLoop(ctx context.Context) {
+	ticker := time.NewTicker(n.opts.PeerCacheInterval)
+	defer ticker.Stop()
 
 	for {
-		// строится сеть узлов каждый с каждым
-		// при этом каждый узел отвечает списком всех известных ему пиров,
-		// в то же время сложность слияния знакомых пиров и новых равна O(m*n),
-		// что в итоге приводит подключение нового пира в сеть очень тяжёлой операцией
-		// при большом количестве пиров
-		ping(conf.MulticastAddress, laddr)
-		time.Sleep(1 * time.Second)
-		if !peerStorage.IsEmpty() {
-			break
+		select {
+		case <-ticker.C:
+			n.savePeers()
+		case <-ctx.Done():
+			n.savePeers()
+			return
 		}
 	}
+}
 
-	go messenger.StartEmmitingMessages(gossiper, rand.Intn(conf.LimitMessages), conf.InvalidFrequent)
+func (n *Node) savePeers() {
+	var peers []m.Peer
+	for _, p := range n.peers.List() {
+		// себя узел может знать и под другим адресом, например тем, с которого шёл multicast
+		if !p.Equal(n.self) && (n.id == "" || p.ID != n.id) {
+			peers = append(peers, p)
+		}
+	}
+	if err := storage.SavePeers(n.peerCachePath(), peers); err != nil {
+		n.log.Warn("can't save peer cache", logger.Err(err))
+	}
+}
 
-	select {}
+// encoding - то, как узел кодирует пакеты, пока получатель не попросил иного
+func (n *Node) encoding() wire.Encoding {
+	co := n.opts.Compression
+	co.Algorithm = compress.None
+	return wire.Encoding{Codec: n.opts.Codec, Compression: co, Accepts: n.opts.Compression.Algorithm}
 }
 
-func ping(address string, lAddr *net.UDPAddr) {
-	payload := make([]byte, c.PrefLen+2)
-	copy(payload, c.PrefHello)
-	binary.LittleEndian.PutUint16(payload[c.PrefLen:], uint16(lAddr.Port))
+func (n *Node) join(cached []m.Peer) error {
+	hello := n.encoding().IdentityPacket(c.PrefHello, n.handler.Port, n.id)
+
+	// сохранённые пиры отвечают сразу, не дожидаясь multicast
+	for _, p := range cached {
+		n.countSent(hello)
+		if err := transport.SendPayloadToUDP(p.ToString(), hello); err != nil {
+			n.log.Warn("cached peer is unreachable", logger.Peer(p.ToString()), logger.Err(err))
+		}
+	}
+
+	if n.mcastConn != nil {
+		n.countSent(hello)
+		if err := transport.SendMulticast(n.opts.MulticastAddress, n.opts.Multicast, hello, n.log); err != nil {
+			return err
+		}
+	}
+	n.greetSeeds(n.options().Seeds)
+	return nil
+}
+
+// announceLeave рассылает LEAVE всем известным пирам. Вызывается после закрытия
+// сокета, поэтому пакеты уходят с других портов, а в теле - порт, по которому нас знают
+func (n *Node) announceLeave() {
+	if n.conn == nil {
+		return
+	}
+	leave := n.encoding().IdentityPacket(c.PrefLeave, n.handler.Port, n.id)
+	for _, p := range n.peers.List() {
+		if p.Equal(n.self) {
+			continue
+		}
+		n.countSent(leave)
+		if err := transport.SendPayloadToUDP(p.ToString(), leave); err != nil {
+			n.log.Warn("can't say goodbye to peer", logger.Peer(p.ToString()), logger.Err(err))
+		}
+	}
+}
+
+// Handle регистрирует обработчик пользовательского типа пакетов.
+// prefix должен иметь длину consts.PrefLen и не совпадать со встроенными типами.
+func (n *Node) Handle(prefix []byte, cd codec.Codec, h HandlerFunc) error {
+	return n.registry.Register(prefix, cd, h)
+}
+
+// Use добавляет middleware в обработку всех входящих пакетов.
+// Recover, карантин и лимиты из Options.RateLimit подключены всегда и выполняются первыми.
+func (n *Node) Use(mws ...Middleware) {
+	n.registry.Use(mws...)
+}
 
-	err := transport.SendPayloadToUDP(address, payload)
+// SendTo отправляет пиру пакет пользовательского типа, nil cd - msgpack
+func (n *Node) SendTo(peer m.Peer, prefix []byte, cd codec.Codec, v interface{}) error {
+	payload, err := handlers.Encode(prefix, cd, v)
 	if err != nil {
-		log.Fatal(err)
+		return err
 	}
+	return transport.SendPayloadToUDP(peer.ToString(), payload)
 }
 
-// Get preferred outbound ip of this machine
-func getOutboundIP() net.IP {
-	conn, err := net.Dial("udp4", "8.8.8.8:80")
+// Peers возвращает известных узлу пиров, включая его самого
+func (n *Node) Peers() []m.Peer {
+	return n.peers.List()
+}
+
+// Publish сохраняет payload как сообщение узла и рассылает его всем известным пирам.
+// Возвращает контрольную сумму, по которой сообщение различают в кластере.
+func (n *Node) Publish(ctx context.Context, payload []byte) ([]byte, error) {
+	if len(payload) > MaxPayloadSize {
+		return nil, ErrPayloadTooLarge
+	}
+
+	// сообщение уходит в очередь рассылки, а буфер вызывающего может переиспользоваться
+	msg, err := m.NewMessage(append([]byte(nil), payload...))
 	if err != nil {
-		log.Fatal("can't get outbound IP ", err)
+		return nil, err
+	}
+	hash := msg.GetHash()
+
+	if !n.hashes.Add(hash) {
+		// такое сообщение уже есть в кластере
+		return hash, nil
+	}
+	n.messages.Set(msg)
+	if n.tracer != nil {
+		n.tracer.Record(tracing.NewEvent(tracing.KindPublish, msg.TraceID, msg.SpanID, nil, hash, ""))
+	}
+
+	return hash, n.gossiper.SendMessageContext(ctx, msg)
+}
+
+func (n *Node) countSent(packet []byte) {
+	if len(packet) >= c.PrefLen {
+		n.metrics.PacketOut(packet[:c.PrefLen], len(packet))
 	}
-	defer conn.Close()
+}
+
+// WriteMetrics выводит метрики узла в текстовом формате Prometheus
+func (n *Node) WriteMetrics(w io.Writer) error {
+	st := n.Stats()
+	labeled := []metrics.Labeled{
+		{Name: "hashgossip_rate_limited_total", Help: "Packets dropped by rate limits, by type.", Label: "type", Values: st.RateLimited},
+	}
+	gauges := []metrics.Gauge{
+		{Name: "hashgossip_unknown_packets_total", Help: "Packets of unknown type or failed to unpack.", Value: float64(st.UnknownPackets), Counter: true},
+		{Name: "hashgossip_quarantined_packets_total", Help: "Packets dropped from quarantined peers.", Value: float64(st.Quarantined), Counter: true},
+		{Name: "hashgossip_outbound_throttled_seconds_total", Help: "Time gossip waited for the outbound byte limit.", Value: st.OutboundThrottled.Seconds(), Counter: true},
+		{Name: "hashgossip_gossip_queue_length", Help: "Messages waiting to be gossiped.", Value: float64(n.gossiper.QueueLen())},
+		{Name: "hashgossip_peers", Help: "Known peers, including this node.", Value: float64(len(n.peers.List()))},
+		{Name: "hashgossip_hashes", Help: "Message hashes in the hash store.", Value: float64(n.hashes.Count())},
+		{Name: "hashgossip_banned_peers", Help: "Peers in quarantine.", Value: float64(len(n.reputation.Bans()))},
+	}
+	return n.metrics.Write(w, labeled, gauges)
+}
 
-	localAddr := conn.LocalAddr().(*net.UDPAddr)
+// Stats - счётчики узла для мониторинга
+type Stats struct {
+	// отброшенные лимитами входящие пакеты по типам
+	RateLimited map[string]uint64
+	// пакеты неизвестных типов
+	UnknownPackets uint64
+	// сколько рассылка простояла из-за лимита исходящих байт
+	OutboundThrottled time.Duration
+	// отброшенные пакеты пиров в карантине
+	Quarantined uint64
+}
+
+func (n *Node) Stats() Stats {
+	return Stats{
+		RateLimited:       n.limiter.Dropped(),
+		UnknownPackets:    n.registry.Unknown(),
+		OutboundThrottled: n.gossiper.Throttled(),
+		Quarantined:       atomic.LoadUint64(&n.quarantined),
+	}
+}
+
+// Bans возвращает пиров в карантине
+func (n *Node) Bans() []m.Ban {
+	return n.reputation.Bans()
+}
 
-	return localAddr.IP
+// Unban досрочно выпускает пира из карантина и возвращает ему полную репутацию
+func (n *Node) Unban(ip net.IP) bool {
+	return n.reputation.Unban(ip)
 }
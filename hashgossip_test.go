@@ -0,0 +1,26 @@
+package hashgossip
+
+import (
+	"testing"
+	"time"
+
+	"github.com/DemonVex/hashgossip/codec"
+	"github.com/DemonVex/hashgossip/config"
+	m "github.com/DemonVex/hashgossip/models"
+)
+
+func TestOptionsFromConfigUsesConfigDefaults(t *testing.T) {
+	opts := OptionsFromConfig(m.Config{LogLevel: "error", SuspectTimeout: m.Duration{Duration: 2 * time.Second}})
+	def := config.Default()
+
+	if opts.Network != def.Network || opts.Codec != codec.Msgpack || opts.Compression.Threshold != def.CompressionThreshold {
+		t.Errorf("Network, Codec, Threshold = %v, %v, %v, want defaults", opts.Network, opts.Codec.Name(), opts.Compression.Threshold)
+	}
+	if opts.ProbeInterval != def.ProbeInterval.Duration || opts.DeadTimeout != def.DeadTimeout.Duration ||
+		opts.PeerCacheInterval != def.PeerCacheInterval.Duration || opts.PeerCacheMaxAge != def.PeerCacheMaxAge.Duration {
+		t.Errorf("zero intervals are not defaulted: %+v", opts)
+	}
+	if opts.SuspectTimeout != 2*time.Second {
+		t.Errorf("SuspectTimeout = %v, want the set 2s", opts.SuspectTimeout)
+	}
+}
@@ -0,0 +1,66 @@
+package logger
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+func stringValue(v interface{}) string {
+	switch t := v.(type) {
+	case string:
+		return t
+	case error:
+		if t == nil {
+			return "<nil>"
+		}
+		return t.Error()
+	case fmt.Stringer:
+		return t.String()
+	}
+	return fmt.Sprint(v)
+}
+
+func appendLogfmt(buf []byte, fields []Field) []byte {
+	for i, f := range fields {
+		if i > 0 {
+			buf = append(buf, ' ')
+		}
+		buf = append(buf, f.Key...)
+		buf = append(buf, '=')
+
+		s := stringValue(f.Value)
+		if s == "" || strings.ContainsAny(s, " =\"\t\r\n") || !strconv.CanBackquote(s) {
+			buf = strconv.AppendQuote(buf, s)
+		} else {
+			buf = append(buf, s...)
+		}
+	}
+	return buf
+}
+
+func appendJSON(buf []byte, fields []Field) []byte {
+	buf = append(buf, '{')
+	for i, f := range fields {
+		if i > 0 {
+			buf = append(buf, ',')
+		}
+		buf = strconv.AppendQuote(buf, f.Key)
+		buf = append(buf, ':')
+
+		var value []byte
+		var err error
+		switch t := f.Value.(type) {
+		case error, fmt.Stringer:
+			value, err = json.Marshal(stringValue(t))
+		default:
+			value, err = json.Marshal(t)
+		}
+		if err != nil {
+			value, _ = json.Marshal(stringValue(f.Value))
+		}
+		buf = append(buf, value...)
+	}
+	return append(buf, '}')
+}
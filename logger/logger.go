@@ -0,0 +1,244 @@
+package logger
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+type Level int32
+
+const (
+	DebugLevel Level = iota
+	InfoLevel
+	WarnLevel
+	ErrorLevel
+)
+
+func (l Level) String() string {
+	switch l {
+	case DebugLevel:
+		return "debug"
+	case InfoLevel:
+		return "info"
+	case WarnLevel:
+		return "warn"
+	case ErrorLevel:
+		return "error"
+	}
+	return "unknown"
+}
+
+func ParseLevel(s string) (Level, error) {
+	switch strings.ToLower(s) {
+	case "debug":
+		return DebugLevel, nil
+	case "", "info":
+		return InfoLevel, nil
+	case "warn", "warning":
+		return WarnLevel, nil
+	case "error":
+		return ErrorLevel, nil
+	}
+	return InfoLevel, errors.New(fmt.Sprintf("unknown log level %q", s))
+}
+
+const (
+	FormatLogfmt = "logfmt"
+	FormatJSON   = "json"
+)
+
+type Field struct {
+	Key   string
+	Value interface{}
+}
+
+func F(key string, value interface{}) Field {
+	return Field{Key: key, Value: value}
+}
+
+// общие поля, чтобы один и тот же смысл везде назывался одинаково
+
+func Err(err error) Field {
+	return F("error", err)
+}
+
+func NodeID(id string) Field {
+	return F("node_id", id)
+}
+
+func Peer(address string) Field {
+	return F("peer", address)
+}
+
+func Hash(h []byte) Field {
+	return F("msg_hash", hex.EncodeToString(h))
+}
+
+func PacketType(t []byte) Field {
+	return F("packet_type", string(t))
+}
+
+type Logger interface {
+	Debug(msg string, fields ...Field)
+	Info(msg string, fields ...Field)
+	Warn(msg string, fields ...Field)
+	Error(msg string, fields ...Field)
+	// With возвращает логгер, который добавляет fields к каждой записи.
+	// Уровень у него общий с родителем.
+	With(fields ...Field) Logger
+	SetLevel(Level)
+	Level() Level
+}
+
+// Sampling ограничивает debug записи с одинаковым сообщением: в каждую секунду
+// пишутся первые First, а из остальных каждая Thereafter. Нулевой First отключает выборку.
+type Sampling struct {
+	First      int
+	Thereafter int
+}
+
+// core общий для логгера и всех, созданных через With
+type core struct {
+	level    int32
+	format   string
+	sampling Sampling
+
+	mutex   *sync.Mutex
+	w       io.Writer
+	sampled map[string]*sampleCounter
+}
+
+type sampleCounter struct {
+	second int64
+	count  int
+}
+
+type logger struct {
+	core   *core
+	fields []Field
+}
+
+func New(w io.Writer, format string, level Level, sampling Sampling) (Logger, error) {
+	switch format {
+	case "":
+		format = FormatLogfmt
+	case FormatLogfmt, FormatJSON:
+	default:
+		return nil, errors.New(fmt.Sprintf("unknown log format %q", format))
+	}
+	c := &core{
+		level:    int32(level),
+		format:   format,
+		sampling: sampling,
+		mutex:    &sync.Mutex{},
+		w:        w,
+		sampled:  make(map[string]*sampleCounter),
+	}
+	return &logger{core: c}, nil
+}
+
+var (
+	defaultMutex  = &sync.Mutex{}
+	defaultLogger Logger
+)
+
+func init() {
+	defaultLogger, _ = New(os.Stderr, FormatLogfmt, InfoLevel, Sampling{})
+}
+
+// Default используется там, где логгер не передан явно
+func Default() Logger {
+	defaultMutex.Lock()
+	defer defaultMutex.Unlock()
+	return defaultLogger
+}
+
+func SetDefault(l Logger) {
+	defaultMutex.Lock()
+	defer defaultMutex.Unlock()
+	defaultLogger = l
+}
+
+// Or возвращает l, а если он nil - логгер по умолчанию
+func Or(l Logger) Logger {
+	if l == nil {
+		return Default()
+	}
+	return l
+}
+
+func (l *logger) Debug(msg string, fields ...Field) { l.log(DebugLevel, msg, fields) }
+func (l *logger) Info(msg string, fields ...Field)  { l.log(InfoLevel, msg, fields) }
+func (l *logger) Warn(msg string, fields ...Field)  { l.log(WarnLevel, msg, fields) }
+func (l *logger) Error(msg string, fields ...Field) { l.log(ErrorLevel, msg, fields) }
+
+func (l *logger) With(fields ...Field) Logger {
+	all := make([]Field, 0, len(l.fields)+len(fields))
+	all = append(all, l.fields...)
+	all = append(all, fields...)
+	return &logger{core: l.core, fields: all}
+}
+
+func (l *logger) SetLevel(level Level) {
+	atomic.StoreInt32(&l.core.level, int32(level))
+}
+
+func (l *logger) Level() Level {
+	return Level(atomic.LoadInt32(&l.core.level))
+}
+
+func (l *logger) log(level Level, msg string, fields []Field) {
+	if level < l.Level() {
+		return
+	}
+	now := time.Now()
+
+	l.core.mutex.Lock()
+	defer l.core.mutex.Unlock()
+
+	if level == DebugLevel && !l.core.sample(msg, now) {
+		return
+	}
+
+	all := make([]Field, 0, 3+len(l.fields)+len(fields))
+	all = append(all, F("time", now.UTC().Format(time.RFC3339Nano)), F("level", level.String()), F("msg", msg))
+	all = append(all, l.fields...)
+	all = append(all, fields...)
+
+	var line []byte
+	if l.core.format == FormatJSON {
+		line = appendJSON(nil, all)
+	} else {
+		line = appendLogfmt(nil, all)
+	}
+	l.core.w.Write(append(line, '\n'))
+}
+
+func (c *core) sample(msg string, now time.Time) bool {
+	if c.sampling.First <= 0 {
+		return true
+	}
+
+	second := now.Unix()
+	s, ok := c.sampled[msg]
+	if !ok || s.second != second {
+		if len(c.sampled) > 1024 {
+			// сообщения обычно постоянные строки, но на случай динамических
+			c.sampled = make(map[string]*sampleCounter)
+		}
+		s = &sampleCounter{second: second}
+		c.sampled[msg] = s
+	}
+	s.count++
+	if s.count <= c.sampling.First {
+		return true
+	}
+	return c.sampling.Thereafter > 0 && (s.count-c.sampling.First)%c.sampling.Thereafter == 0
+}
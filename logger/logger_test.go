@@ -0,0 +1,240 @@
+package logger
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newTest(t *testing.T, format string, level Level, sampling Sampling) (*logger, *bytes.Buffer) {
+	t.Helper()
+	var buf bytes.Buffer
+	l, err := New(&buf, format, level, sampling)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return l.(*logger), &buf
+}
+
+func lines(buf *bytes.Buffer) []string {
+	s := strings.TrimSuffix(buf.String(), "\n")
+	if s == "" {
+		return nil
+	}
+	return strings.Split(s, "\n")
+}
+
+func TestParseLevel(t *testing.T) {
+	for s, want := range map[string]Level{"": InfoLevel, "debug": DebugLevel, "INFO": InfoLevel, "warning": WarnLevel, "error": ErrorLevel} {
+		if got, err := ParseLevel(s); err != nil || got != want {
+			t.Errorf("ParseLevel(%q) = %v, %v, want %v", s, got, err, want)
+		}
+	}
+	if _, err := ParseLevel("trace"); err == nil {
+		t.Error("ParseLevel(trace) succeeded")
+	}
+	if _, err := New(&bytes.Buffer{}, "xml", InfoLevel, Sampling{}); err == nil {
+		t.Error("New with unknown format succeeded")
+	}
+}
+
+func TestLevelFiltering(t *testing.T) {
+	l, buf := newTest(t, FormatLogfmt, WarnLevel, Sampling{})
+	l.Debug("debug")
+	l.Info("info")
+	l.Warn("warn")
+	l.Error("error")
+	got := lines(buf)
+	if len(got) != 2 || !strings.Contains(got[0], "level=warn") || !strings.Contains(got[1], "level=error") {
+		t.Errorf("at warn level got %q", got)
+	}
+}
+
+func TestSetLevelIsSharedWithChildren(t *testing.T) {
+	l, buf := newTest(t, FormatLogfmt, InfoLevel, Sampling{})
+	child := l.With(NodeID("a"))
+	grandchild := child.With(Peer("10.0.0.1:1"))
+
+	// уровень, изменённый у потомка, меняется у всех
+	grandchild.SetLevel(DebugLevel)
+	l.Debug("parent")
+	if l.Level() != DebugLevel || len(lines(buf)) != 1 {
+		t.Fatalf("parent level %v after child SetLevel, got %q", l.Level(), lines(buf))
+	}
+
+	buf.Reset()
+	l.SetLevel(ErrorLevel)
+	child.Warn("child")
+	grandchild.Info("grandchild")
+	if child.Level() != ErrorLevel || len(lines(buf)) != 0 {
+		t.Errorf("children level %v after parent SetLevel, got %q", child.Level(), lines(buf))
+	}
+
+	grandchild.Error("grandchild")
+	got := lines(buf)
+	if len(got) != 1 || !strings.Contains(got[0], "node_id=a peer=10.0.0.1:1") {
+		t.Errorf("grandchild fields are lost: %q", got)
+	}
+	// With не меняет поля родителя
+	buf.Reset()
+	l.Error("parent")
+	if strings.Contains(buf.String(), "node_id") {
+		t.Errorf("parent got child fields: %q", buf.String())
+	}
+}
+
+func TestSample(t *testing.T) {
+	l, _ := newTest(t, FormatLogfmt, DebugLevel, Sampling{First: 2, Thereafter: 3})
+	now := time.Unix(1000, 0)
+
+	var passed []int
+	for i := 1; i <= 10; i++ {
+		if l.core.sample("msg", now) {
+			passed = append(passed, i)
+		}
+	}
+	if fmt.Sprint(passed) != "[1 2 5 8]" {
+		t.Errorf("passed %v of 10, want first 2 and then every 3rd", passed)
+	}
+	// у другого сообщения свой счётчик
+	if !l.core.sample("other", now) {
+		t.Error("first record of another message is dropped")
+	}
+	// в следующую секунду счёт начинается заново
+	if !l.core.sample("msg", now.Add(time.Second)) || !l.core.sample("msg", now.Add(time.Second)) {
+		t.Error("counter is not reset in the next second")
+	}
+}
+
+func TestSampleWithoutThereafter(t *testing.T) {
+	l, _ := newTest(t, FormatLogfmt, DebugLevel, Sampling{First: 1})
+	now := time.Unix(1000, 0)
+	if !l.core.sample("msg", now) || l.core.sample("msg", now) || l.core.sample("msg", now) {
+		t.Error("with Thereafter 0 only the first record per second must pass")
+	}
+
+	off, _ := newTest(t, FormatLogfmt, DebugLevel, Sampling{})
+	for i := 0; i < 1000; i++ {
+		if !off.core.sample("msg", now) {
+			t.Fatal("sampling with First 0 drops records")
+		}
+	}
+}
+
+func TestSampleResetsManyMessages(t *testing.T) {
+	l, _ := newTest(t, FormatLogfmt, DebugLevel, Sampling{First: 1})
+	now := time.Unix(1000, 0)
+	for i := 0; i <= 1024; i++ {
+		l.core.sample(fmt.Sprint("peer ", i, " is slow"), now)
+	}
+	if len(l.core.sampled) != 1025 {
+		t.Fatalf("tracked %v messages, want 1025", len(l.core.sampled))
+	}
+	// динамические сообщения не копятся бесконечно
+	l.core.sample("one more", now)
+	if len(l.core.sampled) != 1 {
+		t.Errorf("tracked %v messages after reset, want 1", len(l.core.sampled))
+	}
+}
+
+func TestSamplingOnlyDebug(t *testing.T) {
+	l, buf := newTest(t, FormatLogfmt, DebugLevel, Sampling{First: 1})
+	for i := 0; i < 5; i++ {
+		l.Warn("same")
+	}
+	if n := len(lines(buf)); n != 5 {
+		t.Errorf("wrote %v of 5 warnings, sampling must apply only to debug", n)
+	}
+}
+
+type stringer struct{}
+
+func (stringer) String() string { return "from String" }
+
+func TestLogfmtEscaping(t *testing.T) {
+	l, buf := newTest(t, FormatLogfmt, InfoLevel, Sampling{})
+	l.Info("peer joined",
+		F("plain", "abc"),
+		F("empty", ""),
+		F("space", "a b"),
+		F("quote", `say "hi"`),
+		F("equals", "a=b"),
+		F("newline", "a\nb"),
+		F("control", "a\x01b"),
+		F("int", 42),
+		F("ip", net.IPv4(10, 0, 0, 1)),
+		F("stringer", stringer{}),
+		Err(errors.New("connection refused")),
+		F("nil_error", error(nil)),
+	)
+	line := buf.String()
+	if strings.Count(line, "\n") != 1 {
+		t.Fatalf("value with newline broke the line: %q", line)
+	}
+	for _, want := range []string{
+		`msg="peer joined"`,
+		` plain=abc `,
+		` empty="" `,
+		` space="a b" `,
+		` quote="say \"hi\"" `,
+		` equals="a=b" `,
+		` newline="a\nb" `,
+		` control="a\x01b" `,
+		` int=42 `,
+		` ip=10.0.0.1 `,
+		` stringer="from String" `,
+		` error="connection refused" `,
+		` nil_error=<nil>`,
+	} {
+		if !strings.Contains(line, want) {
+			t.Errorf("logfmt line %q does not contain %q", line, want)
+		}
+	}
+}
+
+func TestJSONEscaping(t *testing.T) {
+	l, buf := newTest(t, FormatJSON, InfoLevel, Sampling{})
+	l.With(NodeID("a")).Warn(`bad "packet"`,
+		F("quote", `say "hi"`),
+		F("newline", "a\nb"),
+		F("int", 42),
+		F("list", []string{"x", "y"}),
+		F("stringer", stringer{}),
+		Err(errors.New("connection refused")),
+		// значение, которое json не умеет, пишется строкой
+		F("func", func() {}),
+	)
+	var got map[string]interface{}
+	if err := json.Unmarshal(buf.Bytes(), &got); err != nil {
+		t.Fatalf("invalid JSON %q: %v", buf.String(), err)
+	}
+	want := map[string]interface{}{
+		"level":    "warn",
+		"msg":      `bad "packet"`,
+		"node_id":  "a",
+		"quote":    `say "hi"`,
+		"newline":  "a\nb",
+		"int":      float64(42),
+		"stringer": "from String",
+		"error":    "connection refused",
+	}
+	for k, v := range want {
+		if got[k] != v {
+			t.Errorf("%v = %#v, want %#v", k, got[k], v)
+		}
+	}
+	if list, ok := got["list"].([]interface{}); !ok || len(list) != 2 {
+		t.Errorf("list = %#v, want a JSON array", got["list"])
+	}
+	if s, ok := got["func"].(string); !ok || s == "" {
+		t.Errorf("func = %#v, want a string", got["func"])
+	}
+	if _, err := time.Parse(time.RFC3339Nano, fmt.Sprint(got["time"])); err != nil {
+		t.Errorf("time = %v: %v", got["time"], err)
+	}
+}
@@ -0,0 +1,53 @@
+package messenger
+
+import (
+	"context"
+	"time"
+
+	"github.com/DemonVex/hashgossip/consts"
+	"github.com/DemonVex/hashgossip/logger"
+	"github.com/DemonVex/hashgossip/storages"
+	"github.com/DemonVex/hashgossip/transport"
+	"github.com/DemonVex/hashgossip/wire"
+)
+
+// FailureDetector раз в Interval рассылает PROBE всем известным пирам.
+// Ответ ALIVE (как и любой PROBE от пира) обновляет время последнего контакта,
+// а пиры, молчащие дольше SuspectTimeout и DeadTimeout, становятся suspect и удаляются.
+type FailureDetector struct {
+	Peers          storage.PeerStorage
+	Port           uint16
+	NodeID         string
+	Encoding       wire.Encoding
+	Batcher        *transport.Batcher
+	Interval       time.Duration
+	SuspectTimeout time.Duration
+	DeadTimeout    time.Duration
+	Log            logger.Logger
+}
+
+func (d FailureDetector) StartLoop(ctx context.Context) {
+	lg := logger.Or(d.Log)
+	ticker := time.NewTicker(d.Interval)
+	defer ticker.Stop()
+
+	// флаги в PROBE сообщают пирам, каким кодеком и сжатием с нами общаться
+	payload := d.Encoding.IdentityPacket(consts.PrefProbe, d.Port, d.NodeID)
+
+	for {
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return
+		}
+
+		d.Peers.Reap(d.SuspectTimeout, d.DeadTimeout)
+
+		// рассылка всем пирам каждый интервал даёт O(n^2) пакетов на кластер
+		for _, p := range d.Peers.List() {
+			if err := d.Batcher.Send(p.ToString(), payload); err != nil {
+				lg.Warn("probe failed", logger.Peer(p.ToString()), logger.Err(err))
+			}
+		}
+	}
+}
@@ -1,10 +1,11 @@
 package messenger
 
 import (
-	"log"
+	"context"
 	"math/rand"
 	"time"
 
+	"github.com/DemonVex/hashgossip/logger"
 	"github.com/DemonVex/hashgossip/models"
 )
 
@@ -15,14 +16,19 @@ func newRandomMessage(n int) (models.Message, error) {
 	return models.NewMessage(msgPayload)
 }
 
-func StartEmmitingMessages(g Gossiper, n int, invalidFreq int) {
+func StartEmmitingMessages(ctx context.Context, g Gossiper, n int, invalidFreq int, lg logger.Logger) {
+	lg = logger.Or(lg)
 	for n > 0 {
-		time.Sleep(time.Duration(rand.Intn(10)) * time.Second)
+		select {
+		case <-time.After(time.Duration(rand.Intn(10)) * time.Second):
+		case <-ctx.Done():
+			return
+		}
 		n -= 1
 
 		msg, err := newRandomMessage(32)
 		if err != nil {
-			log.Println(err)
+			lg.Error("can't create message", logger.Err(err))
 			continue
 		}
 
@@ -30,7 +36,7 @@ func StartEmmitingMessages(g Gossiper, n int, invalidFreq int) {
 			rand.Read(msg.Payload)
 		}
 
-		g.SendMessage(msg)
+		g.SendMessageContext(ctx, msg)
 	}
-	log.Println("Finish emmiting")
+	lg.Info("finish emitting")
 }
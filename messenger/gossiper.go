@@ -1,52 +1,183 @@
 package messenger
 
 import (
-	"log"
-
-	"github.com/vmihailenco/msgpack"
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
 
+	"github.com/DemonVex/hashgossip/codec"
+	"github.com/DemonVex/hashgossip/compress"
 	"github.com/DemonVex/hashgossip/consts"
+	"github.com/DemonVex/hashgossip/logger"
 	"github.com/DemonVex/hashgossip/models"
+	"github.com/DemonVex/hashgossip/ratelimit"
 	"github.com/DemonVex/hashgossip/storages"
+	"github.com/DemonVex/hashgossip/tracing"
 	"github.com/DemonVex/hashgossip/transport"
+	"github.com/DemonVex/hashgossip/wire"
 )
 
 type gossiper struct {
-	peers storage.PeerStorage
-	ch    chan []byte
+	// первым полем ради выравнивания для atomic на 32-битных платформах
+	throttled int64
+
+	peers   storage.PeerStorage
+	ch      chan models.Message
+	batcher *transport.Batcher
+	// общий лимит исходящих байт, nil - без ограничения
+	outboundMutex *sync.Mutex
+	outbound      *ratelimit.Bucket
+	// получает событие forward на каждую отправку сообщения с трассой, nil - без трассировки
+	tracer tracing.Tracer
+	log    logger.Logger
+
+	encoding   wire.Encoding
+	prefsMutex *sync.Mutex
+	prefs      map[string]wire.Encoding
 }
 
 type Gossiper interface {
-	StartLoop()
+	StartLoop(context.Context)
 	SendMessage(models.Message) error
+	SendMessageContext(context.Context, models.Message) error
+	// запоминает кодек и сжатие, которые пир просит использовать для него
+	SetPeerEncoding(models.Peer, codec.Codec, compress.Algorithm)
+	// суммарное время, которое рассылка простояла из-за лимита исходящих байт
+	Throttled() time.Duration
+	// сколько сообщений ждут рассылки
+	QueueLen() int
+	// меняет лимит исходящих байт, nil снимает ограничение
+	SetOutbound(*ratelimit.Bucket)
 }
 
-func NewGossiper(ps storage.PeerStorage) Gossiper {
-	return &gossiper{peers: ps, ch: make(chan []byte, 10)}
+// enc используется для пиров, чьи предпочтения ещё неизвестны
+func NewGossiper(ps storage.PeerStorage, enc wire.Encoding, b *transport.Batcher, outbound *ratelimit.Bucket, tr tracing.Tracer, lg logger.Logger) Gossiper {
+	return &gossiper{
+		tracer:        tr,
+		log:           logger.Or(lg),
+		peers:         ps,
+		ch:            make(chan models.Message, 10),
+		batcher:       b,
+		outboundMutex: &sync.Mutex{},
+		outbound:      outbound,
+		encoding:      enc,
+		prefsMutex:    &sync.Mutex{},
+		prefs:         make(map[string]wire.Encoding),
+	}
 }
 
-func (g *gossiper) StartLoop() {
+func (g *gossiper) StartLoop(ctx context.Context) {
 	for {
-		mb := <-g.ch
-		payload := append(consts.PrefMessage, mb...)
+		var msg models.Message
+		select {
+		case msg = <-g.ch:
+		case <-ctx.Done():
+			return
+		}
 
+		// сообщение кодируется один раз для каждого варианта кодека и сжатия
+		payloads := make(map[wire.Encoding][]byte)
 		for _, p := range g.peers.List() {
-			err := transport.SendPayloadToUDP(p.ToString(), payload)
+			enc := g.peerEncoding(p)
+			payload, ok := payloads[enc]
+			if !ok {
+				var err error
+				if payload, err = encodeMessage(enc, msg); err != nil {
+					g.log.Error("can't encode message", logger.Hash(msg.GetHash()), logger.Err(err))
+					continue
+				}
+				payloads[enc] = payload
+			}
+
+			if outbound := g.outboundLimit(); outbound != nil {
+				wait, err := outbound.WaitN(ctx, len(payload))
+				atomic.AddInt64(&g.throttled, int64(wait))
+				if err != nil {
+					return
+				}
+			}
+			err := g.batcher.Send(p.ToString(), payload)
 			if err != nil {
-				log.Println(err)
+				g.log.Warn("gossip send failed", logger.Peer(p.ToString()), logger.Hash(msg.GetHash()), logger.Err(err))
+				continue
+			}
+			if g.tracer != nil && len(msg.TraceID) > 0 {
+				g.tracer.Record(tracing.NewEvent(tracing.KindForward, msg.TraceID, msg.SpanID, nil, msg.GetHash(), p.ToString()))
 			}
 		}
 	}
 }
 
 func (g *gossiper) SendMessage(msg models.Message) error {
-	mb, err := msgpack.Marshal(msg)
-	if err != nil {
+	return g.SendMessageContext(context.Background(), msg)
+}
+
+func (g *gossiper) SendMessageContext(ctx context.Context, msg models.Message) error {
+	// проверка, что сообщение вообще можно закодировать и оно влезет в датаграмму
+	if _, err := encodeMessage(g.encoding, msg); err != nil {
 		return err
 	}
 	// если буфер канала заполнится и горутина заблокируется,
 	// то узел не сможет отвечать из-за того,
 	// что обработка входящих сообщений выполняется в одной горутине
-	g.ch <- mb
-	return nil
+	select {
+	case g.ch <- msg:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (g *gossiper) SetPeerEncoding(p models.Peer, cd codec.Codec, alg compress.Algorithm) {
+	enc := g.encoding
+	enc.Codec = cd
+	enc.Compression.Algorithm = alg
+
+	g.prefsMutex.Lock()
+	defer g.prefsMutex.Unlock()
+	g.prefs[p.ToString()] = enc
+}
+
+func (g *gossiper) SetOutbound(b *ratelimit.Bucket) {
+	g.outboundMutex.Lock()
+	defer g.outboundMutex.Unlock()
+	g.outbound = b
+}
+
+func (g *gossiper) outboundLimit() *ratelimit.Bucket {
+	g.outboundMutex.Lock()
+	defer g.outboundMutex.Unlock()
+	return g.outbound
+}
+
+func (g *gossiper) QueueLen() int {
+	return len(g.ch)
+}
+
+func (g *gossiper) Throttled() time.Duration {
+	return time.Duration(atomic.LoadInt64(&g.throttled))
+}
+
+func (g *gossiper) peerEncoding(p models.Peer) wire.Encoding {
+	g.prefsMutex.Lock()
+	defer g.prefsMutex.Unlock()
+
+	if enc, ok := g.prefs[p.ToString()]; ok {
+		return enc
+	}
+	return g.encoding
+}
+
+func encodeMessage(enc wire.Encoding, msg models.Message) ([]byte, error) {
+	payload, err := enc.Encode(consts.PrefMessage, msg)
+	if err != nil {
+		return nil, err
+	}
+	if len(payload) > transport.MaxDatagramSize {
+		return nil, errors.New(fmt.Sprintf("%v message is %v bytes, max %v", enc.Codec.Name(), len(payload), transport.MaxDatagramSize))
+	}
+	return payload, nil
 }
@@ -0,0 +1,197 @@
+package metrics
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"sort"
+	"sync"
+	"time"
+)
+
+// границы корзин гистограммы задержки, в секундах
+var latencyBuckets = []float64{0.001, 0.005, 0.01, 0.05, 0.1, 0.5, 1, 5, 10, 30}
+
+// Metrics - счётчики узла. Выводятся в текстовом формате Prometheus
+// вместе с мгновенными значениями, которые узел передаёт в Write.
+type Metrics struct {
+	mutex *sync.Mutex
+
+	packetsIn    map[string]uint64
+	packetsOut   map[string]uint64
+	bytesIn      map[string]uint64
+	bytesOut     map[string]uint64
+	decodeErrors map[string]uint64
+	invalid      uint64
+
+	latencyCounts []uint64
+	latencySum    float64
+	latencyCount  uint64
+}
+
+func New() *Metrics {
+	return &Metrics{
+		mutex:         &sync.Mutex{},
+		packetsIn:     make(map[string]uint64),
+		packetsOut:    make(map[string]uint64),
+		bytesIn:       make(map[string]uint64),
+		bytesOut:      make(map[string]uint64),
+		decodeErrors:  make(map[string]uint64),
+		latencyCounts: make([]uint64, len(latencyBuckets)),
+	}
+}
+
+func (m *Metrics) PacketIn(typ []byte, size int) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.packetsIn[string(typ)]++
+	m.bytesIn[string(typ)] += uint64(size)
+}
+
+func (m *Metrics) PacketOut(typ []byte, size int) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.packetsOut[string(typ)]++
+	m.bytesOut[string(typ)] += uint64(size)
+}
+
+// DecodeError считает пакеты, которые не удалось разобрать.
+// typ пустой, если не разобрался даже заголовок.
+func (m *Metrics) DecodeError(typ []byte) {
+	if len(typ) == 0 {
+		typ = []byte("unknown")
+	}
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.decodeErrors[string(typ)]++
+}
+
+func (m *Metrics) InvalidMessage() {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.invalid++
+}
+
+// Totals возвращает число принятых и отправленных пакетов всех типов
+// и сумму ошибок разбора и сообщений с неверной контрольной суммой
+func (m *Metrics) Totals() (in, out, invalid uint64) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	for _, v := range m.packetsIn {
+		in += v
+	}
+	for _, v := range m.packetsOut {
+		out += v
+	}
+	invalid = m.invalid
+	for _, v := range m.decodeErrors {
+		invalid += v
+	}
+	return in, out, invalid
+}
+
+// Accepted записывает время от создания сообщения до его принятия узлом.
+// Часы узлов не синхронизированы, поэтому отрицательная задержка считается нулевой.
+func (m *Metrics) Accepted(latency time.Duration) {
+	if latency < 0 {
+		latency = 0
+	}
+	seconds := latency.Seconds()
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	for i, le := range latencyBuckets {
+		if seconds <= le {
+			m.latencyCounts[i]++
+		}
+	}
+	m.latencySum += seconds
+	m.latencyCount++
+}
+
+// Gauge - мгновенное значение, которое хранит не Metrics, а сам узел
+type Gauge struct {
+	Name  string
+	Help  string
+	Value float64
+	// counter для значений, которые только растут, иначе gauge
+	Counter bool
+}
+
+// Labeled - счётчик с одной меткой, хранящийся вне Metrics
+type Labeled struct {
+	Name   string
+	Help   string
+	Label  string
+	Values map[string]uint64
+}
+
+// Write выводит счётчики и переданные значения в текстовом формате Prometheus
+func (m *Metrics) Write(w io.Writer, labeled []Labeled, gauges []Gauge) error {
+	m.mutex.Lock()
+	counters := []Labeled{
+		{"hashgossip_packets_received_total", "Packets received, by type.", "type", copyMap(m.packetsIn)},
+		{"hashgossip_packets_sent_total", "Packets sent, by type.", "type", copyMap(m.packetsOut)},
+		{"hashgossip_received_bytes_total", "Bytes received, by packet type.", "type", copyMap(m.bytesIn)},
+		{"hashgossip_sent_bytes_total", "Bytes sent, by packet type.", "type", copyMap(m.bytesOut)},
+		{"hashgossip_decode_errors_total", "Packets that failed to decode, by type.", "type", copyMap(m.decodeErrors)},
+	}
+	invalid := m.invalid
+	buckets := append([]uint64(nil), m.latencyCounts...)
+	sum, count := m.latencySum, m.latencyCount
+	m.mutex.Unlock()
+
+	buf := bufio.NewWriter(w)
+	for _, c := range append(counters, labeled...) {
+		writeLabeled(buf, c)
+	}
+	writeGauge(buf, Gauge{"hashgossip_invalid_messages_total", "Messages rejected for a bad checksum.", float64(invalid), true})
+	for _, g := range gauges {
+		writeGauge(buf, g)
+	}
+
+	name := "hashgossip_message_accept_latency_seconds"
+	fmt.Fprintf(buf, "# HELP %v Time from message creation to acceptance by this node.\n", name)
+	fmt.Fprintf(buf, "# TYPE %v histogram\n", name)
+	for i, le := range latencyBuckets {
+		fmt.Fprintf(buf, "%v_bucket{le=\"%v\"} %v\n", name, le, buckets[i])
+	}
+	fmt.Fprintf(buf, "%v_bucket{le=\"+Inf\"} %v\n", name, count)
+	fmt.Fprintf(buf, "%v_sum %v\n", name, sum)
+	fmt.Fprintf(buf, "%v_count %v\n", name, count)
+
+	return buf.Flush()
+}
+
+func writeLabeled(w io.Writer, c Labeled) {
+	fmt.Fprintf(w, "# HELP %v %v\n", c.Name, c.Help)
+	fmt.Fprintf(w, "# TYPE %v counter\n", c.Name)
+
+	// стабильный порядок удобнее читать глазами и сравнивать
+	keys := make([]string, 0, len(c.Values))
+	for k := range c.Values {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		fmt.Fprintf(w, "%v{%v=%q} %v\n", c.Name, c.Label, k, c.Values[k])
+	}
+}
+
+func writeGauge(w io.Writer, g Gauge) {
+	kind := "gauge"
+	if g.Counter {
+		kind = "counter"
+	}
+	fmt.Fprintf(w, "# HELP %v %v\n", g.Name, g.Help)
+	fmt.Fprintf(w, "# TYPE %v %v\n", g.Name, kind)
+	fmt.Fprintf(w, "%v %v\n", g.Name, g.Value)
+}
+
+func copyMap(src map[string]uint64) map[string]uint64 {
+	dst := make(map[string]uint64, len(src))
+	for k, v := range src {
+		dst[k] = v
+	}
+	return dst
+}
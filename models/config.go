@@ -1,7 +1,75 @@
 package models
 
 type Config struct {
+	Network          string
 	MulticastAddress string
 	LimitMessages    int
 	InvalidFrequent  int
+	DemoMode         bool
+	Codec            string
+	BindAddress      string
+	AdvertiseAddress string
+	Interface        string
+	DataDir          string
+	NodeID           string
+
+	AdminAddress     string
+	AdminToken       string
+	AdminAllowRemote bool
+
+	Compression          string
+	CompressionThreshold int
+	BatchMTU             int
+	BatchLinger          Duration
+
+	MulticastInterfaces []string
+	MulticastTTL        int
+	MulticastLoopback   bool
+	Seeds               []string
+
+	ProbeInterval  Duration
+	SuspectTimeout Duration
+	DeadTimeout    Duration
+
+	PeerCacheInterval Duration
+	PeerCacheMaxAge   Duration
+
+	// debug, info, warn или error, формат logfmt или json
+	LogLevel            string
+	LogFormat           string
+	LogSampleFirst      int
+	LogSampleThereafter int
+
+	// события распространения сообщений: JSON построчно в файл и OTLP/HTTP коллектору
+	TraceFile     string
+	TraceEndpoint string
+
+	RateLimit  RateLimit
+	Reputation Reputation
+}
+
+// Limit - Rate пакетов (или байт) в секунду с запасом Burst, нулевой Rate отключает лимит
+type Limit struct {
+	Rate  Number
+	Burst int
+}
+
+type RateLimit struct {
+	// на все пакеты с одного адреса
+	Source Limit
+	// на пакеты одного типа с одного адреса, ключ - тип пакета, например HELLO
+	Types map[string]Limit
+	// на исходящие байты рассылки сообщений
+	Outbound Limit
+}
+
+// Reputation - очки, которые пир теряет за нарушения. Репутация от 0 до 100,
+// на нуле пир уходит в карантин на Cooldown. Нулевой Cooldown отключает карантин.
+type Reputation struct {
+	InvalidPenalty   Number
+	MalformedPenalty Number
+	RateLimitPenalty Number
+	// сколько очков в секунду пир восстанавливает
+	Recovery Number
+	Cooldown Duration
 }
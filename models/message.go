@@ -2,10 +2,16 @@ package models
 
 import (
 	"bytes"
+	"crypto/rand"
 	"crypto/sha1"
-	"log"
+	"errors"
+	"time"
+
+	"github.com/DemonVex/hashgossip/logger"
 )
 
+var ErrInvalidChecksum = errors.New("invalid message checksum")
+
 func calcChecksum(b []byte) ([]byte, error) {
 	hasher := sha1.New()
 	_, err := hasher.Write(b)
@@ -19,6 +25,14 @@ func calcChecksum(b []byte) ([]byte, error) {
 type Message struct {
 	Payload  []byte
 	Checksum []byte
+	// время создания в наносекундах Unix, не входит в контрольную сумму
+	// и нужно только для метрик задержки; у старых узлов его нет
+	Created int64 `msgpack:",omitempty" json:",omitempty"`
+	// трасса распространения сообщения: TraceID задаёт автор и он не меняется,
+	// а SpanID каждый узел с трассировкой заменяет своим перед пересылкой.
+	// В контрольную сумму не входят
+	TraceID []byte `msgpack:",omitempty" json:",omitempty"`
+	SpanID  []byte `msgpack:",omitempty" json:",omitempty"`
 }
 
 func NewMessage(payload []byte) (Message, error) {
@@ -27,13 +41,34 @@ func NewMessage(payload []byte) (Message, error) {
 		return Message{}, err
 	}
 
-	return Message{Payload: payload, Checksum: msgChecksum}, nil
+	return Message{
+		Payload:  payload,
+		Checksum: msgChecksum,
+		Created:  time.Now().UnixNano(),
+		TraceID:  randomID(16),
+		SpanID:   NewSpanID(),
+	}, nil
+}
+
+// NewSpanID возвращает случайный идентификатор участка трассы в 8 байт, как в OpenTelemetry
+func NewSpanID() []byte {
+	return randomID(8)
+}
+
+// randomID возвращает nil, если случайных байт не получить: сообщение уйдёт без трассы
+func randomID(n int) []byte {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		logger.Default().Error("can't generate trace id", logger.Err(err))
+		return nil
+	}
+	return b
 }
 
 func (m Message) IsValid() bool {
 	msgChecksum, err := calcChecksum(m.Payload)
 	if err != nil {
-		log.Println(err)
+		logger.Default().Error("can't calculate checksum", logger.Err(err))
 		return false
 	}
 
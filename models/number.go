@@ -0,0 +1,22 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Number - дробное значение конфига, которое в toml можно записать и целым:
+// Rate = 5 и Rate = 5.0 читаются одинаково
+type Number float64
+
+func (n *Number) UnmarshalTOML(v interface{}) error {
+	switch t := v.(type) {
+	case int64:
+		*n = Number(t)
+	case float64:
+		*n = Number(t)
+	default:
+		return errors.New(fmt.Sprintf("expected a number, got %T %v", v, v))
+	}
+	return nil
+}
@@ -0,0 +1,39 @@
+package models
+
+import (
+	"testing"
+
+	"github.com/BurntSushi/toml"
+)
+
+func TestNumberAcceptsIntegers(t *testing.T) {
+	var conf Config
+	_, err := toml.Decode(`
+[RateLimit.Source]
+Rate = 2000
+Burst = 4000
+
+[RateLimit.Types.HELLO]
+Rate = 0.5
+
+[Reputation]
+InvalidPenalty = 10
+Recovery = 1.5
+`, &conf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if conf.RateLimit.Source.Rate != 2000 || conf.RateLimit.Types["HELLO"].Rate != 0.5 {
+		t.Errorf("RateLimit = %+v", conf.RateLimit)
+	}
+	if conf.Reputation.InvalidPenalty != 10 || conf.Reputation.Recovery != 1.5 {
+		t.Errorf("Reputation = %+v", conf.Reputation)
+	}
+}
+
+func TestNumberRejectsOtherTypes(t *testing.T) {
+	var conf Config
+	if _, err := toml.Decode("[RateLimit.Source]\nRate = \"fast\"\n", &conf); err == nil {
+		t.Error("string Rate is accepted")
+	}
+}
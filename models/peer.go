@@ -1,15 +1,74 @@
 package models
 
 import (
-	"fmt"
+	"crypto/rand"
+	"encoding/hex"
 	"net"
+	"strconv"
+	"time"
+
+	"github.com/DemonVex/hashgossip/logger"
+)
+
+// идентификатор длиннее не принимается из пакетов
+const MaxNodeIDLen = 64
+
+type PeerState int
+
+const (
+	PeerAlive PeerState = iota
+	// пир давно не отвечал на PROBE, но ещё не удалён
+	PeerSuspect
 )
 
+func (s PeerState) String() string {
+	switch s {
+	case PeerAlive:
+		return "alive"
+	case PeerSuspect:
+		return "suspect"
+	}
+	return "unknown"
+}
+
 type Peer struct {
 	IP   net.IP
 	Port uint16
+	// зона нужна для link-local IPv6 адресов (fe80::1%eth0)
+	Zone string `msgpack:",omitempty" json:",omitempty"`
+	// идентификатор узла, не меняется при смене адреса, если у узла задан DataDir
+	ID string `msgpack:",omitempty" json:",omitempty"`
+
+	// локальное представление узла о пире, по сети не передаётся
+	State    PeerState `msgpack:"-" json:"-"`
+	LastSeen time.Time `msgpack:"-" json:"-"`
 }
 
 func (p Peer) ToString() string {
-	return fmt.Sprintf("%v:%v", p.IP, p.Port)
+	host := p.IP.String()
+	if p.Zone != "" {
+		host += "%" + p.Zone
+	}
+	return net.JoinHostPort(host, strconv.Itoa(int(p.Port)))
+}
+
+// NewNodeID возвращает случайный идентификатор узла
+func NewNodeID() string {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		// без идентификатора узел работает, просто пиры не узнают его после рестарта
+		logger.Default().Error("can't generate node id", logger.Err(err))
+		return ""
+	}
+	return hex.EncodeToString(b)
+}
+
+func (p Peer) Equal(b Peer) bool {
+	// IPv4 адрес может прийти как в 4-х, так и в 16-ти байтовом виде,
+	// поэтому сравнивать байты напрямую нельзя. Link-local адреса в разных зонах -
+	// разные узлы, но зона известна не всегда: в пакете от пира её может не быть
+	if p.Zone != "" && b.Zone != "" && p.Zone != b.Zone {
+		return false
+	}
+	return p.Port == b.Port && p.IP.Equal(b.IP)
 }
@@ -0,0 +1,56 @@
+package models
+
+import (
+	"net"
+	"testing"
+)
+
+func TestPeerToString(t *testing.T) {
+	tests := []struct {
+		peer Peer
+		want string
+	}{
+		{Peer{IP: net.ParseIP("127.0.0.1"), Port: 7946}, "127.0.0.1:7946"},
+		{Peer{IP: net.ParseIP("::1"), Port: 7946}, "[::1]:7946"},
+		{Peer{IP: net.ParseIP("2001:db8::1"), Port: 1}, "[2001:db8::1]:1"},
+		{Peer{IP: net.ParseIP("fe80::1"), Port: 7946, Zone: "eth0"}, "[fe80::1%eth0]:7946"},
+	}
+	for _, tt := range tests {
+		if got := tt.peer.ToString(); got != tt.want {
+			t.Errorf("ToString() = %q, want %q", got, tt.want)
+		}
+		// строка должна разбираться обратно в тот же адрес
+		addr, err := net.ResolveUDPAddr("udp", tt.peer.ToString())
+		if err != nil {
+			t.Errorf("ResolveUDPAddr(%q): %v", tt.peer.ToString(), err)
+			continue
+		}
+		if !addr.IP.Equal(tt.peer.IP) || addr.Port != int(tt.peer.Port) || addr.Zone != tt.peer.Zone {
+			t.Errorf("ResolveUDPAddr(%q) = %v", tt.peer.ToString(), addr)
+		}
+	}
+}
+
+func TestPeerEqual(t *testing.T) {
+	tests := []struct {
+		name string
+		a, b Peer
+		want bool
+	}{
+		{"ipv4 in 4 and 16 bytes", Peer{IP: net.IPv4(10, 0, 0, 1).To4(), Port: 1}, Peer{IP: net.IPv4(10, 0, 0, 1), Port: 1}, true},
+		{"ipv6 loopback", Peer{IP: net.ParseIP("::1"), Port: 1}, Peer{IP: net.ParseIP("::1"), Port: 1}, true},
+		{"ipv6 different port", Peer{IP: net.ParseIP("::1"), Port: 1}, Peer{IP: net.ParseIP("::1"), Port: 2}, false},
+		{"ipv4 loopback is not ipv6 loopback", Peer{IP: net.ParseIP("127.0.0.1"), Port: 1}, Peer{IP: net.ParseIP("::1"), Port: 1}, false},
+		{"same zone", Peer{IP: net.ParseIP("fe80::1"), Port: 1, Zone: "eth0"}, Peer{IP: net.ParseIP("fe80::1"), Port: 1, Zone: "eth0"}, true},
+		{"different zones", Peer{IP: net.ParseIP("fe80::1"), Port: 1, Zone: "eth0"}, Peer{IP: net.ParseIP("fe80::1"), Port: 1, Zone: "eth1"}, false},
+		{"zone unknown on one side", Peer{IP: net.ParseIP("fe80::1"), Port: 1, Zone: "eth0"}, Peer{IP: net.ParseIP("fe80::1"), Port: 1}, true},
+	}
+	for _, tt := range tests {
+		if got := tt.a.Equal(tt.b); got != tt.want {
+			t.Errorf("%v: Equal() = %v, want %v", tt.name, got, tt.want)
+		}
+		if got := tt.b.Equal(tt.a); got != tt.want {
+			t.Errorf("%v: reversed Equal() = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
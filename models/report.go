@@ -0,0 +1,44 @@
+package models
+
+import "time"
+
+// NodeReport - ответ узла на MONIT
+type NodeReport struct {
+	NodeID  string
+	Version string
+	Uptime  time.Duration
+	// сообщение из хранилища, по нему сравнивают, сошёлся ли кластер
+	Msg Message
+	// пиры узла, включая его самого. Если отчёт не влезает в датаграмму,
+	// список пуст, а число пиров остаётся в PeerCount
+	Peers     []PeerReport
+	PeerCount int
+	Hashes    int
+	// сообщения в очереди рассылки
+	Queue      int
+	PacketsIn  uint64
+	PacketsOut uint64
+	// пакеты, которые не удалось разобрать, и сообщения с неверной контрольной суммой
+	Invalid uint64
+	// отпечаток настроек, которые должны совпадать у всех узлов кластера
+	ConfigHash string
+	// адрес, который узел сообщает пирам. Отчёт уходит с временного порта,
+	// поэтому адрес отправителя для этого не годится
+	Address string `msgpack:",omitempty" json:",omitempty"`
+}
+
+type PeerReport struct {
+	Address string
+	ID      string `msgpack:",omitempty" json:",omitempty"`
+	State   string
+	// сколько прошло с последнего контакта
+	Silence time.Duration
+}
+
+func NewPeerReport(p Peer, now time.Time) PeerReport {
+	r := PeerReport{Address: p.ToString(), ID: p.ID, State: p.State.String()}
+	if !p.LastSeen.IsZero() {
+		r.Silence = now.Sub(p.LastSeen)
+	}
+	return r
+}
@@ -0,0 +1,37 @@
+package models
+
+import (
+	"net"
+	"time"
+)
+
+// Offense - нарушение, за которое у пира снимаются очки репутации
+type Offense int
+
+const (
+	// сообщение с неверной контрольной суммой
+	OffenseInvalid Offense = iota
+	// пакет, который не удалось разобрать
+	OffenseMalformed
+	// пакет сверх лимита
+	OffenseRateLimit
+)
+
+func (o Offense) String() string {
+	switch o {
+	case OffenseInvalid:
+		return "invalid message"
+	case OffenseMalformed:
+		return "malformed packet"
+	case OffenseRateLimit:
+		return "rate limit"
+	}
+	return "unknown"
+}
+
+// Ban - пир в карантине, его пакеты отбрасываются до Until
+type Ban struct {
+	IP     net.IP
+	Reason string
+	Until  time.Time
+}
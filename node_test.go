@@ -0,0 +1,154 @@
+package hashgossip
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/DemonVex/hashgossip/logger"
+)
+
+func quietLogger(t *testing.T) logger.Logger {
+	lg, err := logger.New(ioutil.Discard, "", logger.ErrorLevel, logger.Sampling{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return lg
+}
+
+// startNode запускает узел без multicast, только через seeds
+func startNode(t *testing.T, network, bind string, seeds ...string) *Node {
+	t.Helper()
+	n := NewNode(Options{
+		Network:       network,
+		BindAddress:   bind,
+		Seeds:         seeds,
+		ProbeInterval: 100 * time.Millisecond,
+		Logger:        quietLogger(t),
+	})
+	if err := n.Start(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		n.Stop(ctx)
+	})
+	return n
+}
+
+// unusedAddr - адрес без узла. Он нужен первому узлу как seed, иначе без multicast тот не запустится
+func unusedAddr(t *testing.T, network string, ip net.IP) string {
+	conn, err := net.ListenUDP(network, &net.UDPAddr{IP: ip})
+	if err != nil {
+		t.Skipf("can't listen on %v: %v", ip, err)
+	}
+	defer conn.Close()
+	return conn.LocalAddr().String()
+}
+
+// startPair запускает два узла и ждёт, пока они узнают друг о друге
+func startPair(t *testing.T, network, bind string) (a, b *Node) {
+	t.Helper()
+	a = startNode(t, network, bind, unusedAddr(t, network, net.ParseIP(bind)))
+	b = startNode(t, network, bind, a.Addr().String())
+
+	// узел b знакомится с a через HELLO, a узнаёт о b из него же
+	deadline := time.Now().Add(5 * time.Second)
+	for !knows(a, b) || !knows(b, a) {
+		if time.Now().After(deadline) {
+			t.Fatalf("nodes did not meet: a knows %v, b knows %v", a.Peers(), b.Peers())
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	return a, b
+}
+
+func TestTwoNodesOverIPv6Loopback(t *testing.T) {
+	a, b := startPair(t, "udp6", "::1")
+	sub := b.Subscribe()
+
+	if !a.Addr().IP.Equal(net.IPv6loopback) || !b.Addr().IP.Equal(net.IPv6loopback) {
+		t.Fatalf("nodes listen on %v and %v, want [::1]", a.Addr(), b.Addr())
+	}
+
+	payload := []byte("hello over ::1")
+	hash, err := a.Publish(context.Background(), payload)
+	if err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case msg := <-sub:
+		if !bytes.Equal(msg.GetPayload(), payload) || !bytes.Equal(msg.GetHash(), hash) {
+			t.Errorf("b got payload %q hash %x, want %q %x", msg.GetPayload(), msg.GetHash(), payload, hash)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("message did not reach the second node")
+	}
+}
+
+func TestLeaveRemovesNodeFromPeers(t *testing.T) {
+	a, b := startPair(t, "udp4", "127.0.0.1")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := a.Leave(ctx); err != nil {
+		t.Fatal(err)
+	}
+	// без LEAVE узел b удалил бы a только через DeadTimeout, 15s по умолчанию
+	deadline := time.Now().Add(2 * time.Second)
+	for knows(b, a) {
+		if time.Now().After(deadline) {
+			t.Fatalf("b still knows a after leave: %v", b.Peers())
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+}
+
+func TestReportCarriesAdvertisedAddress(t *testing.T) {
+	n := startNode(t, "udp4", "127.0.0.1", unusedAddr(t, "udp4", net.ParseIP("127.0.0.1")))
+	if got, want := n.Report().Address, n.Addr().String(); got != want {
+		t.Errorf("Report().Address = %q, want %q", got, want)
+	}
+}
+
+func TestStartWithZeroOptions(t *testing.T) {
+	n := NewNode(Options{
+		BindAddress: "127.0.0.1",
+		Seeds:       []string{unusedAddr(t, "udp4", net.ParseIP("127.0.0.1"))},
+		DataDir:     t.TempDir(),
+		Logger:      quietLogger(t),
+	})
+	// без значений по умолчанию NewTicker паникует на нулевом интервале
+	if err := n.Start(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		n.Stop(ctx)
+	}()
+
+	opts := n.options()
+	if opts.ProbeInterval <= 0 || opts.SuspectTimeout <= opts.ProbeInterval || opts.DeadTimeout <= opts.SuspectTimeout || opts.PeerCacheInterval <= 0 {
+		t.Fatalf("intervals are not defaulted: probe %v, suspect %v, dead %v, peer cache %v",
+			opts.ProbeInterval, opts.SuspectTimeout, opts.DeadTimeout, opts.PeerCacheInterval)
+	}
+	// с нулевыми таймаутами первая же проверка удалила бы и сам узел
+	time.Sleep(opts.ProbeInterval + 200*time.Millisecond)
+	if !knows(n, n) {
+		t.Errorf("node forgot itself after a probe: %v", n.Peers())
+	}
+}
+
+func knows(n, other *Node) bool {
+	for _, p := range n.Peers() {
+		if p.IP.Equal(other.Addr().IP) && int(p.Port) == other.Addr().Port {
+			return true
+		}
+	}
+	return false
+}
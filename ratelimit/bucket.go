@@ -0,0 +1,123 @@
+package ratelimit
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// Bucket - классический token bucket: Rate токенов в секунду, не больше Burst сразу
+type Bucket struct {
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+	mutex  *sync.Mutex
+}
+
+func NewBucket(rate float64, burst int) *Bucket {
+	if burst < 1 {
+		burst = 1
+	}
+	return &Bucket{rate: rate, burst: float64(burst), tokens: float64(burst), last: time.Now(), mutex: &sync.Mutex{}}
+}
+
+func (b *Bucket) Allow() bool {
+	return b.AllowN(1)
+}
+
+func (b *Bucket) AllowN(n int) bool {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	b.refill(time.Now())
+	if b.tokens < float64(n) {
+		return false
+	}
+	b.tokens -= float64(n)
+	return true
+}
+
+// WaitN ждёт, пока наберётся n токенов. Запрос больше Burst ждёт полного бака
+// и уводит его в минус, иначе такой запрос не прошёл бы никогда.
+func (b *Bucket) WaitN(ctx context.Context, n int) (time.Duration, error) {
+	b.mutex.Lock()
+	now := time.Now()
+	b.refill(now)
+	need := float64(n)
+	if need > b.burst {
+		need = b.burst
+	}
+	var wait time.Duration
+	if b.tokens < need {
+		wait = time.Duration((need - b.tokens) / b.rate * float64(time.Second))
+	}
+	// токены резервируются сразу, чтобы параллельные вызовы вставали в очередь
+	b.tokens -= float64(n)
+	b.mutex.Unlock()
+
+	if wait == 0 {
+		return 0, nil
+	}
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return wait, nil
+	case <-ctx.Done():
+		return wait, ctx.Err()
+	}
+}
+
+func (b *Bucket) full(now time.Time) bool {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	b.refill(now)
+	return b.tokens >= b.burst
+}
+
+func (b *Bucket) refill(now time.Time) {
+	b.tokens += now.Sub(b.last).Seconds() * b.rate
+	if b.tokens > b.burst {
+		b.tokens = b.burst
+	}
+	b.last = now
+}
+
+// Keyed держит отдельный Bucket на каждый ключ, например адрес отправителя
+type Keyed struct {
+	rate      float64
+	burst     int
+	mutex     *sync.Mutex
+	buckets   map[string]*Bucket
+	lastSweep time.Time
+}
+
+// пересоздать полный бак то же самое, что хранить его, поэтому такие удаляются
+const sweepInterval = time.Minute
+
+func NewKeyed(rate float64, burst int) *Keyed {
+	return &Keyed{rate: rate, burst: burst, mutex: &sync.Mutex{}, buckets: make(map[string]*Bucket), lastSweep: time.Now()}
+}
+
+func (k *Keyed) Allow(key string) bool {
+	k.mutex.Lock()
+	now := time.Now()
+	if now.Sub(k.lastSweep) > sweepInterval {
+		for key, b := range k.buckets {
+			if b.full(now) {
+				delete(k.buckets, key)
+			}
+		}
+		k.lastSweep = now
+	}
+
+	b, ok := k.buckets[key]
+	if !ok {
+		b = NewBucket(k.rate, k.burst)
+		k.buckets[key] = b
+	}
+	k.mutex.Unlock()
+
+	return b.Allow()
+}
@@ -0,0 +1,123 @@
+package ratelimit
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+// rewind сдвигает время последнего пополнения, как будто прошло d
+func rewind(b *Bucket, d time.Duration) {
+	b.mutex.Lock()
+	b.last = b.last.Add(-d)
+	b.mutex.Unlock()
+}
+
+func TestBucketBurstAndRefill(t *testing.T) {
+	b := NewBucket(10, 3)
+	for i := 0; i < 3; i++ {
+		if !b.Allow() {
+			t.Fatalf("packet %v within burst is denied", i)
+		}
+	}
+	if b.Allow() {
+		t.Fatal("packet over burst is allowed")
+	}
+
+	// за 200ms при 10 в секунду набирается два токена
+	rewind(b, 200*time.Millisecond)
+	if !b.AllowN(2) {
+		t.Fatal("refilled tokens are not available")
+	}
+	if b.Allow() {
+		t.Fatal("more tokens than refilled")
+	}
+
+	// бак не наполняется больше Burst
+	rewind(b, time.Hour)
+	if b.AllowN(4) {
+		t.Error("AllowN above burst is allowed after a long pause")
+	}
+	if !b.AllowN(3) {
+		t.Error("denied AllowN must not take tokens")
+	}
+}
+
+func TestBucketMinimalBurst(t *testing.T) {
+	b := NewBucket(1, 0)
+	if !b.Allow() {
+		t.Fatal("zero burst must allow one packet")
+	}
+	if b.Allow() {
+		t.Fatal("zero burst allows more than one packet")
+	}
+}
+
+func TestBucketWaitN(t *testing.T) {
+	b := NewBucket(1000, 10)
+	if wait, err := b.WaitN(context.Background(), 10); err != nil || wait != 0 {
+		t.Fatalf("WaitN within burst = %v, %v, want no wait", wait, err)
+	}
+
+	// бак пуст, 5 токенов при 1000 в секунду - около 5ms
+	wait, err := b.WaitN(context.Background(), 5)
+	if err != nil || wait <= 0 || wait > 10*time.Millisecond {
+		t.Fatalf("WaitN(5) = %v, %v, want about 5ms", wait, err)
+	}
+
+	// запрос больше Burst ждёт полного бака и уводит его в минус
+	b = NewBucket(1000, 10)
+	if wait, err := b.WaitN(context.Background(), 30); err != nil || wait != 0 {
+		t.Fatalf("WaitN above burst on a full bucket = %v, %v, want no wait", wait, err)
+	}
+	if b.Allow() {
+		t.Fatal("bucket is not in debt after WaitN above burst")
+	}
+	wait, err = b.WaitN(context.Background(), 1)
+	if err != nil || wait < 15*time.Millisecond {
+		t.Errorf("WaitN after debt = %v, %v, want at least 20ms minus elapsed", wait, err)
+	}
+}
+
+func TestBucketWaitNCanceled(t *testing.T) {
+	b := NewBucket(1, 1)
+	b.Allow()
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	if _, err := b.WaitN(ctx, 1); err != context.DeadlineExceeded {
+		t.Fatalf("WaitN error = %v, want %v", err, context.DeadlineExceeded)
+	}
+	if time.Since(start) > 500*time.Millisecond {
+		t.Error("WaitN did not return on context cancel")
+	}
+}
+
+func TestKeyed(t *testing.T) {
+	k := NewKeyed(1, 2)
+	for i := 0; i < 2; i++ {
+		if !k.Allow("a") {
+			t.Fatalf("packet %v from a is denied", i)
+		}
+	}
+	if k.Allow("a") {
+		t.Fatal("a is not limited")
+	}
+	// у каждого ключа свой бак
+	if !k.Allow("b") {
+		t.Fatal("b is limited by a's bucket")
+	}
+
+	// при очистке полные баки удаляются, пустой остаётся
+	rewind(k.buckets["b"], time.Hour)
+	k.mutex.Lock()
+	k.lastSweep = k.lastSweep.Add(-2 * sweepInterval)
+	k.mutex.Unlock()
+	k.Allow("c")
+	if _, ok := k.buckets["b"]; ok {
+		t.Error("full bucket is not swept")
+	}
+	if _, ok := k.buckets["a"]; !ok {
+		t.Error("empty bucket is swept, a would get a fresh burst")
+	}
+}
@@ -0,0 +1,172 @@
+package hashgossip
+
+import (
+	"errors"
+	"reflect"
+
+	"github.com/DemonVex/hashgossip/config"
+	c "github.com/DemonVex/hashgossip/consts"
+	"github.com/DemonVex/hashgossip/logger"
+	m "github.com/DemonVex/hashgossip/models"
+	"github.com/DemonVex/hashgossip/ratelimit"
+	"github.com/DemonVex/hashgossip/transport"
+)
+
+var (
+	// Reload сравнивает новый конфиг с тем, из которого собраны Options
+	ErrNoConfig = errors.New("node options were not built with OptionsFromConfig")
+	// в Options не задан LoadConfig
+	ErrReloadUnsupported = errors.New("config reload is not configured")
+)
+
+// ключи конфига, которые применяются без перезапуска узла
+var reloadable = map[string]bool{
+	"LogLevel":   true,
+	"RateLimit":  true,
+	"Reputation": true,
+	"Seeds":      true,
+	"AdminToken": true,
+}
+
+// Reloaded - итог перезагрузки конфига: применённые на лету ключи и изменённые
+// ключи, которые вступят в силу только после перезапуска
+type Reloaded struct {
+	Applied         []string
+	RestartRequired []string
+}
+
+// ReloadConfig перечитывает конфиг через Options.LoadConfig и применяет его как Reload
+func (n *Node) ReloadConfig() (Reloaded, error) {
+	if n.opts.LoadConfig == nil {
+		return Reloaded{}, ErrReloadUnsupported
+	}
+	conf, err := n.opts.LoadConfig()
+	if err != nil {
+		return Reloaded{}, err
+	}
+	return n.Reload(conf)
+}
+
+// Reload применяет изменившиеся LogLevel, RateLimit, Reputation, Seeds и AdminToken.
+// Остальные изменённые ключи возвращаются в RestartRequired и при следующей
+// перезагрузке будут отмечены снова, пока узел не перезапустят
+func (n *Node) Reload(conf m.Config) (Reloaded, error) {
+	if n.conf == nil {
+		return Reloaded{}, ErrNoConfig
+	}
+	if errs := config.Validate(conf); len(errs) > 0 {
+		return Reloaded{}, errs
+	}
+	// сравнивается с тем, что собрал OptionsFromConfig, поэтому и здесь нужны значения по умолчанию
+	conf = config.WithDefaults(conf)
+	r := Reloaded{Applied: []string{}, RestartRequired: []string{}}
+
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+
+	// в n.conf остаются значения, с которыми узел работает на самом деле
+	old, running := *n.conf, reflect.ValueOf(n.conf).Elem()
+	oldV, newV := reflect.ValueOf(old), reflect.ValueOf(conf)
+	for i := 0; i < oldV.NumField(); i++ {
+		name := oldV.Type().Field(i).Name
+		if sameValue(oldV.Field(i), newV.Field(i)) {
+			continue
+		}
+		if !reloadable[name] {
+			r.RestartRequired = append(r.RestartRequired, name)
+			continue
+		}
+		r.Applied = append(r.Applied, name)
+		running.Field(i).Set(newV.Field(i))
+	}
+
+	for _, name := range r.Applied {
+		switch name {
+		case "LogLevel":
+			// значение уже проверено Validate
+			level, _ := logger.ParseLevel(conf.LogLevel)
+			n.SetLogLevel(level)
+		case "RateLimit":
+			n.opts.RateLimit = conf.RateLimit
+			n.limiter.SetLimits(conf.RateLimit.Source, conf.RateLimit.Types)
+			n.gossiper.SetOutbound(outboundBucket(conf.RateLimit.Outbound))
+		case "Reputation":
+			n.opts.Reputation = conf.Reputation
+			n.reputation.SetConfig(conf.Reputation)
+		case "AdminToken":
+			n.opts.AdminToken = conf.AdminToken
+		case "Seeds":
+			n.opts.Seeds = conf.Seeds
+			// новые seeds получают приветствие сразу, иначе узел узнает о них только после перезапуска
+			if n.conn != nil {
+				n.greetSeeds(newSeeds(old.Seeds, conf.Seeds))
+			}
+		}
+	}
+
+	if len(r.Applied) > 0 || len(r.RestartRequired) > 0 {
+		n.log.Info("config reloaded", logger.F("applied", r.Applied), logger.F("restart_required", r.RestartRequired))
+	} else {
+		n.log.Info("config reloaded, nothing changed")
+	}
+	if len(r.RestartRequired) > 0 {
+		n.log.Warn("some settings need a restart to take effect", logger.F("keys", r.RestartRequired))
+	}
+	return r, nil
+}
+
+// options возвращает копию настроек, часть из которых меняет Reload
+func (n *Node) options() Options {
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+	return n.opts
+}
+
+func (n *Node) greetSeeds(seeds []string) {
+	hello := n.encoding().IdentityPacket(c.PrefHello, n.handler.Port, n.id)
+	for _, seed := range seeds {
+		// недоступный seed не повод останавливать узел, возможно ответят другие
+		n.countSent(hello)
+		if err := transport.SendPayloadToUDP(seed, hello); err != nil {
+			n.log.Warn("seed is unreachable", logger.Peer(seed), logger.Err(err))
+		}
+	}
+}
+
+// outboundBucket - лимит исходящих байт рассылки, nil при нулевом Rate
+func outboundBucket(l m.Limit) *ratelimit.Bucket {
+	if l.Rate <= 0 {
+		return nil
+	}
+	return ratelimit.NewBucket(float64(l.Rate), l.Burst)
+}
+
+// sameValue не различает пустой и nil список, в TOML и окружении это одно и то же
+func sameValue(a, b reflect.Value) bool {
+	switch a.Kind() {
+	case reflect.Slice, reflect.Map:
+		if a.Len() == 0 && b.Len() == 0 {
+			return true
+		}
+	}
+	return reflect.DeepEqual(a.Interface(), b.Interface())
+}
+
+func newSeeds(old, seeds []string) []string {
+	var added []string
+	for _, s := range seeds {
+		if !contains(old, s) {
+			added = append(added, s)
+		}
+	}
+	return added
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,209 @@
+package hashgossip
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/DemonVex/hashgossip/config"
+	c "github.com/DemonVex/hashgossip/consts"
+	"github.com/DemonVex/hashgossip/logger"
+	m "github.com/DemonVex/hashgossip/models"
+	"github.com/DemonVex/hashgossip/wire"
+)
+
+// configNode создаёт узел из конфига, не запуская его
+func configNode(t *testing.T, conf m.Config) *Node {
+	t.Helper()
+	opts := OptionsFromConfig(conf)
+	opts.Logger = quietLogger(t)
+	return NewNode(opts)
+}
+
+func assertReloaded(t *testing.T, r Reloaded, applied, restart []string) {
+	t.Helper()
+	if !reflect.DeepEqual(r.Applied, applied) || !reflect.DeepEqual(r.RestartRequired, restart) {
+		t.Errorf("Reload() applied %v, restart required %v; want %v, %v", r.Applied, r.RestartRequired, applied, restart)
+	}
+}
+
+func TestReloadNothingChanged(t *testing.T) {
+	conf := config.Default()
+	n := configNode(t, conf)
+
+	r, err := n.Reload(conf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertReloaded(t, r, []string{}, []string{})
+
+	// пустой и nil список, нулевой и равный значению по умолчанию интервал - одно и то же
+	same := config.Default()
+	same.Seeds = []string{}
+	same.MulticastInterfaces = nil
+	same.ProbeInterval = m.Duration{}
+	r, err = n.Reload(same)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertReloaded(t, r, []string{}, []string{})
+}
+
+func TestReloadAppliesReloadableKeys(t *testing.T) {
+	n := configNode(t, config.Default())
+
+	conf := config.Default()
+	conf.LogLevel = "debug"
+	conf.RateLimit.Source = m.Limit{Rate: 10, Burst: 20}
+	conf.RateLimit.Outbound = m.Limit{Rate: 1000, Burst: 2000}
+	conf.Reputation.Cooldown = m.Duration{Duration: time.Minute}
+	conf.AdminToken = "secret"
+	r, err := n.Reload(conf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// ключи перечисляются в порядке полей Config
+	assertReloaded(t, r, []string{"AdminToken", "LogLevel", "RateLimit", "Reputation"}, []string{})
+
+	if n.LogLevel() != logger.DebugLevel {
+		t.Errorf("LogLevel() = %v, want debug", n.LogLevel())
+	}
+	opts := n.options()
+	if !reflect.DeepEqual(opts.RateLimit, conf.RateLimit) || !reflect.DeepEqual(opts.Reputation, conf.Reputation) || opts.AdminToken != "secret" {
+		t.Errorf("options are not updated: %+v", opts)
+	}
+
+	// применённые значения становятся текущими
+	r, err = n.Reload(conf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertReloaded(t, r, []string{}, []string{})
+}
+
+func TestReloadReportsRestartRequired(t *testing.T) {
+	n := configNode(t, config.Default())
+
+	conf := config.Default()
+	conf.Codec = "json"
+	conf.BatchMTU = 1200
+	conf.Seeds = []string{"127.0.0.1:9000"}
+	r, err := n.Reload(conf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertReloaded(t, r, []string{"Seeds"}, []string{"Codec", "BatchMTU"})
+	if n.options().Codec.Name() != "msgpack" {
+		t.Errorf("Codec changed without restart to %v", n.options().Codec.Name())
+	}
+
+	// не применённые ключи отмечаются снова, пока узел не перезапустят
+	r, err = n.Reload(conf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertReloaded(t, r, []string{}, []string{"Codec", "BatchMTU"})
+}
+
+func TestReloadRejectsInvalidConfig(t *testing.T) {
+	n := configNode(t, config.Default())
+
+	conf := config.Default()
+	conf.LogLevel = "debug"
+	conf.DeadTimeout = m.Duration{Duration: time.Second}
+	_, err := n.Reload(conf)
+	if _, ok := err.(config.Errors); !ok {
+		t.Fatalf("Reload() error = %v, want config.Errors", err)
+	}
+	if n.LogLevel() == logger.DebugLevel {
+		t.Error("invalid config is partly applied")
+	}
+	r, err := n.Reload(config.Default())
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertReloaded(t, r, []string{}, []string{})
+}
+
+func TestReloadWithoutConfig(t *testing.T) {
+	n := NewNode(Options{Logger: quietLogger(t)})
+	if _, err := n.Reload(config.Default()); err != ErrNoConfig {
+		t.Errorf("Reload() error = %v, want ErrNoConfig", err)
+	}
+	if _, err := n.ReloadConfig(); err != ErrReloadUnsupported {
+		t.Errorf("ReloadConfig() error = %v, want ErrReloadUnsupported", err)
+	}
+}
+
+func TestReloadConfigUsesLoadConfig(t *testing.T) {
+	opts := OptionsFromConfig(config.Default())
+	opts.Logger = quietLogger(t)
+	loaded, loadErr := config.Default(), error(nil)
+	opts.LoadConfig = func() (m.Config, error) { return loaded, loadErr }
+	n := NewNode(opts)
+
+	loaded.AdminToken = "secret"
+	r, err := n.ReloadConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertReloaded(t, r, []string{"AdminToken"}, []string{})
+
+	loadErr = errors.New("can't read config file")
+	if _, err := n.ReloadConfig(); err != loadErr {
+		t.Errorf("ReloadConfig() error = %v, want the LoadConfig error", err)
+	}
+}
+
+func TestReloadGreetsNewSeeds(t *testing.T) {
+	conf := config.Default()
+	conf.MulticastAddress = ""
+	conf.BindAddress = "127.0.0.1"
+	conf.Seeds = []string{unusedAddr(t, "udp4", net.ParseIP("127.0.0.1"))}
+	n := configNode(t, conf)
+	if err := n.Start(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		n.Stop(ctx)
+	}()
+
+	seed, err := net.ListenUDP("udp4", &net.UDPAddr{IP: net.ParseIP("127.0.0.1")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer seed.Close()
+
+	conf.Seeds = append(conf.Seeds, seed.LocalAddr().String())
+	if _, err := n.Reload(conf); err != nil {
+		t.Fatal(err)
+	}
+
+	buf := make([]byte, 8192)
+	seed.SetReadDeadline(time.Now().Add(5 * time.Second))
+	for {
+		size, _, err := seed.ReadFromUDP(buf)
+		if err != nil {
+			t.Fatalf("new seed got no HELLO: %v", err)
+		}
+		if prefix, _, _, err := wire.Unpack(buf[:size]); err == nil && bytes.Equal(prefix, c.PrefHello) {
+			return
+		}
+	}
+}
+
+func TestNewSeeds(t *testing.T) {
+	got := newSeeds([]string{"a:1", "b:1"}, []string{"b:1", "c:1", "a:1", "d:1"})
+	if want := []string{"c:1", "d:1"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("newSeeds() = %v, want %v", got, want)
+	}
+	if got := newSeeds([]string{"a:1"}, nil); got != nil {
+		t.Errorf("newSeeds() without seeds = %v, want nil", got)
+	}
+}
@@ -0,0 +1,67 @@
+package hashgossip
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"time"
+
+	c "github.com/DemonVex/hashgossip/consts"
+	m "github.com/DemonVex/hashgossip/models"
+)
+
+// Report собирает то, что узел отвечает на MONIT
+func (n *Node) Report() m.NodeReport {
+	in, out, invalid := n.metrics.Totals()
+	r := m.NodeReport{
+		NodeID:     n.id,
+		Version:    c.Version,
+		Msg:        n.messages.Get(),
+		Hashes:     n.hashes.Count(),
+		Queue:      n.gossiper.QueueLen(),
+		PacketsIn:  in,
+		PacketsOut: out,
+		Invalid:    invalid,
+		ConfigHash: n.configHash(),
+	}
+	if n.self.IP != nil {
+		r.Address = n.self.ToString()
+	}
+	if !n.started.IsZero() {
+		r.Uptime = time.Since(n.started)
+	}
+
+	now := time.Now()
+	for _, p := range n.peers.List() {
+		r.Peers = append(r.Peers, m.NewPeerReport(p, now))
+	}
+	r.PeerCount = len(r.Peers)
+	return r
+}
+
+// configHash - отпечаток настроек, которые должны совпадать у всех узлов кластера.
+// Адреса, идентификатор и DataDir у каждого узла свои и в него не входят
+func (n *Node) configHash() string {
+	o := n.options()
+	data, err := json.Marshal(struct {
+		Network          string
+		MulticastAddress string
+		Codec            string
+		Compression      string
+		BatchMTU         int
+		BatchLinger      time.Duration
+		ProbeInterval    time.Duration
+		SuspectTimeout   time.Duration
+		DeadTimeout      time.Duration
+		RateLimit        m.RateLimit
+		Reputation       m.Reputation
+	}{
+		o.Network, o.MulticastAddress, o.Codec.Name(), o.Compression.Algorithm.String(), o.BatchMTU, o.BatchLinger,
+		o.ProbeInterval, o.SuspectTimeout, o.DeadTimeout, o.RateLimit, o.Reputation,
+	})
+	if err != nil {
+		return ""
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:8])
+}
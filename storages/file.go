@@ -0,0 +1,148 @@
+package storage
+
+import (
+	"github.com/DemonVex/hashgossip/codec"
+	"github.com/DemonVex/hashgossip/logger"
+	"github.com/DemonVex/hashgossip/models"
+)
+
+// fileMessageStorage хранит сообщение в памяти, а каждое принятое пишет в журнал
+type fileMessageStorage struct {
+	*messageStorage
+	wal *wal
+	log logger.Logger
+}
+
+// NewFileMessageStorage восстанавливает сообщение из каталога dir.
+// Хранилище нужно закрыть через Close.
+func NewFileMessageStorage(dir string, lg logger.Logger) (MessageStorage, error) {
+	ms := &fileMessageStorage{messageStorage: NewMessageStorage().(*messageStorage), log: logger.Or(lg)}
+
+	var err error
+	ms.wal, err = openWAL(dir, "messages", ms.log, func(data []byte) {
+		msg, err := decodeMessage(data)
+		if err != nil {
+			// CRC сошёлся, но сообщение битое: пропускаем только эту запись
+			ms.log.Warn("bad message wal record is skipped", logger.Err(err))
+			return
+		}
+		if ms.msg.Compare(msg) < 0 {
+			ms.msg = msg
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+	return ms, nil
+}
+
+func (ms *fileMessageStorage) Set(m models.Message) bool {
+	ms.mutex.Lock()
+	defer ms.mutex.Unlock()
+
+	if ms.msg.Compare(m) >= 0 {
+		return false
+	}
+	ms.msg = m
+
+	data, err := encodeMessage(m)
+	if err != nil {
+		ms.log.Error("message wal encode failed", logger.Err(err))
+		return true
+	}
+	if err := ms.wal.Append(data); err != nil {
+		ms.log.Error("message wal append failed", logger.Err(err))
+	}
+	if ms.wal.NeedsCompaction() {
+		if err := ms.wal.Compact([][]byte{data}); err != nil {
+			ms.log.Error("message wal compaction failed", logger.Err(err))
+		}
+	}
+	return true
+}
+
+func (ms *fileMessageStorage) Close() error {
+	ms.mutex.Lock()
+	defer ms.mutex.Unlock()
+
+	if !ms.msg.IsEmpty() {
+		data, err := encodeMessage(ms.msg)
+		if err == nil {
+			err = ms.wal.Compact([][]byte{data})
+		}
+		if err != nil {
+			ms.log.Error("message wal compaction failed", logger.Err(err))
+		}
+	}
+	return ms.wal.Close()
+}
+
+// в журнал сообщение пишется целиком: Created и трасса должны пережить рестарт
+func encodeMessage(m models.Message) ([]byte, error) {
+	return codec.Msgpack.Marshal(m)
+}
+
+// decodeMessage читает запись журнала, сообщение с неверной контрольной суммой - ошибка
+func decodeMessage(data []byte) (models.Message, error) {
+	var msg models.Message
+	if err := codec.Msgpack.Unmarshal(data, &msg); err != nil {
+		return msg, err
+	}
+	if msg.IsEmpty() || !msg.IsValid() {
+		return models.Message{}, models.ErrInvalidChecksum
+	}
+	return msg, nil
+}
+
+type fileHashStorage struct {
+	*hashStorage
+	wal *wal
+	log logger.Logger
+}
+
+// NewFileHashStorage восстанавливает хэши из каталога dir.
+// Хранилище нужно закрыть через Close.
+func NewFileHashStorage(dir string, lg logger.Logger) (HashStorage, error) {
+	hs := &fileHashStorage{hashStorage: NewHashStorage().(*hashStorage), log: logger.Or(lg)}
+
+	var err error
+	hs.wal, err = openWAL(dir, "hashes", hs.log, func(h []byte) {
+		if !hs.unsafeIsIn(h) {
+			hs.hashes = append(hs.hashes, h)
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+	return hs, nil
+}
+
+func (hs *fileHashStorage) Add(h []byte) bool {
+	hs.mutex.Lock()
+	defer hs.mutex.Unlock()
+
+	if hs.unsafeIsIn(h) {
+		return false
+	}
+	hs.hashes = append(hs.hashes, h)
+
+	if err := hs.wal.Append(h); err != nil {
+		hs.log.Error("hash wal append failed", logger.Err(err))
+	}
+	if hs.wal.NeedsCompaction() {
+		if err := hs.wal.Compact(hs.hashes); err != nil {
+			hs.log.Error("hash wal compaction failed", logger.Err(err))
+		}
+	}
+	return true
+}
+
+func (hs *fileHashStorage) Close() error {
+	hs.mutex.Lock()
+	defer hs.mutex.Unlock()
+
+	if err := hs.wal.Compact(hs.hashes); err != nil {
+		hs.log.Error("hash wal compaction failed", logger.Err(err))
+	}
+	return hs.wal.Close()
+}
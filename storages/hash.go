@@ -13,6 +13,7 @@ type hashStorage struct {
 type HashStorage interface {
 	Add([]byte) bool
 	IsIn([]byte) bool
+	Count() int
 }
 
 func NewHashStorage() HashStorage {
@@ -23,7 +24,7 @@ func (hs *hashStorage) Add(h []byte) bool {
 	hs.mutex.Lock()
 	defer hs.mutex.Unlock()
 
-	if !hs.IsIn(h) {
+	if !hs.unsafeIsIn(h) {
 		hs.hashes = append(hs.hashes, h)
 		return true
 	}
@@ -32,6 +33,18 @@ func (hs *hashStorage) Add(h []byte) bool {
 }
 
 func (hs *hashStorage) IsIn(checkHash []byte) bool {
+	hs.mutex.Lock()
+	defer hs.mutex.Unlock()
+	return hs.unsafeIsIn(checkHash)
+}
+
+func (hs *hashStorage) Count() int {
+	hs.mutex.Lock()
+	defer hs.mutex.Unlock()
+	return len(hs.hashes)
+}
+
+func (hs *hashStorage) unsafeIsIn(checkHash []byte) bool {
 	// сложность поиска O(n)
 
 	for _, h := range hs.hashes {
@@ -32,5 +32,7 @@ func (ms *messageStorage) Set(m models.Message) bool {
 }
 
 func (ms *messageStorage) Get() models.Message {
+	ms.mutex.Lock()
+	defer ms.mutex.Unlock()
 	return ms.msg
 }
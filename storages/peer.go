@@ -1,10 +1,11 @@
 package storage
 
 import (
-	"bytes"
-	"log"
 	"sync"
+	"time"
 
+	"github.com/DemonVex/hashgossip/events"
+	"github.com/DemonVex/hashgossip/logger"
 	"github.com/DemonVex/hashgossip/models"
 )
 
@@ -14,19 +15,37 @@ type PeerStorage interface {
 	Merge([]models.Peer)
 	IsIn(models.Peer) bool
 	IsEmpty() bool
+	// отмечает, что пир жив; неизвестный пир добавляется
+	Touch(models.Peer)
+	// удаляет ушедший пир, возвращает false, если его не было в списке
+	Remove(models.Peer) bool
+	// переводит молчащих дольше suspectAfter пиров в suspect,
+	// а молчащих дольше deadAfter удаляет
+	Reap(suspectAfter, deadAfter time.Duration)
 }
 
 type peerStorage struct {
-	list  []models.Peer
-	mutex *sync.Mutex
+	list   []models.Peer
+	mutex  *sync.Mutex
+	events events.EventDelegate
+	log    logger.Logger
 }
 
-func NewPeerStorage() PeerStorage {
-	return &peerStorage{mutex: &sync.Mutex{}}
+func NewPeerStorage(ev events.EventDelegate, lg logger.Logger) PeerStorage {
+	if ev == nil {
+		ev = events.NopDelegate{}
+	}
+	return &peerStorage{mutex: &sync.Mutex{}, events: ev, log: logger.Or(lg)}
 }
 
 func (p *peerStorage) List() []models.Peer {
-	return p.list
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	// копия, чтобы читатели не гонялись с последующими append
+	list := make([]models.Peer, len(p.list))
+	copy(list, p.list)
+	return list
 }
 
 func (p *peerStorage) Add(peer models.Peer) {
@@ -36,21 +55,35 @@ func (p *peerStorage) Add(peer models.Peer) {
 }
 
 func (p *peerStorage) unsafeAdd(peer models.Peer) {
-	if !p.IsIn(peer) {
+	i := p.unsafeIndex(peer)
+	if i >= 0 && p.list[i].ID == "" && peer.ID != "" {
+		// пир мог быть добавлен по пакету без идентификатора
+		p.list[i].ID = peer.ID
+	}
+	if i < 0 {
+		peer.State = models.PeerAlive
+		peer.LastSeen = time.Now()
 		p.list = append(p.list, peer)
-		log.Printf("New peer %v", peer)
+		p.log.Info("new peer", logger.Peer(peer.ToString()), logger.F("peer_id", peer.ID))
+		p.events.OnPeerJoin(peer)
 	}
 }
 
 func (p *peerStorage) IsIn(peer models.Peer) bool {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	return p.unsafeIndex(peer) >= 0
+}
+
+func (p *peerStorage) unsafeIndex(peer models.Peer) int {
 	// поиск имеет сложность O(n)
 
-	for _, v := range p.list {
-		if v.Port == peer.Port && bytes.Equal(v.IP, peer.IP) {
-			return true
+	for i, v := range p.list {
+		if v.Equal(peer) {
+			return i
 		}
 	}
-	return false
+	return -1
 }
 
 func (p *peerStorage) Merge(list []models.Peer) {
@@ -63,5 +96,67 @@ func (p *peerStorage) Merge(list []models.Peer) {
 }
 
 func (p *peerStorage) IsEmpty() bool {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
 	return len(p.list) == 0
 }
+
+func (p *peerStorage) Touch(peer models.Peer) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	i := p.unsafeIndex(peer)
+	if i < 0 {
+		p.unsafeAdd(peer)
+		return
+	}
+
+	p.list[i].LastSeen = time.Now()
+	if peer.ID != "" {
+		// на том же адресе мог перезапуститься другой узел
+		p.list[i].ID = peer.ID
+	}
+	if p.list[i].State != models.PeerAlive {
+		p.list[i].State = models.PeerAlive
+		p.log.Info("peer is alive again", logger.Peer(peer.ToString()))
+		p.events.OnPeerUpdate(p.list[i])
+	}
+}
+
+func (p *peerStorage) Remove(peer models.Peer) bool {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	i := p.unsafeIndex(peer)
+	if i < 0 {
+		return false
+	}
+	left := p.list[i]
+	p.list = append(p.list[:i], p.list[i+1:]...)
+	p.log.Info("peer left", logger.Peer(left.ToString()), logger.F("peer_id", left.ID))
+	p.events.OnPeerLeave(left)
+	return true
+}
+
+func (p *peerStorage) Reap(suspectAfter, deadAfter time.Duration) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	now := time.Now()
+	alive := p.list[:0]
+	for _, v := range p.list {
+		silence := now.Sub(v.LastSeen)
+		switch {
+		case silence > deadAfter:
+			p.log.Info("peer left", logger.Peer(v.ToString()))
+			p.events.OnPeerLeave(v)
+			continue
+		case silence > suspectAfter && v.State == models.PeerAlive:
+			v.State = models.PeerSuspect
+			p.log.Warn("peer is suspect", logger.Peer(v.ToString()))
+			p.events.OnPeerUpdate(v)
+		}
+		alive = append(alive, v)
+	}
+	p.list = alive
+}
@@ -0,0 +1,40 @@
+package storage
+
+import (
+	"net"
+	"testing"
+
+	"github.com/DemonVex/hashgossip/events"
+	"github.com/DemonVex/hashgossip/models"
+)
+
+type leaveRecorder struct {
+	events.NopDelegate
+	left []models.Peer
+}
+
+func (r *leaveRecorder) OnPeerLeave(p models.Peer) {
+	r.left = append(r.left, p)
+}
+
+func TestPeerStorageRemove(t *testing.T) {
+	ev := &leaveRecorder{}
+	ps := NewPeerStorage(ev, quietLogger(t))
+	a := models.Peer{IP: net.ParseIP("192.0.2.1"), Port: 7946, ID: "a"}
+	b := models.Peer{IP: net.ParseIP("192.0.2.2"), Port: 7946, ID: "b"}
+	ps.Merge([]models.Peer{a, b})
+
+	// LEAVE приходит с тем же адресом и портом, что и HELLO
+	if !ps.Remove(models.Peer{IP: a.IP, Port: a.Port}) {
+		t.Fatal("Remove of a known peer returned false")
+	}
+	if ps.IsIn(a) || !ps.IsIn(b) {
+		t.Errorf("peers after Remove: %v", ps.List())
+	}
+	if len(ev.left) != 1 || ev.left[0].ID != "a" {
+		t.Errorf("OnPeerLeave got %v, want peer a", ev.left)
+	}
+	if ps.Remove(a) {
+		t.Error("Remove of an unknown peer returned true")
+	}
+}
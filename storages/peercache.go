@@ -0,0 +1,98 @@
+package storage
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/DemonVex/hashgossip/models"
+)
+
+// в models.Peer время последнего контакта не сериализуется, поэтому у кеша своя запись
+type cachedPeer struct {
+	IP       net.IP
+	Port     uint16
+	Zone     string `json:",omitempty"`
+	ID       string `json:",omitempty"`
+	LastSeen time.Time
+}
+
+// SavePeers записывает пиров в path в JSON. Файл пишется целиком
+// во временный и переименовывается, поэтому при падении остаётся прошлая версия.
+func SavePeers(path string, peers []models.Peer) error {
+	cache := make([]cachedPeer, 0, len(peers))
+	for _, p := range peers {
+		cache = append(cache, cachedPeer{IP: p.IP, Port: p.Port, Zone: p.Zone, ID: p.ID, LastSeen: p.LastSeen})
+	}
+	data, err := json.MarshalIndent(cache, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	tmp, err := ioutil.TempFile(filepath.Dir(path), filepath.Base(path)+".tmp")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// LoadPeers читает пиров из path, пропуская тех, кого не видели дольше maxAge.
+// Нулевой maxAge означает без ограничения.
+func LoadPeers(path string, maxAge time.Duration) ([]models.Peer, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var cache []cachedPeer
+	if err := json.Unmarshal(data, &cache); err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	peers := make([]models.Peer, 0, len(cache))
+	for _, c := range cache {
+		if maxAge > 0 && now.Sub(c.LastSeen) > maxAge {
+			continue
+		}
+		peers = append(peers, models.Peer{IP: c.IP, Port: c.Port, Zone: c.Zone, ID: c.ID, LastSeen: c.LastSeen})
+	}
+	return peers, nil
+}
+
+// ReadNodeID читает идентификатор узла, сохранённый LoadNodeID
+func ReadNodeID(path string) (string, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	id := strings.TrimSpace(string(data))
+	if id == "" {
+		return "", os.ErrNotExist
+	}
+	return id, nil
+}
+
+// LoadNodeID читает идентификатор узла из path, а если файла нет, сохраняет туда id
+func LoadNodeID(path, id string) (string, error) {
+	saved, err := ReadNodeID(path)
+	if err == nil {
+		return saved, nil
+	}
+	if !os.IsNotExist(err) {
+		return "", err
+	}
+	return id, ioutil.WriteFile(path, []byte(id+"\n"), 0644)
+}
@@ -0,0 +1,161 @@
+package storage
+
+import (
+	"net"
+	"sync"
+	"time"
+
+	"github.com/DemonVex/hashgossip/logger"
+	"github.com/DemonVex/hashgossip/models"
+)
+
+const maxScore = 100
+
+type score struct {
+	value   float64
+	updated time.Time
+	ban     *models.Ban
+	// адрес не штрафуется, решение запоминается, чтобы не проверять его на каждый пакет
+	exempt bool
+}
+
+type reputationStorage struct {
+	conf   models.Reputation
+	scores map[string]*score
+	exempt func(net.IP) bool
+	mutex  *sync.Mutex
+	log    logger.Logger
+}
+
+// ReputationStorage считает репутацию пиров по IP: порт отправителя у каждого
+// пакета свой, поэтому узлы за одним адресом делят общую репутацию
+type ReputationStorage interface {
+	// снимает очки за нарушение, возвращает true, если пир только что ушёл в карантин
+	Penalize(net.IP, models.Offense) bool
+	IsBanned(net.IP) bool
+	Bans() []models.Ban
+	// возвращает false, если адрес не был в карантине
+	Unban(net.IP) bool
+	// меняет штрафы и карантин на лету, набранные очки и текущие карантины сохраняются
+	SetConfig(models.Reputation)
+}
+
+// exempt выбирает адреса, которые не штрафуются, может быть nil. Узел передаёт
+// transport.IsLocalIP: все узлы на одной машине приходят с одного IP, и без этого
+// один сломанный узел отправил бы в карантин остальные.
+func NewReputationStorage(conf models.Reputation, exempt func(net.IP) bool, lg logger.Logger) ReputationStorage {
+	return &reputationStorage{conf: conf, scores: make(map[string]*score), exempt: exempt, mutex: &sync.Mutex{}, log: logger.Or(lg)}
+}
+
+func (rs *reputationStorage) Penalize(ip net.IP, o models.Offense) bool {
+	rs.mutex.Lock()
+	defer rs.mutex.Unlock()
+
+	if rs.conf.Cooldown.Duration <= 0 {
+		return false
+	}
+
+	now := time.Now()
+	key := ip.String()
+	s, ok := rs.scores[key]
+	if !ok {
+		s = &score{value: maxScore, updated: now, exempt: rs.exempt != nil && rs.exempt(ip)}
+		rs.scores[key] = s
+	}
+	if s.exempt {
+		return false
+	}
+	rs.refresh(s, now)
+	if s.ban != nil {
+		return false
+	}
+
+	s.value -= rs.penalty(o)
+	if s.value > 0 {
+		return false
+	}
+
+	s.ban = &models.Ban{IP: ip, Reason: o.String(), Until: now.Add(rs.conf.Cooldown.Duration)}
+	rs.log.Warn("peer quarantined", logger.Peer(ip.String()), logger.F("until", s.ban.Until.Format(time.RFC3339)), logger.F("reason", o))
+	return true
+}
+
+func (rs *reputationStorage) IsBanned(ip net.IP) bool {
+	rs.mutex.Lock()
+	defer rs.mutex.Unlock()
+
+	s, ok := rs.scores[ip.String()]
+	if !ok {
+		return false
+	}
+	rs.refresh(s, time.Now())
+	return s.ban != nil
+}
+
+func (rs *reputationStorage) Bans() []models.Ban {
+	rs.mutex.Lock()
+	defer rs.mutex.Unlock()
+
+	now := time.Now()
+	bans := []models.Ban{}
+	for key, s := range rs.scores {
+		rs.refresh(s, now)
+		if s.ban != nil {
+			bans = append(bans, *s.ban)
+		} else if s.value >= maxScore {
+			// полная репутация ничем не отличается от отсутствия записи
+			delete(rs.scores, key)
+		}
+	}
+	return bans
+}
+
+func (rs *reputationStorage) Unban(ip net.IP) bool {
+	rs.mutex.Lock()
+	defer rs.mutex.Unlock()
+
+	key := ip.String()
+	s, ok := rs.scores[key]
+	if !ok || s.ban == nil {
+		return false
+	}
+	delete(rs.scores, key)
+	rs.log.Info("peer unbanned", logger.Peer(ip.String()))
+	return true
+}
+
+func (rs *reputationStorage) SetConfig(conf models.Reputation) {
+	rs.mutex.Lock()
+	defer rs.mutex.Unlock()
+	rs.conf = conf
+}
+
+// refresh снимает истёкший карантин и начисляет очки за прошедшее время,
+// после карантина пир начинает с полной репутацией
+func (rs *reputationStorage) refresh(s *score, now time.Time) {
+	if s.ban != nil {
+		if now.Before(s.ban.Until) {
+			return
+		}
+		s.ban = nil
+		s.value = maxScore
+	}
+
+	s.value += now.Sub(s.updated).Seconds() * float64(rs.conf.Recovery)
+	if s.value > maxScore {
+		s.value = maxScore
+	}
+	s.updated = now
+}
+
+func (rs *reputationStorage) penalty(o models.Offense) float64 {
+	switch o {
+	case models.OffenseInvalid:
+		return float64(rs.conf.InvalidPenalty)
+	case models.OffenseMalformed:
+		return float64(rs.conf.MalformedPenalty)
+	case models.OffenseRateLimit:
+		return float64(rs.conf.RateLimitPenalty)
+	}
+	return 0
+}
@@ -0,0 +1,104 @@
+package storage
+
+import (
+	"io/ioutil"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/DemonVex/hashgossip/logger"
+	"github.com/DemonVex/hashgossip/models"
+	"github.com/DemonVex/hashgossip/transport"
+)
+
+func quietLogger(t *testing.T) logger.Logger {
+	lg, err := logger.New(ioutil.Discard, "", logger.ErrorLevel, logger.Sampling{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return lg
+}
+
+func testReputation() models.Reputation {
+	return models.Reputation{
+		InvalidPenalty:   50,
+		MalformedPenalty: 10,
+		RateLimitPenalty: 1,
+		Cooldown:         models.Duration{Duration: time.Minute},
+	}
+}
+
+func TestPenalizeBansRemoteAddress(t *testing.T) {
+	rs := NewReputationStorage(testReputation(), transport.IsLocalIP, quietLogger(t))
+	ip := net.ParseIP("192.0.2.10")
+
+	if rs.Penalize(ip, models.OffenseInvalid) {
+		t.Fatal("banned after the first offense")
+	}
+	if !rs.Penalize(ip, models.OffenseInvalid) {
+		t.Fatal("not banned with zero reputation")
+	}
+	if !rs.IsBanned(ip) {
+		t.Fatal("IsBanned = false after ban")
+	}
+	// узел с другим адресом карантин не затрагивает
+	if rs.IsBanned(net.ParseIP("192.0.2.11")) {
+		t.Error("another address is banned")
+	}
+
+	bans := rs.Bans()
+	if len(bans) != 1 || !bans[0].IP.Equal(ip) || bans[0].Reason != models.OffenseInvalid.String() {
+		t.Fatalf("Bans() = %+v", bans)
+	}
+	if !rs.Unban(ip) || rs.IsBanned(ip) {
+		t.Error("Unban did not lift the ban")
+	}
+	if rs.Unban(ip) {
+		t.Error("Unban of a free address returned true")
+	}
+}
+
+func TestPenalizeExemptsLocalAddresses(t *testing.T) {
+	rs := NewReputationStorage(testReputation(), transport.IsLocalIP, quietLogger(t))
+	for _, ip := range []net.IP{net.ParseIP("127.0.0.1"), net.ParseIP("127.0.0.2"), net.IPv6loopback} {
+		for i := 0; i < 10; i++ {
+			if rs.Penalize(ip, models.OffenseInvalid) {
+				t.Fatalf("local address %v is banned", ip)
+			}
+		}
+		if rs.IsBanned(ip) {
+			t.Errorf("local address %v is banned", ip)
+		}
+	}
+	if bans := rs.Bans(); len(bans) != 0 {
+		t.Errorf("Bans() = %+v, want none", bans)
+	}
+}
+
+func TestPenalizeExemptIsCheckedOnce(t *testing.T) {
+	calls := 0
+	rs := NewReputationStorage(testReputation(), func(net.IP) bool {
+		calls++
+		return true
+	}, quietLogger(t))
+	ip := net.ParseIP("192.0.2.10")
+	for i := 0; i < 100; i++ {
+		rs.Penalize(ip, models.OffenseRateLimit)
+	}
+	if calls != 1 {
+		t.Errorf("exempt is called %v times, want once per address", calls)
+	}
+}
+
+func TestPenalizeWithoutCooldown(t *testing.T) {
+	conf := testReputation()
+	conf.Cooldown = models.Duration{}
+	rs := NewReputationStorage(conf, nil, quietLogger(t))
+	ip := net.ParseIP("192.0.2.10")
+	for i := 0; i < 10; i++ {
+		rs.Penalize(ip, models.OffenseInvalid)
+	}
+	if rs.IsBanned(ip) {
+		t.Error("zero Cooldown must disable quarantine")
+	}
+}
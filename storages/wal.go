@@ -0,0 +1,171 @@
+package storage
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/DemonVex/hashgossip/logger"
+)
+
+// запись в журнале и снимке: длина данных и CRC32 (IEEE), обе uint32 little endian, затем данные
+const walHeaderLen = 8
+
+// после стольких записей в журнале он сворачивается в снимок
+const compactEvery = 1024
+
+// больше записи не бывает: хэш или сообщение, которое влезает в датаграмму
+const maxRecordLen = 1 << 20
+
+var errBadRecord = errors.New("bad record")
+
+// wal - журнал изменений name.wal и снимок name.snap в каталоге dir.
+// Журнал пишется без fsync: после падения процесса данные есть в кеше ОС,
+// а оборванная при отключении питания запись отсекается по CRC.
+type wal struct {
+	path     string
+	snapPath string
+	file     *os.File
+	appended int
+}
+
+// openWAL проигрывает снимок, затем журнал, вызывая apply на каждую запись,
+// и открывает журнал на дозапись. Битый хвост журнала обрезается.
+func openWAL(dir, name string, lg logger.Logger, apply func([]byte)) (*wal, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	w := &wal{path: filepath.Join(dir, name+".wal"), snapPath: filepath.Join(dir, name+".snap")}
+
+	if err := replayFile(w.snapPath, apply); err != nil && !os.IsNotExist(err) {
+		// снимок пишется во временный файл и переименовывается, битым он быть не должен
+		return nil, errors.New(fmt.Sprintf("%v: %v", w.snapPath, err))
+	}
+
+	file, err := os.OpenFile(w.path, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, err
+	}
+	good, err := replay(file, apply)
+	if err != nil {
+		lg.Warn("truncating broken wal tail", logger.F("path", w.path), logger.F("valid_bytes", good), logger.Err(err))
+		if err := file.Truncate(good); err != nil {
+			file.Close()
+			return nil, err
+		}
+	}
+	if _, err := file.Seek(good, io.SeekStart); err != nil {
+		file.Close()
+		return nil, err
+	}
+	w.file = file
+	return w, nil
+}
+
+func (w *wal) Append(data []byte) error {
+	if _, err := w.file.Write(record(data)); err != nil {
+		return err
+	}
+	w.appended++
+	return nil
+}
+
+func (w *wal) NeedsCompaction() bool {
+	return w.appended >= compactEvery
+}
+
+// Compact записывает records как новый снимок и очищает журнал.
+// Если процесс упадёт между этими шагами, журнал проиграется поверх снимка,
+// поэтому apply должен быть идемпотентным.
+func (w *wal) Compact(records [][]byte) error {
+	tmp := w.snapPath + ".tmp"
+	file, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	buf := bufio.NewWriter(file)
+	for _, r := range records {
+		if _, err := buf.Write(record(r)); err != nil {
+			file.Close()
+			return err
+		}
+	}
+	if err := buf.Flush(); err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Sync(); err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, w.snapPath); err != nil {
+		return err
+	}
+
+	if err := w.file.Truncate(0); err != nil {
+		return err
+	}
+	if _, err := w.file.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	w.appended = 0
+	return nil
+}
+
+func (w *wal) Close() error {
+	return w.file.Close()
+}
+
+func record(data []byte) []byte {
+	r := make([]byte, walHeaderLen+len(data))
+	binary.LittleEndian.PutUint32(r, uint32(len(data)))
+	binary.LittleEndian.PutUint32(r[4:], crc32.ChecksumIEEE(data))
+	copy(r[walHeaderLen:], data)
+	return r
+}
+
+func replayFile(path string, apply func([]byte)) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	_, err = replay(file, apply)
+	return err
+}
+
+// replay читает записи до конца файла и возвращает смещение за последней целой записью
+func replay(r io.Reader, apply func([]byte)) (int64, error) {
+	buf := bufio.NewReader(r)
+	var good int64
+	header := make([]byte, walHeaderLen)
+	for {
+		if _, err := io.ReadFull(buf, header); err != nil {
+			if err == io.EOF {
+				return good, nil
+			}
+			return good, err
+		}
+		size := binary.LittleEndian.Uint32(header)
+		if size > maxRecordLen {
+			return good, errBadRecord
+		}
+		data := make([]byte, size)
+		if _, err := io.ReadFull(buf, data); err != nil {
+			return good, err
+		}
+		if crc32.ChecksumIEEE(data) != binary.LittleEndian.Uint32(header[4:]) {
+			return good, errBadRecord
+		}
+		apply(data)
+		good += int64(walHeaderLen + len(data))
+	}
+}
@@ -0,0 +1,264 @@
+package storage
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/DemonVex/hashgossip/models"
+)
+
+func collect(records *[][]byte) func([]byte) {
+	return func(data []byte) {
+		*records = append(*records, append([]byte{}, data...))
+	}
+}
+
+func TestWALReplay(t *testing.T) {
+	dir := t.TempDir()
+	w, err := openWAL(dir, "test", quietLogger(t), func([]byte) {})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 3; i++ {
+		if err := w.Append([]byte(fmt.Sprintf("record %v", i))); err != nil {
+			t.Fatal(err)
+		}
+	}
+	w.Close()
+
+	var got [][]byte
+	w, err = openWAL(dir, "test", quietLogger(t), collect(&got))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+	if len(got) != 3 || string(got[2]) != "record 2" {
+		t.Errorf("replayed %q", got)
+	}
+}
+
+func TestWALTruncatesBrokenTail(t *testing.T) {
+	tests := []struct {
+		name    string
+		corrupt func(data []byte) []byte
+	}{
+		// питание пропало посреди записи
+		{"short data", func(data []byte) []byte { return data[:len(data)-3] }},
+		{"short header", func(data []byte) []byte { return data[:len(data)-len(record([]byte("tail")))+4] }},
+		// запись на месте, но не те байты
+		{"bad crc", func(data []byte) []byte {
+			data[len(data)-1] ^= 0xff
+			return data
+		}},
+		{"huge length", func(data []byte) []byte {
+			tail := len(data) - len(record([]byte("tail")))
+			copy(data[tail:], []byte{0xff, 0xff, 0xff, 0x7f})
+			return data
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			w, err := openWAL(dir, "test", quietLogger(t), func([]byte) {})
+			if err != nil {
+				t.Fatal(err)
+			}
+			w.Append([]byte("first"))
+			w.Append([]byte("second"))
+			w.Append([]byte("tail"))
+			w.Close()
+
+			path := filepath.Join(dir, "test.wal")
+			data, err := ioutil.ReadFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := ioutil.WriteFile(path, tt.corrupt(data), 0644); err != nil {
+				t.Fatal(err)
+			}
+
+			var got [][]byte
+			w, err = openWAL(dir, "test", quietLogger(t), collect(&got))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(got) != 2 || string(got[1]) != "second" {
+				t.Fatalf("replayed %q, want the records before the broken one", got)
+			}
+			// новая запись дописывается за последней целой, а не за мусором
+			if err := w.Append([]byte("after")); err != nil {
+				t.Fatal(err)
+			}
+			w.Close()
+
+			got = nil
+			w, err = openWAL(dir, "test", quietLogger(t), collect(&got))
+			if err != nil {
+				t.Fatal(err)
+			}
+			w.Close()
+			if len(got) != 3 || string(got[2]) != "after" {
+				t.Errorf("after truncation replayed %q", got)
+			}
+		})
+	}
+}
+
+func TestWALCompact(t *testing.T) {
+	dir := t.TempDir()
+	w, err := openWAL(dir, "test", quietLogger(t), func([]byte) {})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < compactEvery; i++ {
+		w.Append([]byte{byte(i)})
+	}
+	if !w.NeedsCompaction() {
+		t.Fatal("NeedsCompaction = false after compactEvery records")
+	}
+	if err := w.Compact([][]byte{[]byte("snap")}); err != nil {
+		t.Fatal(err)
+	}
+	if w.NeedsCompaction() {
+		t.Error("NeedsCompaction = true right after Compact")
+	}
+	w.Append([]byte("wal"))
+	w.Close()
+
+	var got [][]byte
+	w, err = openWAL(dir, "test", quietLogger(t), collect(&got))
+	if err != nil {
+		t.Fatal(err)
+	}
+	w.Close()
+	// сначала снимок, потом журнал
+	if len(got) != 2 || string(got[0]) != "snap" || string(got[1]) != "wal" {
+		t.Errorf("replayed %q, want snap then wal", got)
+	}
+}
+
+func TestWALBrokenSnapshot(t *testing.T) {
+	dir := t.TempDir()
+	snap := record([]byte("snap"))
+	snap[len(snap)-1] ^= 0xff
+	if err := ioutil.WriteFile(filepath.Join(dir, "test.snap"), snap, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if w, err := openWAL(dir, "test", quietLogger(t), func([]byte) {}); err == nil {
+		w.Close()
+		t.Error("broken snapshot is accepted")
+	}
+}
+
+func TestFileMessageStorageKeepsWholeMessage(t *testing.T) {
+	dir := t.TempDir()
+	ms, err := NewFileMessageStorage(dir, quietLogger(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	msg, err := models.NewMessage([]byte("hello"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	msg.Created = 42
+	ms.Set(msg)
+	// без Close: узел упал, сообщение есть только в журнале
+	ms.(*fileMessageStorage).wal.Close()
+
+	restored, err := NewFileMessageStorage(dir, quietLogger(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := restored.Get()
+	if !bytes.Equal(got.Payload, msg.Payload) || !bytes.Equal(got.Checksum, msg.Checksum) ||
+		got.Created != 42 || !bytes.Equal(got.TraceID, msg.TraceID) || !bytes.Equal(got.SpanID, msg.SpanID) {
+		t.Errorf("restored %+v, want %+v", got, msg)
+	}
+
+	// и после сворачивания в снимок при остановке
+	restored.(*fileMessageStorage).Close()
+	again, err := NewFileMessageStorage(dir, quietLogger(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer again.(*fileMessageStorage).Close()
+	if got := again.Get(); got.Created != 42 || !bytes.Equal(got.TraceID, msg.TraceID) {
+		t.Errorf("restored from snapshot %+v, want %+v", got, msg)
+	}
+}
+
+func TestFileMessageStorageSkipsBadRecords(t *testing.T) {
+	dir := t.TempDir()
+	good, err := models.NewMessage([]byte("good"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	forged := good
+	forged.Payload = []byte("forged")
+	forged.Created = good.Created + 1
+	goodData, _ := encodeMessage(good)
+	forgedData, _ := encodeMessage(forged)
+
+	// CRC у записей верный, битое только их содержимое
+	w, err := openWAL(dir, "messages", quietLogger(t), func([]byte) {})
+	if err != nil {
+		t.Fatal(err)
+	}
+	w.Append([]byte("payload without message"))
+	w.Append(goodData)
+	w.Append(forgedData)
+	w.Close()
+
+	ms, err := NewFileMessageStorage(dir, quietLogger(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ms.(*fileMessageStorage).Close()
+	if got := ms.Get(); !bytes.Equal(got.Payload, good.Payload) || !got.IsValid() {
+		t.Errorf("restored %q, want the only valid record %q", got.Payload, good.Payload)
+	}
+}
+
+func TestDecodeMessageRejectsInvalid(t *testing.T) {
+	msg, err := models.NewMessage([]byte("hello"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	msg.Checksum = []byte("wrong")
+	data, _ := encodeMessage(msg)
+	if _, err := decodeMessage(data); err != models.ErrInvalidChecksum {
+		t.Errorf("decodeMessage(bad checksum) error = %v, want %v", err, models.ErrInvalidChecksum)
+	}
+	empty, _ := encodeMessage(models.Message{})
+	if _, err := decodeMessage(empty); err == nil {
+		t.Error("decodeMessage(empty message) succeeded")
+	}
+	if _, err := decodeMessage([]byte{0xc1}); err == nil {
+		t.Error("decodeMessage(garbage) succeeded")
+	}
+}
+
+func TestFileHashStorage(t *testing.T) {
+	dir := t.TempDir()
+	hs, err := NewFileHashStorage(dir, quietLogger(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	hs.Add([]byte{1})
+	hs.Add([]byte{2})
+	hs.Add([]byte{1})
+	hs.(*fileHashStorage).wal.Close()
+
+	restored, err := NewFileHashStorage(dir, quietLogger(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer restored.(*fileHashStorage).Close()
+	if !restored.Add([]byte{3}) || restored.Add([]byte{2}) {
+		t.Error("restored hashes differ from the saved ones")
+	}
+}
@@ -0,0 +1,67 @@
+package hashgossip
+
+import (
+	"sync"
+
+	"github.com/DemonVex/hashgossip/events"
+	"github.com/DemonVex/hashgossip/logger"
+	m "github.com/DemonVex/hashgossip/models"
+)
+
+// Subscribe возвращает канал с новыми сообщениями, пришедшими от других узлов.
+// Собственные сообщения, отправленные через Publish, в канал не попадают.
+// Канал закрывается после остановки узла.
+func (n *Node) Subscribe() <-chan m.Message {
+	return n.subs.add()
+}
+
+type subscriptions struct {
+	events.NopDelegate
+
+	mutex  *sync.Mutex
+	subs   []chan m.Message
+	closed bool
+	log    logger.Logger
+}
+
+func newSubscriptions(lg logger.Logger) *subscriptions {
+	return &subscriptions{mutex: &sync.Mutex{}, log: lg}
+}
+
+func (s *subscriptions) add() <-chan m.Message {
+	ch := make(chan m.Message, 16)
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.closed {
+		close(ch)
+	} else {
+		s.subs = append(s.subs, ch)
+	}
+	return ch
+}
+
+func (s *subscriptions) OnMessageAccepted(msg m.Message) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	for _, ch := range s.subs {
+		// медленный подписчик не должен задерживать остальных
+		select {
+		case ch <- msg:
+		default:
+			s.log.Warn("subscriber is too slow, message dropped", logger.Hash(msg.GetHash()))
+		}
+	}
+}
+
+func (s *subscriptions) close() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	for _, ch := range s.subs {
+		close(ch)
+	}
+	s.subs = nil
+	s.closed = true
+}
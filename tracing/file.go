@@ -0,0 +1,64 @@
+package tracing
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"os"
+	"sync"
+
+	"github.com/DemonVex/hashgossip/logger"
+)
+
+type fileTracer struct {
+	mutex *sync.Mutex
+	file  *os.File
+	log   logger.Logger
+}
+
+// NewFileTracer дописывает события в path по одному JSON на строку.
+// Файл открыт с O_APPEND, поэтому в него могут писать несколько процессов
+func NewFileTracer(path string, lg logger.Logger) (Tracer, error) {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, err
+	}
+	return &fileTracer{mutex: &sync.Mutex{}, file: f, log: logger.Or(lg)}, nil
+}
+
+func (t *fileTracer) Record(e Event) {
+	line, err := json.Marshal(e)
+	if err != nil {
+		t.log.Error("can't marshal trace event", logger.Err(err))
+		return
+	}
+	line = append(line, '\n')
+
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	// одна запись на строку, чтобы строки разных процессов не перемешивались
+	if _, err := t.file.Write(line); err != nil {
+		t.log.Warn("trace write failed", logger.Err(err))
+	}
+}
+
+func (t *fileTracer) Close() error {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	return t.file.Close()
+}
+
+// ReadEvents читает события, записанные NewFileTracer. Битые строки,
+// например недописанная последняя, пропускаются
+func ReadEvents(r io.Reader) ([]Event, error) {
+	var events []Event
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		var e Event
+		if err := json.Unmarshal(scanner.Bytes(), &e); err != nil {
+			continue
+		}
+		events = append(events, e)
+	}
+	return events, scanner.Err()
+}
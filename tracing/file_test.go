@@ -0,0 +1,73 @@
+package tracing
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestFileTracerRoundTrip(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "trace.jsonl")
+	tr, err := NewFileTracer(path, quietLogger(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	events := propagation()
+	node := WithNode(tr, "a")
+	for _, e := range events {
+		node.Record(e)
+	}
+	tr.Close()
+
+	// второй процесс дописывает в тот же файл, последняя строка оборвана
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.WriteString(`{"time":"2024-01-01T00:00:00Z","kind":"pub`)
+	f.Close()
+
+	f, err = os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	got, err := ReadEvents(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != len(events) {
+		t.Fatalf("read %v events, want %v", len(got), len(events))
+	}
+	for i := range events {
+		want := events[i]
+		// WithNode подставляет узел во все события
+		want.NodeID = "a"
+		if !got[i].Time.Equal(want.Time) {
+			t.Errorf("event %v time %v, want %v", i, got[i].Time, want.Time)
+		}
+		got[i].Time = want.Time
+		if !reflect.DeepEqual(got[i], want) {
+			t.Errorf("event %v = %+v, want %+v", i, got[i], want)
+		}
+	}
+}
+
+type recordTracer struct {
+	events []Event
+	closed bool
+}
+
+func (r *recordTracer) Record(e Event) { r.events = append(r.events, e) }
+func (r *recordTracer) Close() error   { r.closed = true; return nil }
+
+func TestMulti(t *testing.T) {
+	a, b := &recordTracer{}, &recordTracer{}
+	m := Multi(a, b)
+	m.Record(Event{Kind: KindPublish})
+	m.Close()
+	if len(a.events) != 1 || len(b.events) != 1 || !a.closed || !b.closed {
+		t.Errorf("Multi delivered %v and %v events, closed %v and %v", len(a.events), len(b.events), a.closed, b.closed)
+	}
+}
@@ -0,0 +1,209 @@
+package tracing
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/DemonVex/hashgossip/logger"
+)
+
+const (
+	otlpQueueSize = 4096
+	otlpBatchSize = 512
+	otlpInterval  = time.Second
+)
+
+// виды участков OTLP
+const (
+	spanKindInternal = 1
+	spanKindProducer = 4
+	spanKindConsumer = 5
+)
+
+// otlpTracer отправляет события коллектору по OTLP/HTTP в JSON кодировке.
+// Каждое событие - участок нулевой длины: publish и accept со своим SpanID,
+// а receive и forward получают случайный SpanID и родителя из события.
+type otlpTracer struct {
+	endpoint string
+	client   *http.Client
+	log      logger.Logger
+
+	queue     chan Event
+	stop      chan struct{}
+	done      chan struct{}
+	closeOnce *sync.Once
+}
+
+// NewOTLPTracer отправляет события на endpoint, например http://127.0.0.1:4318/v1/traces.
+// При переполненной очереди или недоступном коллекторе события теряются
+func NewOTLPTracer(endpoint string, lg logger.Logger) Tracer {
+	t := &otlpTracer{
+		endpoint:  endpoint,
+		client:    &http.Client{Timeout: 5 * time.Second},
+		log:       logger.Or(lg),
+		queue:     make(chan Event, otlpQueueSize),
+		stop:      make(chan struct{}),
+		done:      make(chan struct{}),
+		closeOnce: &sync.Once{},
+	}
+	go t.loop()
+	return t
+}
+
+func (t *otlpTracer) Record(e Event) {
+	select {
+	case t.queue <- e:
+	default:
+		t.log.Debug("trace queue is full, event dropped")
+	}
+}
+
+func (t *otlpTracer) Close() error {
+	t.closeOnce.Do(func() { close(t.stop) })
+	<-t.done
+	return nil
+}
+
+func (t *otlpTracer) loop() {
+	defer close(t.done)
+	ticker := time.NewTicker(otlpInterval)
+	defer ticker.Stop()
+
+	batch := make([]Event, 0, otlpBatchSize)
+	flush := func() {
+		if len(batch) == 0 {
+			return
+		}
+		if err := t.export(batch); err != nil {
+			t.log.Warn("trace export failed", logger.F("events", len(batch)), logger.Err(err))
+		}
+		batch = batch[:0]
+	}
+
+	for {
+		select {
+		case e := <-t.queue:
+			batch = append(batch, e)
+			if len(batch) == otlpBatchSize {
+				flush()
+			}
+		case <-ticker.C:
+			flush()
+		case <-t.stop:
+			// то, что успело попасть в очередь, отправляется перед выходом
+			for {
+				select {
+				case e := <-t.queue:
+					batch = append(batch, e)
+					if len(batch) == otlpBatchSize {
+						flush()
+					}
+				default:
+					flush()
+					return
+				}
+			}
+		}
+	}
+}
+
+func (t *otlpTracer) export(events []Event) error {
+	body, err := json.Marshal(otlpRequest(events))
+	if err != nil {
+		return err
+	}
+	resp, err := t.client.Post(t.endpoint, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(ioutil.Discard, resp.Body)
+
+	if resp.StatusCode/100 != 2 {
+		return errors.New(fmt.Sprintf("collector answered %v", resp.Status))
+	}
+	return nil
+}
+
+type otlpValue struct {
+	StringValue string `json:"stringValue"`
+}
+
+type otlpAttribute struct {
+	Key   string    `json:"key"`
+	Value otlpValue `json:"value"`
+}
+
+type otlpSpan struct {
+	TraceID           string          `json:"traceId"`
+	SpanID            string          `json:"spanId"`
+	ParentSpanID      string          `json:"parentSpanId,omitempty"`
+	Name              string          `json:"name"`
+	Kind              int             `json:"kind"`
+	StartTimeUnixNano string          `json:"startTimeUnixNano"`
+	EndTimeUnixNano   string          `json:"endTimeUnixNano"`
+	Attributes        []otlpAttribute `json:"attributes"`
+}
+
+// otlpRequest собирает тело ExportTraceServiceRequest
+func otlpRequest(events []Event) interface{} {
+	spans := make([]otlpSpan, 0, len(events))
+	for _, e := range events {
+		ts := strconv.FormatInt(e.Time.UnixNano(), 10)
+		s := otlpSpan{
+			TraceID:           e.TraceID,
+			SpanID:            e.SpanID,
+			ParentSpanID:      e.ParentSpanID,
+			Name:              string(e.Kind),
+			Kind:              spanKindInternal,
+			StartTimeUnixNano: ts,
+			EndTimeUnixNano:   ts,
+			Attributes: []otlpAttribute{
+				{Key: "hashgossip.node_id", Value: otlpValue{e.NodeID}},
+				{Key: "hashgossip.msg_hash", Value: otlpValue{e.Hash}},
+			},
+		}
+		switch e.Kind {
+		case KindReceive:
+			s.SpanID, s.ParentSpanID, s.Kind = randomSpanID(), e.SpanID, spanKindConsumer
+		case KindForward:
+			s.SpanID, s.ParentSpanID, s.Kind = randomSpanID(), e.SpanID, spanKindProducer
+		}
+		if e.Peer != "" {
+			s.Attributes = append(s.Attributes, otlpAttribute{Key: "net.peer.name", Value: otlpValue{e.Peer}})
+		}
+		spans = append(spans, s)
+	}
+
+	return map[string]interface{}{
+		"resourceSpans": []interface{}{
+			map[string]interface{}{
+				"resource": map[string]interface{}{
+					"attributes": []otlpAttribute{{Key: "service.name", Value: otlpValue{"hashgossip"}}},
+				},
+				"scopeSpans": []interface{}{
+					map[string]interface{}{
+						"scope": map[string]string{"name": "github.com/DemonVex/hashgossip"},
+						"spans": spans,
+					},
+				},
+			},
+		},
+	}
+}
+
+func randomSpanID() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,124 @@
+package tracing
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/DemonVex/hashgossip/logger"
+)
+
+func quietLogger(t *testing.T) logger.Logger {
+	lg, err := logger.New(ioutil.Discard, "", logger.ErrorLevel, logger.Sampling{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return lg
+}
+
+// exportRequest - часть ExportTraceServiceRequest, которую проверяют тесты
+type exportRequest struct {
+	ResourceSpans []struct {
+		ScopeSpans []struct {
+			Spans []otlpSpan `json:"spans"`
+		} `json:"scopeSpans"`
+	} `json:"resourceSpans"`
+}
+
+func decodeSpans(t *testing.T, body []byte) []otlpSpan {
+	t.Helper()
+	var req exportRequest
+	if err := json.Unmarshal(body, &req); err != nil {
+		t.Fatal(err)
+	}
+	if len(req.ResourceSpans) != 1 || len(req.ResourceSpans[0].ScopeSpans) != 1 {
+		t.Fatalf("unexpected request shape: %s", body)
+	}
+	return req.ResourceSpans[0].ScopeSpans[0].Spans
+}
+
+// propagation - a публикует сообщение и отправляет его b, b принимает его
+func propagation() []Event {
+	at := time.Unix(1700000000, 0)
+	return []Event{
+		{Time: at, Kind: KindPublish, TraceID: "t1", SpanID: "a1", NodeID: "a", Hash: "abcd"},
+		{Time: at.Add(time.Millisecond), Kind: KindForward, TraceID: "t1", SpanID: "a1", NodeID: "a", Hash: "abcd", Peer: "b:1"},
+		{Time: at.Add(2 * time.Millisecond), Kind: KindReceive, TraceID: "t1", SpanID: "a1", NodeID: "b", Hash: "abcd", Peer: "a:1"},
+		{Time: at.Add(2 * time.Millisecond), Kind: KindAccept, TraceID: "t1", SpanID: "b1", ParentSpanID: "a1", NodeID: "b", Hash: "abcd", Peer: "a:1"},
+	}
+}
+
+func TestOTLPRequestParentLinks(t *testing.T) {
+	body, err := json.Marshal(otlpRequest(propagation()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	spans := decodeSpans(t, body)
+	if len(spans) != 4 {
+		t.Fatalf("got %v spans, want 4", len(spans))
+	}
+	publish, forward, receive, accept := spans[0], spans[1], spans[2], spans[3]
+
+	if publish.SpanID != "a1" || publish.ParentSpanID != "" || publish.Kind != spanKindInternal {
+		t.Errorf("publish span %+v, want root a1", publish)
+	}
+	// receive и forward - отдельные участки под участком отправителя
+	if forward.SpanID == "a1" || len(forward.SpanID) != 16 || forward.ParentSpanID != "a1" || forward.Kind != spanKindProducer {
+		t.Errorf("forward span %+v, want a new span under a1", forward)
+	}
+	if receive.SpanID == "a1" || len(receive.SpanID) != 16 || receive.ParentSpanID != "a1" || receive.Kind != spanKindConsumer {
+		t.Errorf("receive span %+v, want a new span under a1", receive)
+	}
+	if forward.SpanID == receive.SpanID {
+		t.Error("forward and receive share a span id")
+	}
+	if accept.SpanID != "b1" || accept.ParentSpanID != "a1" || accept.Kind != spanKindInternal {
+		t.Errorf("accept span %+v, want b1 under a1", accept)
+	}
+
+	for _, s := range spans {
+		if s.TraceID != "t1" || s.StartTimeUnixNano != s.EndTimeUnixNano {
+			t.Errorf("span %+v, want trace t1 and zero duration", s)
+		}
+	}
+	if publish.StartTimeUnixNano != "1700000000000000000" {
+		t.Errorf("publish time %v, want unix nanoseconds as a string", publish.StartTimeUnixNano)
+	}
+	attrs := make(map[string]string)
+	for _, a := range forward.Attributes {
+		attrs[a.Key] = a.Value.StringValue
+	}
+	if attrs["hashgossip.node_id"] != "a" || attrs["hashgossip.msg_hash"] != "abcd" || attrs["net.peer.name"] != "b:1" {
+		t.Errorf("forward attributes %v", attrs)
+	}
+}
+
+func TestOTLPTracerExportsOnClose(t *testing.T) {
+	bodies := make(chan []byte, 10)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost || r.Header.Get("Content-Type") != "application/json" {
+			t.Errorf("got %v with %v", r.Method, r.Header.Get("Content-Type"))
+		}
+		body, _ := ioutil.ReadAll(r.Body)
+		bodies <- body
+	}))
+	defer server.Close()
+
+	tr := NewOTLPTracer(server.URL, quietLogger(t))
+	for _, e := range propagation() {
+		tr.Record(e)
+	}
+	// Close отправляет всё, что успело попасть в очередь
+	tr.Close()
+
+	var spans []otlpSpan
+	for len(bodies) > 0 {
+		spans = append(spans, decodeSpans(t, <-bodies)...)
+	}
+	if len(spans) != 4 {
+		t.Errorf("collector got %v spans, want 4", len(spans))
+	}
+}
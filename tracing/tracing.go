@@ -0,0 +1,91 @@
+package tracing
+
+import (
+	"encoding/hex"
+	"time"
+)
+
+// Kind - что произошло с сообщением на узле
+type Kind string
+
+const (
+	// узел создал сообщение, SpanID - корень трассы
+	KindPublish Kind = "publish"
+	// пришла копия сообщения, SpanID - участок отправителя
+	KindReceive Kind = "receive"
+	// сообщение принято впервые, SpanID - новый участок узла, ParentSpanID - отправителя
+	KindAccept Kind = "accept"
+	// сообщение отправлено пиру Peer, SpanID - участок узла
+	KindForward Kind = "forward"
+)
+
+// Event - запись о сообщении на одном узле. Идентификаторы в hex,
+// как в OTLP JSON, поэтому файлы разных узлов можно склеивать и грепать
+type Event struct {
+	Time         time.Time `json:"time"`
+	Kind         Kind      `json:"kind"`
+	TraceID      string    `json:"trace_id"`
+	SpanID       string    `json:"span_id"`
+	ParentSpanID string    `json:"parent_span_id,omitempty"`
+	NodeID       string    `json:"node_id,omitempty"`
+	Hash         string    `json:"msg_hash"`
+	// откуда пришло сообщение или куда ушло
+	Peer string `json:"peer,omitempty"`
+}
+
+func NewEvent(kind Kind, traceID, spanID, parentSpanID, hash []byte, peer string) Event {
+	return Event{
+		Time:         time.Now(),
+		Kind:         kind,
+		TraceID:      hex.EncodeToString(traceID),
+		SpanID:       hex.EncodeToString(spanID),
+		ParentSpanID: hex.EncodeToString(parentSpanID),
+		Hash:         hex.EncodeToString(hash),
+		Peer:         peer,
+	}
+}
+
+// Tracer получает события из горутины приёма пакетов и рассылки,
+// поэтому Record не должен блокироваться надолго
+type Tracer interface {
+	Record(Event)
+	Close() error
+}
+
+type nodeTracer struct {
+	Tracer
+	nodeID string
+}
+
+// WithNode подставляет id узла во все события
+func WithNode(t Tracer, id string) Tracer {
+	return nodeTracer{Tracer: t, nodeID: id}
+}
+
+func (t nodeTracer) Record(e Event) {
+	e.NodeID = t.nodeID
+	t.Tracer.Record(e)
+}
+
+type multiTracer []Tracer
+
+// Multi отправляет события во все трассировщики
+func Multi(tracers ...Tracer) Tracer {
+	return multiTracer(tracers)
+}
+
+func (m multiTracer) Record(e Event) {
+	for _, t := range m {
+		t.Record(e)
+	}
+}
+
+func (m multiTracer) Close() error {
+	var first error
+	for _, t := range m {
+		if err := t.Close(); err != nil && first == nil {
+			first = err
+		}
+	}
+	return first
+}
@@ -0,0 +1,181 @@
+package transport
+
+import (
+	"errors"
+	"fmt"
+	"net"
+)
+
+// ResolveBindAddr разбирает BindAddress из конфига: допускается как просто IP,
+// так и пара host:port. Пустая строка означает все интерфейсы и случайный порт.
+func ResolveBindAddr(network, bind string) (*net.UDPAddr, error) {
+	if bind == "" {
+		return nil, nil
+	}
+	if _, _, err := net.SplitHostPort(bind); err == nil {
+		return net.ResolveUDPAddr(network, bind)
+	}
+
+	ip := net.ParseIP(bind)
+	if ip == nil {
+		return nil, fmt.Errorf("invalid bind address %q", bind)
+	}
+	return &net.UDPAddr{IP: ip}, nil
+}
+
+// ResolveAdvertiseIP определяет адрес, который узел сообщает о себе другим пирам.
+// Адреса перебираются по порядку, берётся первый найденный:
+//  1. явный AdvertiseAddress;
+//  2. адрес интерфейса Interface;
+//  3. BindAddress, если он не 0.0.0.0 или ::;
+//  4. первый приватный адрес среди поднятых интерфейсов, кроме loopback;
+//  5. адрес исходящего соединения до публичного DNS;
+//  6. loopback адрес нужного семейства.
+//
+// Последний вариант нужен машинам без сети и без маршрута наружу: узел
+// запускается, но другие машины до него не достучатся, поэтому вызывающему
+// стоит предупредить, что нужно задать AdvertiseAddress.
+func ResolveAdvertiseIP(network, advertise, iface string, bind *net.UDPAddr) (net.IP, error) {
+	if advertise != "" {
+		ip := net.ParseIP(advertise)
+		if ip == nil {
+			return nil, fmt.Errorf("invalid advertise address %q", advertise)
+		}
+		return ip, nil
+	}
+
+	if iface != "" {
+		return interfaceIP(network, iface)
+	}
+
+	if bind != nil && bind.IP != nil && !bind.IP.IsUnspecified() {
+		return bind.IP, nil
+	}
+
+	if ip := privateIP(network); ip != nil {
+		return ip, nil
+	}
+
+	if ip, err := outboundIP(network); err == nil {
+		return ip, nil
+	}
+	return loopbackIP(network), nil
+}
+
+func loopbackIP(network string) net.IP {
+	if network == "udp6" {
+		return net.IPv6loopback
+	}
+	return net.IPv4(127, 0, 0, 1).To4()
+}
+
+func interfaceIP(network, name string) (net.IP, error) {
+	ifi, err := net.InterfaceByName(name)
+	if err != nil {
+		return nil, err
+	}
+	addrs, err := ifi.Addrs()
+	if err != nil {
+		return nil, err
+	}
+
+	for _, ip := range familyAddrs(network, addrs) {
+		if !ip.IsLinkLocalUnicast() {
+			return ip, nil
+		}
+	}
+	return nil, fmt.Errorf("interface %v has no usable %v address", name, network)
+}
+
+var privateIP = func(network string) net.IP {
+	ifaces, err := net.Interfaces()
+	if err != nil {
+		return nil
+	}
+
+	for _, ifi := range ifaces {
+		if ifi.Flags&net.FlagUp == 0 || ifi.Flags&net.FlagLoopback != 0 {
+			continue
+		}
+		addrs, err := ifi.Addrs()
+		if err != nil {
+			continue
+		}
+		for _, ip := range familyAddrs(network, addrs) {
+			if ip.IsPrivate() {
+				return ip
+			}
+		}
+	}
+	return nil
+}
+
+// familyAddrs отбирает адреса подходящего семейства. Для двухстекового "udp"
+// сначала идут IPv4 адреса, затем IPv6.
+func familyAddrs(network string, addrs []net.Addr) []net.IP {
+	var v4, v6 []net.IP
+	for _, a := range addrs {
+		ipnet, ok := a.(*net.IPNet)
+		if !ok {
+			continue
+		}
+		if ip := ipnet.IP.To4(); ip != nil {
+			v4 = append(v4, ip)
+		} else {
+			v6 = append(v6, ipnet.IP)
+		}
+	}
+
+	switch network {
+	case "udp4":
+		return v4
+	case "udp6":
+		return v6
+	}
+	return append(v4, v6...)
+}
+
+// Get preferred outbound ip of this machine
+var outboundIP = func(network string) (net.IP, error) {
+	target := "8.8.8.8:80"
+	if network == "udp6" {
+		target = "[2001:4860:4860::8888]:80"
+	}
+
+	conn, err := net.Dial(network, target)
+	if err != nil {
+		return nil, errors.New("can't get outbound IP: " + err.Error())
+	}
+	defer conn.Close()
+
+	localAddr := conn.LocalAddr().(*net.UDPAddr)
+
+	return localAddr.IP, nil
+}
+
+// MulticastNetwork возвращает сеть для multicast группы по её адресу,
+// потому что подписаться на группу можно только в сети её семейства.
+func MulticastNetwork(group *net.UDPAddr) string {
+	if group.IP.To4() != nil {
+		return "udp4"
+	}
+	return "udp6"
+}
+
+// IsLocalIP сообщает, принадлежит ли адрес этой машине.
+// Multicast пакет с той же машины приходит с адреса интерфейса, а не с loopback.
+func IsLocalIP(ip net.IP) bool {
+	if ip.IsLoopback() {
+		return true
+	}
+	addrs, err := net.InterfaceAddrs()
+	if err != nil {
+		return false
+	}
+	for _, a := range addrs {
+		if ipnet, ok := a.(*net.IPNet); ok && ipnet.IP.Equal(ip) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,147 @@
+package transport
+
+import (
+	"errors"
+	"net"
+	"testing"
+)
+
+func TestResolveBindAddr(t *testing.T) {
+	tests := []struct {
+		network, bind string
+		ip            string
+		port          int
+		zone          string
+		nilAddr       bool
+		wantErr       bool
+	}{
+		{network: "udp6", bind: "", nilAddr: true},
+		{network: "udp6", bind: "::1", ip: "::1"},
+		{network: "udp6", bind: "[::1]:7946", ip: "::1", port: 7946},
+		{network: "udp", bind: "[::1]:0", ip: "::1"},
+		{network: "udp6", bind: "[fe80::1%lo]:7946", ip: "fe80::1", port: 7946, zone: "lo"},
+		{network: "udp4", bind: "127.0.0.1:7946", ip: "127.0.0.1", port: 7946},
+		{network: "udp6", bind: "not an address", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		addr, err := ResolveBindAddr(tt.network, tt.bind)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("ResolveBindAddr(%q, %q) = %v, want error", tt.network, tt.bind, addr)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("ResolveBindAddr(%q, %q): %v", tt.network, tt.bind, err)
+			continue
+		}
+		if tt.nilAddr {
+			if addr != nil {
+				t.Errorf("ResolveBindAddr(%q, %q) = %v, want nil", tt.network, tt.bind, addr)
+			}
+			continue
+		}
+		if !addr.IP.Equal(net.ParseIP(tt.ip)) || addr.Port != tt.port || addr.Zone != tt.zone {
+			t.Errorf("ResolveBindAddr(%q, %q) = %v, want ip %v port %v zone %q", tt.network, tt.bind, addr, tt.ip, tt.port, tt.zone)
+		}
+	}
+}
+
+func TestResolveAdvertiseIP(t *testing.T) {
+	tests := []struct {
+		name      string
+		network   string
+		advertise string
+		iface     string
+		bind      *net.UDPAddr
+		want      string
+		wantErr   bool
+	}{
+		{name: "explicit ipv6", network: "udp6", advertise: "::1", want: "::1"},
+		{name: "explicit wins over bind", network: "udp6", advertise: "2001:db8::1", bind: &net.UDPAddr{IP: net.ParseIP("::1")}, want: "2001:db8::1"},
+		{name: "invalid", network: "udp6", advertise: "::zz", wantErr: true},
+		{name: "bind address", network: "udp6", bind: &net.UDPAddr{IP: net.ParseIP("::1")}, want: "::1"},
+		{name: "loopback interface ipv6", network: "udp6", iface: "lo", want: "::1"},
+		{name: "loopback interface ipv4", network: "udp4", iface: "lo", want: "127.0.0.1"},
+		{name: "unknown interface", network: "udp6", iface: "no-such-iface0", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.iface == "lo" && !hasInterfaceAddr("lo", tt.want) {
+				t.Skipf("interface lo has no %v", tt.want)
+			}
+			ip, err := ResolveAdvertiseIP(tt.network, tt.advertise, tt.iface, tt.bind)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("got %v, want error", ip)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !ip.Equal(net.ParseIP(tt.want)) {
+				t.Errorf("got %v, want %v", ip, tt.want)
+			}
+		})
+	}
+}
+
+func TestResolveAdvertiseIPWithoutNetwork(t *testing.T) {
+	// машина без приватных адресов и без маршрута наружу
+	defer func(private func(string) net.IP, outbound func(string) (net.IP, error)) {
+		privateIP, outboundIP = private, outbound
+	}(privateIP, outboundIP)
+	privateIP = func(string) net.IP { return nil }
+	outboundIP = func(string) (net.IP, error) {
+		return nil, errors.New("network is unreachable")
+	}
+
+	for network, want := range map[string]string{"udp4": "127.0.0.1", "udp6": "::1", "udp": "127.0.0.1"} {
+		ip, err := ResolveAdvertiseIP(network, "", "", &net.UDPAddr{IP: net.IPv4zero})
+		if err != nil {
+			t.Errorf("%v: %v", network, err)
+			continue
+		}
+		if !ip.Equal(net.ParseIP(want)) {
+			t.Errorf("%v: got %v, want %v", network, ip, want)
+		}
+	}
+}
+
+func TestFamilyAddrs(t *testing.T) {
+	addrs := []net.Addr{
+		&net.IPNet{IP: net.ParseIP("::1")},
+		&net.IPNet{IP: net.ParseIP("10.0.0.1").To4()},
+		&net.IPNet{IP: net.ParseIP("fe80::1")},
+	}
+	if got := familyAddrs("udp4", addrs); len(got) != 1 || !got[0].Equal(net.ParseIP("10.0.0.1")) {
+		t.Errorf("udp4: got %v", got)
+	}
+	if got := familyAddrs("udp6", addrs); len(got) != 2 || !got[0].Equal(net.ParseIP("::1")) {
+		t.Errorf("udp6: got %v", got)
+	}
+	// в двухстековой сети IPv4 идут первыми
+	if got := familyAddrs("udp", addrs); len(got) != 3 || got[0].To4() == nil {
+		t.Errorf("udp: got %v", got)
+	}
+}
+
+func hasInterfaceAddr(name, ip string) bool {
+	ifi, err := net.InterfaceByName(name)
+	if err != nil {
+		return false
+	}
+	addrs, err := ifi.Addrs()
+	if err != nil {
+		return false
+	}
+	for _, a := range addrs {
+		if ipnet, ok := a.(*net.IPNet); ok && ipnet.IP.Equal(net.ParseIP(ip)) {
+			return true
+		}
+	}
+	return false
+}
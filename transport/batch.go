@@ -0,0 +1,147 @@
+package transport
+
+import (
+	"sync"
+	"time"
+
+	"github.com/DemonVex/hashgossip/logger"
+	"github.com/DemonVex/hashgossip/wire"
+)
+
+// Batcher копит исходящие пакеты для каждого адреса и отправляет их одной
+// составной датаграммой COMPO, когда она заполнится до MTU или пройдёт Linger
+// с момента первого отложенного пакета. При нулевом Linger пакеты уходят сразу.
+// Под mutex пачка только забирается из pending, отправка идёт после него,
+// чтобы медленный сокет не задерживал пакеты для других адресов.
+type Batcher struct {
+	mtu    int
+	linger time.Duration
+	log    logger.Logger
+
+	mutex   *sync.Mutex
+	pending map[string]*batch
+	// номер последней созданной пачки, по нему таймер находит свою
+	gen    uint64
+	onSend func(packet []byte)
+	send   func(address string, payload []byte) error
+}
+
+type batch struct {
+	frames [][]byte
+	size   int
+	gen    uint64
+	timer  *time.Timer
+}
+
+// NewBatcher создаёт Batcher, без логгера используется logger.Default()
+func NewBatcher(mtu int, linger time.Duration, lg logger.Logger) *Batcher {
+	return &Batcher{
+		mtu:     mtu,
+		linger:  linger,
+		log:     logger.Or(lg),
+		mutex:   &sync.Mutex{},
+		pending: make(map[string]*batch),
+		send:    SendPayloadToUDP,
+	}
+}
+
+// OnSend задаёт функцию, которая вызывается на каждую отправленную датаграмму:
+// одиночный пакет или COMPO целиком, вложенные в COMPO пакеты отдельно не передаются.
+// Так же считает входящие пакеты узел. Задаётся до первого Send.
+func (b *Batcher) OnSend(f func(packet []byte)) {
+	b.onSend = f
+}
+
+func (b *Batcher) Send(address string, packet []byte) error {
+	if b.linger <= 0 || wire.HeaderLen+wire.FrameLenSize+len(packet) > b.mtu {
+		// большой пакет всё равно не с чем объединить, но отложенные
+		// для этого адреса пакеты должны уйти раньше него
+		b.flush(address)
+		return b.write(address, packet)
+	}
+
+	b.mutex.Lock()
+	bt, ok := b.pending[address]
+	var full *batch
+	if ok && bt.size+wire.FrameLenSize+len(packet) > b.mtu {
+		full = b.unsafeTake(address)
+		ok = false
+	}
+	if !ok {
+		b.gen++
+		bt = &batch{size: wire.HeaderLen, gen: b.gen}
+		gen := bt.gen
+		bt.timer = time.AfterFunc(b.linger, func() { b.expire(address, gen) })
+		b.pending[address] = bt
+	}
+	bt.frames = append(bt.frames, packet)
+	bt.size += wire.FrameLenSize + len(packet)
+	b.mutex.Unlock()
+
+	b.sendBatch(address, full)
+	return nil
+}
+
+// Flush отправляет все отложенные пакеты, вызывается при остановке узла
+func (b *Batcher) Flush() {
+	b.mutex.Lock()
+	taken := make(map[string]*batch, len(b.pending))
+	for address := range b.pending {
+		taken[address] = b.unsafeTake(address)
+	}
+	b.mutex.Unlock()
+
+	for address, bt := range taken {
+		b.sendBatch(address, bt)
+	}
+}
+
+func (b *Batcher) flush(address string) {
+	b.mutex.Lock()
+	bt := b.unsafeTake(address)
+	b.mutex.Unlock()
+	b.sendBatch(address, bt)
+}
+
+// expire вызывается таймером пачки gen. Если её уже отправили и для адреса
+// копится новая пачка, таймер опоздал и новую пачку не трогает.
+func (b *Batcher) expire(address string, gen uint64) {
+	b.mutex.Lock()
+	var bt *batch
+	if cur, ok := b.pending[address]; ok && cur.gen == gen {
+		bt = b.unsafeTake(address)
+	}
+	b.mutex.Unlock()
+	b.sendBatch(address, bt)
+}
+
+// unsafeTake забирает пачку адреса из pending, вызывается под mutex
+func (b *Batcher) unsafeTake(address string) *batch {
+	bt, ok := b.pending[address]
+	if !ok {
+		return nil
+	}
+	delete(b.pending, address)
+	bt.timer.Stop()
+	return bt
+}
+
+func (b *Batcher) sendBatch(address string, bt *batch) {
+	if bt == nil {
+		return
+	}
+	payload := bt.frames[0]
+	if len(bt.frames) > 1 {
+		payload = wire.Compound(bt.frames)
+	}
+	if err := b.write(address, payload); err != nil {
+		b.log.Warn("batch send failed", logger.Peer(address), logger.Err(err))
+	}
+}
+
+func (b *Batcher) write(address string, payload []byte) error {
+	if b.onSend != nil {
+		b.onSend(payload)
+	}
+	return b.send(address, payload)
+}
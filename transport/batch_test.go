@@ -0,0 +1,221 @@
+package transport
+
+import (
+	"bytes"
+	"errors"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	c "github.com/DemonVex/hashgossip/consts"
+	"github.com/DemonVex/hashgossip/logger"
+	"github.com/DemonVex/hashgossip/wire"
+)
+
+type sent struct {
+	address string
+	payload []byte
+}
+
+// recorder подменяет отправку в сокет и запоминает датаграммы
+type recorder struct {
+	mutex *sync.Mutex
+	sent  []sent
+}
+
+func newRecorder(b *Batcher) *recorder {
+	r := &recorder{mutex: &sync.Mutex{}}
+	b.send = func(address string, payload []byte) error {
+		r.mutex.Lock()
+		defer r.mutex.Unlock()
+		r.sent = append(r.sent, sent{address, payload})
+		return nil
+	}
+	return r
+}
+
+func (r *recorder) all() []sent {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	return append([]sent{}, r.sent...)
+}
+
+func packet(n int) []byte {
+	return wire.Pack(c.PrefMessage, 0, bytes.Repeat([]byte{byte(n)}, 100))
+}
+
+func frames(t *testing.T, payload []byte) [][]byte {
+	t.Helper()
+	prefix, _, body, err := wire.Unpack(payload)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(prefix, c.PrefCompound) {
+		return [][]byte{payload}
+	}
+	fs, err := wire.SplitCompound(body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return fs
+}
+
+func TestBatcherWithoutLinger(t *testing.T) {
+	b := NewBatcher(1400, 0, nil)
+	r := newRecorder(b)
+	b.Send("a", packet(1))
+	b.Send("a", packet(2))
+	if got := r.all(); len(got) != 2 || !bytes.Equal(got[1].payload, packet(2)) {
+		t.Errorf("sent %v datagrams, want both packets as is", len(got))
+	}
+}
+
+func TestBatcherCombinesUntilLinger(t *testing.T) {
+	b := NewBatcher(1400, 20*time.Millisecond, nil)
+	r := newRecorder(b)
+	for i := 1; i <= 3; i++ {
+		b.Send("a", packet(i))
+	}
+	b.Send("b", packet(4))
+	if len(r.all()) != 0 {
+		t.Fatal("packets are sent before Linger")
+	}
+
+	deadline := time.Now().Add(2 * time.Second)
+	for len(r.all()) < 2 && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	got := r.all()
+	if len(got) != 2 {
+		t.Fatalf("sent %v datagrams, want one per address", len(got))
+	}
+	for _, s := range got {
+		fs := frames(t, s.payload)
+		switch s.address {
+		case "a":
+			if len(fs) != 3 || !bytes.Equal(fs[2], packet(3)) {
+				t.Errorf("batch for a has %v frames, want 3 in order", len(fs))
+			}
+		case "b":
+			// одиночный пакет уходит без обёртки COMPO
+			if !bytes.Equal(s.payload, packet(4)) {
+				t.Errorf("single packet is wrapped: %q", s.payload[:c.PrefLen])
+			}
+		}
+	}
+}
+
+func TestBatcherFlushesFullBatch(t *testing.T) {
+	// в датаграмму влезают два пакета
+	mtu := wire.HeaderLen + 2*(wire.FrameLenSize+len(packet(0)))
+	b := NewBatcher(mtu, time.Hour, nil)
+	r := newRecorder(b)
+	for i := 1; i <= 3; i++ {
+		b.Send("a", packet(i))
+	}
+	got := r.all()
+	if len(got) != 1 || len(frames(t, got[0].payload)) != 2 {
+		t.Fatalf("full batch is not sent right away: %v datagrams", len(got))
+	}
+
+	b.Flush()
+	got = r.all()
+	if len(got) != 2 || !bytes.Equal(got[1].payload, packet(3)) {
+		t.Errorf("Flush did not send the rest: %v datagrams", len(got))
+	}
+}
+
+func TestBatcherStaleTimerKeepsNewBatch(t *testing.T) {
+	mtu := wire.HeaderLen + 2*(wire.FrameLenSize+len(packet(0)))
+	b := NewBatcher(mtu, time.Hour, nil)
+	r := newRecorder(b)
+	b.Send("a", packet(1))
+	first := b.pending["a"].gen
+	b.Send("a", packet(2))
+	// третий пакет не влезает: первая пачка уходит, начинается вторая
+	b.Send("a", packet(3))
+	if len(r.all()) != 1 {
+		t.Fatalf("sent %v datagrams, want the first batch", len(r.all()))
+	}
+
+	// таймер первой пачки сработал, когда её уже отправили
+	b.expire("a", first)
+	if len(r.all()) != 1 {
+		t.Fatal("stale timer flushed the new batch early")
+	}
+	if _, ok := b.pending["a"]; !ok {
+		t.Fatal("stale timer dropped the new batch")
+	}
+
+	b.expire("a", b.pending["a"].gen)
+	if got := r.all(); len(got) != 2 || !bytes.Equal(got[1].payload, packet(3)) {
+		t.Errorf("own timer did not flush the new batch")
+	}
+}
+
+func TestBatcherSendsOutsideLock(t *testing.T) {
+	b := NewBatcher(1400, time.Hour, nil)
+	release := make(chan struct{})
+	blocked := make(chan struct{})
+	b.send = func(address string, payload []byte) error {
+		if address == "slow" {
+			close(blocked)
+			<-release
+		}
+		return nil
+	}
+	defer close(release)
+
+	b.Send("slow", packet(1))
+	go b.Flush()
+	<-blocked
+
+	done := make(chan struct{})
+	go func() {
+		b.Send("fast", packet(2))
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("Send waits for a socket write to another address")
+	}
+}
+
+func TestBatcherLogsToOwnLogger(t *testing.T) {
+	var buf bytes.Buffer
+	log, err := logger.New(&buf, logger.FormatLogfmt, logger.WarnLevel, logger.Sampling{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	b := NewBatcher(1400, time.Hour, log)
+	b.send = func(string, []byte) error { return errors.New("connection refused") }
+
+	b.Send("127.0.0.1:1", packet(1))
+	b.Flush()
+	if !strings.Contains(buf.String(), "batch send failed") {
+		t.Errorf("failed send is not logged to the batcher logger, got %q", buf.String())
+	}
+}
+
+func TestBatcherOnSendCountsDatagrams(t *testing.T) {
+	b := NewBatcher(1400, time.Hour, nil)
+	newRecorder(b)
+	var counted []string
+	b.OnSend(func(packet []byte) { counted = append(counted, string(packet[:c.PrefLen])) })
+
+	b.Send("127.0.0.1:1", packet(1))
+	b.Send("127.0.0.1:1", packet(2))
+	b.Send("127.0.0.1:2", packet(3))
+	if len(counted) != 0 {
+		t.Fatalf("OnSend called before anything was sent: %v", counted)
+	}
+	b.Flush()
+	// на проводе одна COMPO и один одиночный пакет, так же их считает приём
+	sort.Strings(counted)
+	if strings.Join(counted, ",") != "COMPO,MESSA" {
+		t.Errorf("OnSend got %v, want one COMPO and one MESSA", counted)
+	}
+}
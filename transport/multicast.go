@@ -0,0 +1,173 @@
+package transport
+
+import (
+	"errors"
+	"fmt"
+	"net"
+
+	"golang.org/x/net/ipv4"
+	"golang.org/x/net/ipv6"
+
+	"github.com/DemonVex/hashgossip/logger"
+)
+
+type MulticastOptions struct {
+	// имена интерфейсов, пустой список означает интерфейс по умолчанию
+	Interfaces []string
+	// TTL (hop limit для IPv6) исходящих multicast пакетов, 0 - значение ОС
+	TTL int
+	// получать ли свои же multicast пакеты; нужно, если несколько узлов на одной машине
+	Loopback bool
+}
+
+// multicastConn скрывает разницу между ipv4 и ipv6 PacketConn
+type multicastConn interface {
+	JoinGroup(*net.Interface, net.Addr) error
+	SetMulticastInterface(*net.Interface) error
+	SetMulticastLoopback(bool) error
+	SetMulticastTTL(int) error
+}
+
+type ipv6Conn struct {
+	*ipv6.PacketConn
+}
+
+func (c ipv6Conn) SetMulticastTTL(hops int) error {
+	return c.SetMulticastHopLimit(hops)
+}
+
+func newMulticastConn(conn *net.UDPConn, group *net.UDPAddr) multicastConn {
+	if group.IP.To4() != nil {
+		return ipv4.NewPacketConn(conn)
+	}
+	return ipv6Conn{ipv6.NewPacketConn(conn)}
+}
+
+func (o MulticastOptions) interfaces() ([]*net.Interface, error) {
+	if len(o.Interfaces) == 0 {
+		return []*net.Interface{nil}, nil
+	}
+
+	ifaces := make([]*net.Interface, 0, len(o.Interfaces))
+	for _, name := range o.Interfaces {
+		ifi, err := net.InterfaceByName(name)
+		if err != nil {
+			return nil, fmt.Errorf("multicast interface %v: %v", name, err)
+		}
+		ifaces = append(ifaces, ifi)
+	}
+	return ifaces, nil
+}
+
+func (o MulticastOptions) apply(mc multicastConn) error {
+	if err := mc.SetMulticastLoopback(o.Loopback); err != nil {
+		return err
+	}
+	if o.TTL > 0 {
+		return mc.SetMulticastTTL(o.TTL)
+	}
+	return nil
+}
+
+// подменяется в тестах, чтобы подписка на интерфейсе не удалась
+var listenMulticastUDP = net.ListenMulticastUDP
+
+// ListenMulticastUDP подписывается на группу на всех указанных интерфейсах.
+// Сокет открывается на первом интерфейсе, где это удалось, к остальным он присоединяется.
+// Ошибка возвращается только если не удалось подписаться ни на одном из них.
+// Без логгера используется logger.Default().
+func ListenMulticastUDP(address string, opts MulticastOptions, log logger.Logger) (*net.UDPConn, error) {
+	log = logger.Or(log)
+	group, err := net.ResolveUDPAddr("udp", address)
+	if err != nil {
+		return nil, err
+	}
+	ifaces, err := opts.interfaces()
+	if err != nil {
+		return nil, err
+	}
+
+	var conn *net.UDPConn
+	var rest []*net.Interface
+	for i, ifi := range ifaces {
+		conn, err = listenMulticastUDP(MulticastNetwork(group), ifi, group)
+		if err == nil {
+			rest = ifaces[i+1:]
+			break
+		}
+		log.Warn("can't join multicast group", logger.F("group", group), logger.F("interface", ifaceName(ifi)), logger.Err(err))
+	}
+	if conn == nil {
+		return nil, err
+	}
+	conn.SetReadBuffer(MaxDatagramSize)
+
+	mc := newMulticastConn(conn, group)
+	for _, ifi := range rest {
+		if err := mc.JoinGroup(ifi, group); err != nil {
+			log.Warn("can't join multicast group", logger.F("group", group), logger.F("interface", ifaceName(ifi)), logger.Err(err))
+		}
+	}
+	if err := opts.apply(mc); err != nil {
+		log.Warn("can't set multicast options", logger.Err(err))
+	}
+
+	return conn, nil
+}
+
+// ifaceName - имя интерфейса для логов, nil - интерфейс по умолчанию
+func ifaceName(ifi *net.Interface) string {
+	if ifi == nil {
+		return "default"
+	}
+	return ifi.Name
+}
+
+// SendMulticast отправляет пакет в группу через каждый из указанных интерфейсов.
+// Без логгера используется logger.Default().
+func SendMulticast(address string, opts MulticastOptions, payload []byte, log logger.Logger) error {
+	log = logger.Or(log)
+	if len(payload) > MaxDatagramSize {
+		return fmt.Errorf("maxPayloadSize = %v, payload size = %v", MaxDatagramSize, len(payload))
+	}
+
+	group, err := net.ResolveUDPAddr("udp", address)
+	if err != nil {
+		return err
+	}
+	ifaces, err := opts.interfaces()
+	if err != nil {
+		return err
+	}
+
+	conn, err := net.DialUDP(MulticastNetwork(group), nil, group)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	mc := newMulticastConn(conn, group)
+	if err := opts.apply(mc); err != nil {
+		return err
+	}
+
+	sent := 0
+	for _, ifi := range ifaces {
+		if ifi != nil {
+			if err := mc.SetMulticastInterface(ifi); err != nil {
+				log.Warn("can't use interface for multicast", logger.F("interface", ifi.Name), logger.Err(err))
+				continue
+			}
+		}
+		if _, err := conn.Write(payload); err != nil {
+			log.Warn("multicast write failed", logger.Err(err))
+			continue
+		}
+		sent++
+	}
+
+	if sent == 0 {
+		return errors.New("multicast payload was not sent on any interface")
+	}
+	return nil
+}
@@ -0,0 +1,83 @@
+package transport
+
+import (
+	"bytes"
+	"errors"
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/DemonVex/hashgossip/logger"
+)
+
+// failMulticastOn заставляет подписку на интерфейсах names завершаться ошибкой
+func failMulticastOn(t *testing.T, names ...string) *[]string {
+	tried := &[]string{}
+	listenMulticastUDP = func(network string, ifi *net.Interface, group *net.UDPAddr) (*net.UDPConn, error) {
+		*tried = append(*tried, ifi.Name)
+		for _, name := range names {
+			if ifi.Name == name {
+				return nil, errors.New("setsockopt: no such device")
+			}
+		}
+		return net.ListenMulticastUDP(network, ifi, group)
+	}
+	t.Cleanup(func() { listenMulticastUDP = net.ListenMulticastUDP })
+	return tried
+}
+
+func multicastIfaces(t *testing.T, n int) []string {
+	var names []string
+	ifaces, err := net.Interfaces()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, ifi := range ifaces {
+		if ifi.Flags&net.FlagUp != 0 && ifi.Flags&net.FlagMulticast != 0 && ifi.Name != "lo" {
+			names = append(names, ifi.Name)
+		}
+	}
+	if len(names) < n {
+		t.Skipf("need %v multicast interfaces, got %v", n, names)
+	}
+	return names[:n]
+}
+
+func TestListenMulticastUDPSkipsFailedInterface(t *testing.T) {
+	good := multicastIfaces(t, 1)[0]
+	tried := failMulticastOn(t, "lo")
+
+	var buf bytes.Buffer
+	log, err := logger.New(&buf, logger.FormatLogfmt, logger.WarnLevel, logger.Sampling{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	opts := MulticastOptions{Interfaces: []string{"lo", good}, TTL: 1, Loopback: true}
+	conn, err := ListenMulticastUDP("224.0.0.1:0", opts, log)
+	if err != nil {
+		t.Fatalf("ListenMulticastUDP(lo, %v): %v", good, err)
+	}
+	conn.Close()
+
+	if strings.Join(*tried, ",") != "lo,"+good {
+		t.Errorf("tried interfaces %v, want lo then %v", *tried, good)
+	}
+	if !strings.Contains(buf.String(), "interface=lo") {
+		t.Errorf("failed interface is not logged to the node logger, got %q", buf.String())
+	}
+}
+
+func TestListenMulticastUDPAllInterfacesFail(t *testing.T) {
+	good := multicastIfaces(t, 1)[0]
+	failMulticastOn(t, "lo", good)
+
+	log, err := logger.New(&bytes.Buffer{}, logger.FormatLogfmt, logger.WarnLevel, logger.Sampling{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn, err := ListenMulticastUDP("224.0.0.1:0", MulticastOptions{Interfaces: []string{"lo", good}}, log)
+	if err == nil {
+		conn.Close()
+		t.Fatal("ListenMulticastUDP succeeded on failing interfaces, want error")
+	}
+}
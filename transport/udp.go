@@ -3,8 +3,9 @@ package transport
 import (
 	"errors"
 	"fmt"
-	"log"
 	"net"
+
+	"github.com/DemonVex/hashgossip/logger"
 )
 
 const MaxDatagramSize = 8192
@@ -14,7 +15,8 @@ func SendPayloadToUDP(address string, payload []byte) error {
 		return errors.New(fmt.Sprintf("maxPayloadSize = %v, payload size = %v", MaxDatagramSize, len(payload)))
 	}
 
-	udpConn, err := net.Dial("udp4", address)
+	// семейство адресов определяется самим адресом, поэтому подходит и IPv4, и IPv6
+	udpConn, err := net.Dial("udp", address)
 	if err != nil {
 		return err
 	}
@@ -24,13 +26,18 @@ func SendPayloadToUDP(address string, payload []byte) error {
 	return err
 }
 
-func ServeUDP(conn *net.UDPConn, handler func(*net.UDPAddr, int, []byte)) {
+// ServeUDP читает датаграммы из conn, пока его не закроют. Без логгера используется logger.Default()
+func ServeUDP(conn *net.UDPConn, handler func(*net.UDPAddr, int, []byte), log logger.Logger) {
+	log = logger.Or(log)
 	buf := make([]byte, MaxDatagramSize)
 
 	for {
 		n, src, err := conn.ReadFromUDP(buf)
+		if errors.Is(err, net.ErrClosed) {
+			return
+		}
 		if err != nil {
-			log.Println(src, " ", err)
+			log.Warn("udp read failed", logger.Peer(src.String()), logger.Err(err))
 			continue
 		}
 
@@ -40,18 +47,17 @@ func ServeUDP(conn *net.UDPConn, handler func(*net.UDPAddr, int, []byte)) {
 	}
 }
 
-func ServeMulticastUDP(address string, handler func(*net.UDPAddr, int, []byte)) {
-	multicastAddr, err := net.ResolveUDPAddr("udp4", address)
-	if err != nil {
-		log.Fatal(err)
-	}
-	udpListner, err := net.ListenMulticastUDP("udp4", nil, multicastAddr)
-	udpListner.SetReadBuffer(MaxDatagramSize)
+func ServeMulticastUDP(conn *net.UDPConn, handler func(*net.UDPAddr, int, []byte), log logger.Logger) {
+	log = logger.Or(log)
 	for {
 		buf := make([]byte, MaxDatagramSize)
-		n, src, err := udpListner.ReadFromUDP(buf)
+		n, src, err := conn.ReadFromUDP(buf)
+		if errors.Is(err, net.ErrClosed) {
+			return
+		}
 		if err != nil {
-			log.Println("ReadFromUDP failed:", err)
+			log.Warn("multicast read failed", logger.Err(err))
+			continue
 		}
 		// здесь тоже обработка в той же горутине
 		handler(src, n, buf)
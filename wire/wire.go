@@ -0,0 +1,161 @@
+package wire
+
+import (
+	"encoding/binary"
+	"errors"
+
+	"github.com/DemonVex/hashgossip/codec"
+	"github.com/DemonVex/hashgossip/compress"
+	c "github.com/DemonVex/hashgossip/consts"
+)
+
+// Заголовок пакета: пять байт типа (HELLO, MESSA, ...), байт версии формата
+// и байт флагов. Пакеты другой версии не разбираются. Биты 0-3 флагов -
+// идентификатор кодека тела, 0 означает кодек, зарегистрированный для типа
+// по умолчанию. Биты 4-5 - алгоритм, которым сжато тело. Биты 6-7 - алгоритм
+// сжатия, который отправитель просит использовать в пакетах для него.
+const (
+	// Version меняется при любом несовместимом изменении заголовка или тел пакетов
+	Version byte = 1
+
+	HeaderLen = c.PrefLen + 2
+
+	codecMask       = 0x0f
+	compressionBits = 4
+	acceptsBits     = 6
+)
+
+var (
+	ErrShortPacket = errors.New("packet is shorter than header")
+	// отправитель говорит на другой версии протокола
+	ErrVersion = errors.New("unsupported wire version")
+)
+
+func Flags(codecID byte, body, accepts compress.Algorithm) byte {
+	return codecID&codecMask | byte(body&3)<<compressionBits | byte(accepts&3)<<acceptsBits
+}
+
+func CodecID(flags byte) byte {
+	return flags & codecMask
+}
+
+func BodyCompression(flags byte) compress.Algorithm {
+	return compress.Algorithm(flags >> compressionBits & 3)
+}
+
+func AcceptedCompression(flags byte) compress.Algorithm {
+	return compress.Algorithm(flags >> acceptsBits & 3)
+}
+
+func Pack(prefix []byte, flags byte, body []byte) []byte {
+	payload := make([]byte, 0, HeaderLen+len(body))
+	payload = append(payload, prefix...)
+	payload = append(payload, Version, flags)
+	return append(payload, body...)
+}
+
+// Unpack разбирает заголовок. При ErrVersion prefix заполнен, чтобы было видно,
+// какой пакет отброшен, а VersionOf(buf) возвращает версию отправителя.
+func Unpack(buf []byte) (prefix []byte, flags byte, body []byte, err error) {
+	if len(buf) < HeaderLen {
+		return nil, 0, nil, ErrShortPacket
+	}
+	if VersionOf(buf) != Version {
+		return buf[:c.PrefLen], 0, nil, ErrVersion
+	}
+	return buf[:c.PrefLen], buf[HeaderLen-1], buf[HeaderLen:], nil
+}
+
+// VersionOf - версия формата из заголовка пакета, 0 если пакет короче заголовка
+func VersionOf(buf []byte) byte {
+	if len(buf) < HeaderLen {
+		return 0
+	}
+	return buf[c.PrefLen]
+}
+
+// Encoding описывает, как кодировать пакеты для конкретного получателя
+type Encoding struct {
+	// nil означает кодек по умолчанию: служебные пакеты идут с идентификатором 0,
+	// а Encode кодирует тело msgpack и указывает его в заголовке
+	Codec codec.Codec
+	// сжатие тела, алгоритм выбирает получатель
+	Compression compress.Options
+	// сжатие, которое мы просим использовать для нас
+	Accepts compress.Algorithm
+}
+
+func (e Encoding) codecID() byte {
+	if e.Codec == nil {
+		return codec.DefaultID
+	}
+	return e.Codec.ID()
+}
+
+func (e Encoding) Encode(prefix []byte, v interface{}) ([]byte, error) {
+	// кодек по умолчанию для чужого типа может быть любым, поэтому кодек называется явно
+	cd := e.Codec
+	if cd == nil {
+		cd = codec.Msgpack
+	}
+	body, err := cd.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	alg, body := e.Compression.Compress(body)
+	return Pack(prefix, Flags(cd.ID(), alg, e.Accepts), body), nil
+}
+
+// PortPacket собирает служебный пакет, в теле которого только порт отправителя
+func (e Encoding) PortPacket(prefix []byte, port uint16) []byte {
+	return e.IdentityPacket(prefix, port, "")
+}
+
+// IdentityPacket - то же, что PortPacket, но после порта идёт идентификатор узла.
+// Получатели, которые читают только порт, остаток тела не замечают.
+func (e Encoding) IdentityPacket(prefix []byte, port uint16, id string) []byte {
+	body := make([]byte, 2+len(id))
+	binary.LittleEndian.PutUint16(body, port)
+	copy(body[2:], id)
+	return Pack(prefix, Flags(e.codecID(), compress.None, e.Accepts), body)
+}
+
+// Составной пакет COMPO несёт в теле несколько обычных пакетов,
+// каждый с префиксом длины (uint16, little endian)
+const FrameLenSize = 2
+
+var ErrBadCompound = errors.New("malformed compound packet")
+
+func Compound(frames [][]byte) []byte {
+	size := HeaderLen
+	for _, f := range frames {
+		size += FrameLenSize + len(f)
+	}
+
+	payload := make([]byte, 0, size)
+	payload = append(payload, c.PrefCompound...)
+	payload = append(payload, Version, Flags(codec.DefaultID, compress.None, compress.None))
+	for _, f := range frames {
+		payload = append(payload, 0, 0)
+		binary.LittleEndian.PutUint16(payload[len(payload)-FrameLenSize:], uint16(len(f)))
+		payload = append(payload, f...)
+	}
+	return payload
+}
+
+func SplitCompound(body []byte) ([][]byte, error) {
+	var frames [][]byte
+	for len(body) > 0 {
+		if len(body) < FrameLenSize {
+			return nil, ErrBadCompound
+		}
+		n := int(binary.LittleEndian.Uint16(body))
+		body = body[FrameLenSize:]
+		if n > len(body) {
+			return nil, ErrBadCompound
+		}
+		frames = append(frames, body[:n])
+		body = body[n:]
+	}
+	return frames, nil
+}
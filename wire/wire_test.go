@@ -0,0 +1,156 @@
+package wire
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/DemonVex/hashgossip/codec"
+	"github.com/DemonVex/hashgossip/compress"
+	c "github.com/DemonVex/hashgossip/consts"
+)
+
+func TestPackUnpack(t *testing.T) {
+	for _, cd := range []byte{codec.DefaultID, codec.MsgpackID, codec.ProtobufID, codec.JSONID} {
+		for _, body := range []compress.Algorithm{compress.None, compress.Flate, compress.Gzip, compress.Fast} {
+			for _, accepts := range []compress.Algorithm{compress.None, compress.Flate, compress.Gzip, compress.Fast} {
+				packet := Pack(c.PrefMessage, Flags(cd, body, accepts), []byte("body"))
+				if len(packet) != HeaderLen+4 {
+					t.Fatalf("len(packet) = %v, want %v", len(packet), HeaderLen+4)
+				}
+
+				prefix, flags, b, err := Unpack(packet)
+				if err != nil {
+					t.Fatalf("Unpack: %v", err)
+				}
+				if !bytes.Equal(prefix, c.PrefMessage) || string(b) != "body" {
+					t.Errorf("Unpack = %q, %q, want %q, body", prefix, b, c.PrefMessage)
+				}
+				if CodecID(flags) != cd || BodyCompression(flags) != body || AcceptedCompression(flags) != accepts {
+					t.Errorf("flags %08b = codec %v body %v accepts %v, want %v %v %v",
+						flags, CodecID(flags), BodyCompression(flags), AcceptedCompression(flags), cd, body, accepts)
+				}
+			}
+		}
+	}
+}
+
+func TestUnpackShortPacket(t *testing.T) {
+	for _, buf := range [][]byte{nil, []byte("HELLO"), []byte("HELLO")[:HeaderLen-2]} {
+		if _, _, _, err := Unpack(buf); err != ErrShortPacket {
+			t.Errorf("Unpack(%q) error = %v, want %v", buf, err, ErrShortPacket)
+		}
+	}
+	// пакет из одного заголовка допустим, тело пустое
+	if _, _, body, err := Unpack(Pack(c.PrefShutdown, 0, nil)); err != nil || len(body) != 0 {
+		t.Errorf("Unpack(header only) = %q, %v", body, err)
+	}
+}
+
+func TestUnpackVersionMismatch(t *testing.T) {
+	packet := Pack(c.PrefHello, Flags(codec.MsgpackID, compress.None, compress.None), []byte{1, 2})
+	packet[c.PrefLen] = Version + 1
+
+	prefix, _, _, err := Unpack(packet)
+	if err != ErrVersion {
+		t.Fatalf("Unpack error = %v, want %v", err, ErrVersion)
+	}
+	if !bytes.Equal(prefix, c.PrefHello) {
+		t.Errorf("prefix = %q, want %q", prefix, c.PrefHello)
+	}
+	if v := VersionOf(packet); v != Version+1 {
+		t.Errorf("VersionOf = %v, want %v", v, Version+1)
+	}
+
+	// пакет формата без байта версии: сразу за типом идут флаги
+	old := append(append([]byte{}, c.PrefHello...), Flags(codec.MsgpackID, compress.Flate, compress.None), 1, 2)
+	if _, _, _, err := Unpack(old); err != ErrVersion {
+		t.Errorf("Unpack(old format) error = %v, want %v", err, ErrVersion)
+	}
+}
+
+func TestEncodingPackets(t *testing.T) {
+	enc := Encoding{Codec: codec.JSON, Compression: compress.Options{Algorithm: compress.Gzip, Threshold: 64}, Accepts: compress.Flate}
+
+	packet := enc.IdentityPacket(c.PrefProbe, 7946, "node-1")
+	prefix, flags, body, err := Unpack(packet)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(prefix, c.PrefProbe) || CodecID(flags) != codec.JSONID || AcceptedCompression(flags) != compress.Flate {
+		t.Errorf("IdentityPacket header = %q %08b", prefix, flags)
+	}
+	// служебные пакеты не сжимаются
+	if BodyCompression(flags) != compress.None || !bytes.Equal(body, []byte{0x0a, 0x1f, 'n', 'o', 'd', 'e', '-', '1'}) {
+		t.Errorf("IdentityPacket body = %x, compression %v", body, BodyCompression(flags))
+	}
+
+	if _, _, body, _ := Unpack(enc.PortPacket(c.PrefHello, 7946)); !bytes.Equal(body, []byte{0x0a, 0x1f}) {
+		t.Errorf("PortPacket body = %x", body)
+	}
+
+	packet, err = enc.Encode(c.PrefMessage, map[string]int{"a": 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, flags, body, err = Unpack(packet)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if BodyCompression(flags) != compress.None || string(body) != `{"a":1}` {
+		t.Errorf("Encode below threshold = %q, compression %v", body, BodyCompression(flags))
+	}
+}
+
+func TestEncodeWithoutCodec(t *testing.T) {
+	packet, err := Encoding{}.Encode(c.PrefMessage, []string{"a", "b"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, flags, body, err := Unpack(packet)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// без кодека тело в msgpack, и заголовок говорит об этом явно
+	if CodecID(flags) != codec.MsgpackID {
+		t.Errorf("codec id = %v, want msgpack %v", CodecID(flags), codec.MsgpackID)
+	}
+	var got []string
+	if err := codec.Msgpack.Unmarshal(body, &got); err != nil || len(got) != 2 {
+		t.Errorf("body = %v, %v", got, err)
+	}
+}
+
+func TestCompound(t *testing.T) {
+	frames := [][]byte{
+		Pack(c.PrefHello, 0, []byte{1, 2}),
+		Pack(c.PrefMessage, Flags(codec.ProtobufID, compress.None, compress.None), bytes.Repeat([]byte{7}, 300)),
+		Pack(c.PrefShutdown, 0, nil),
+	}
+	packet := Compound(frames)
+
+	prefix, flags, body, err := Unpack(packet)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(prefix, c.PrefCompound) || flags != Flags(codec.DefaultID, compress.None, compress.None) {
+		t.Errorf("Compound header = %q %08b", prefix, flags)
+	}
+	got, err := SplitCompound(body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != len(frames) {
+		t.Fatalf("SplitCompound returned %v frames, want %v", len(got), len(frames))
+	}
+	for i := range frames {
+		if !bytes.Equal(got[i], frames[i]) {
+			t.Errorf("frame %v = %x, want %x", i, got[i], frames[i])
+		}
+	}
+
+	for _, bad := range [][]byte{{1}, {5, 0, 1, 2}, body[:len(body)-1]} {
+		if _, err := SplitCompound(bad); err != ErrBadCompound {
+			t.Errorf("SplitCompound(%x) error = %v, want %v", bad, err, ErrBadCompound)
+		}
+	}
+}